@@ -0,0 +1,240 @@
+// Filename: client/client.go
+
+// Package client is a Go client for the product review API. It speaks the
+// v2 API and returns the same Product and Review types the server uses.
+//
+//	c := client.New("http://localhost:4000")
+//	product, err := c.GetProduct(ctx, 1)
+//	if errors.Is(err, client.ErrNotFound) {
+//		...
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mtechguy/test2/internal/data"
+	"github.com/mtechguy/test2/internal/tracing"
+)
+
+// The API's own types, so callers don't need to declare their own.
+type (
+	Product  = data.Product
+	Review   = data.Review
+	Metadata = data.Metadata
+)
+
+// Client calls the API. It is safe for concurrent use.
+type Client struct {
+	baseURL        string
+	httpClient     *http.Client
+	maxRetries     int
+	retryWait      time.Duration
+	acceptLanguage string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the http.Client requests are sent with.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithMaxRetries sets how many times a request turned away with a 429 or
+// 503 is retried. Zero disables retries.
+func WithMaxRetries(n int) Option {
+	return func(c *Client) {
+		c.maxRetries = n
+	}
+}
+
+// WithRetryWait sets how long to wait before the first retry when the
+// response has no Retry-After header. The wait doubles on each retry.
+func WithRetryWait(d time.Duration) Option {
+	return func(c *Client) {
+		c.retryWait = d
+	}
+}
+
+// WithAcceptLanguage sets the Accept-Language header, which picks the
+// language of error messages and of translated products.
+func WithAcceptLanguage(acceptLanguage string) Option {
+	return func(c *Client) {
+		c.acceptLanguage = acceptLanguage
+	}
+}
+
+// New returns a Client for the API at baseURL, e.g. http://localhost:4000.
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		maxRetries: 3,
+		retryWait:  500 * time.Millisecond,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// request is one API call.
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	body        any
+	contentType string
+}
+
+// do sends req and decodes the response envelope into result. Requests the
+// server turned away because it was busy are retried, waiting as long as
+// its Retry-After header asks. POST requests carry an Idempotency-Key, so a
+// retried create can't create twice. A request made within a traced
+// request carries its traceparent, so the server's spans join the trace.
+func (c *Client) do(ctx context.Context, req request, result any) error {
+	var body []byte
+	if req.body != nil {
+		var err error
+		body, err = json.Marshal(req.body)
+		if err != nil {
+			return err
+		}
+	}
+
+	target := c.baseURL + "/v2" + req.path
+	if len(req.query) > 0 {
+		target += "?" + req.query.Encode()
+	}
+
+	var idempotencyKey string
+	if req.method == http.MethodPost {
+		idempotencyKey = newIdempotencyKey()
+	}
+
+	for attempt := 0; ; attempt++ {
+		httpReq, err := http.NewRequestWithContext(ctx, req.method, target, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		httpReq.Header.Set("Accept", "application/json")
+		if body != nil {
+			contentType := req.contentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			httpReq.Header.Set("Content-Type", contentType)
+		}
+		if idempotencyKey != "" {
+			httpReq.Header.Set("Idempotency-Key", idempotencyKey)
+		}
+		if c.acceptLanguage != "" {
+			httpReq.Header.Set("Accept-Language", c.acceptLanguage)
+		}
+		tracing.Inject(ctx, httpReq.Header)
+
+		res, err := c.httpClient.Do(httpReq)
+		if err != nil {
+			return err
+		}
+
+		if res.StatusCode < 300 {
+			defer res.Body.Close()
+			if result == nil {
+				_, err = io.Copy(io.Discard, res.Body)
+				return err
+			}
+			return json.NewDecoder(res.Body).Decode(result)
+		}
+
+		apiErr := readError(res)
+		res.Body.Close()
+
+		retryable := res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable
+		if !retryable || attempt >= c.maxRetries {
+			return apiErr
+		}
+
+		wait := apiErr.RetryAfter
+		if wait <= 0 {
+			wait = c.retryWait << attempt
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// parseRetryAfter reads a Retry-After header, given either in seconds or as
+// an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(fmt.Sprintf("client: generating an idempotency key: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// pageQuery adds the pagination and sort parameters shared by the lists.
+func pageQuery(query url.Values, page int, pageSize int, sort string) {
+	if page > 0 {
+		query.Set("page", strconv.Itoa(page))
+	}
+	if pageSize > 0 {
+		query.Set("page_size", strconv.Itoa(pageSize))
+	}
+	if sort != "" {
+		query.Set("sort", sort)
+	}
+}
+
+// Health is the status the API reports about itself.
+type Health struct {
+	Status     string `json:"status"`
+	SystemInfo struct {
+		Environment string `json:"environment"`
+		Version     string `json:"version"`
+	} `json:"system_info"`
+}
+
+// Health reports whether the API is available.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	var health Health
+	err := c.do(ctx, request{method: http.MethodGet, path: "/healthcheck"}, &health)
+	if err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
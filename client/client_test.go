@@ -0,0 +1,396 @@
+// Filename: client/client_test.go
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mtechguy/test2/internal/tracing"
+)
+
+// The responses the client is tested against are scripted, so a test can
+// ask for the statuses and headers it needs. cmd/api tests the client
+// against the real handler.
+
+func writeJSON(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprint(w, body)
+}
+
+func writeProblem(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"status":%d,"title":%q,"code":"scripted"}`, status, http.StatusText(status))
+}
+
+func TestProductsPaginatesToLastPage(t *testing.T) {
+	const lastPage = 3
+	var mu sync.Mutex
+	var pages []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/products" {
+			t.Errorf("path = %s, want /v2/products", r.URL.Path)
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		mu.Lock()
+		pages = append(pages, page)
+		mu.Unlock()
+		writeJSON(w, http.StatusOK, fmt.Sprintf(
+			`{"products":[{"product_id":%d},{"product_id":%d}],"metadata":{"current_page":%d,"last_page":%d}}`,
+			2*page-1, 2*page, page, lastPage))
+	}))
+	defer server.Close()
+
+	c := New(server.URL)
+	var ids []int64
+	for product, err := range c.Products(context.Background(), ProductFilter{PageSize: 2}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, product.ProductID)
+	}
+
+	if len(ids) != 2*lastPage || ids[len(ids)-1] != 2*lastPage {
+		t.Errorf("product IDs = %v, want 1 to %d", ids, 2*lastPage)
+	}
+	if len(pages) != lastPage || pages[0] != 1 || pages[len(pages)-1] != lastPage {
+		t.Errorf("pages fetched = %v, want 1 to %d", pages, lastPage)
+	}
+}
+
+func TestPaginateStops(t *testing.T) {
+	tests := []struct {
+		name      string
+		firstPage int
+		lastPage  int
+		perPage   int
+		stopAfter int // items taken before breaking out, 0 for all
+		want      int // pages fetched
+	}{
+		{name: "at the last page", firstPage: 1, lastPage: 4, perPage: 2, want: 4},
+		{name: "from a later page", firstPage: 3, lastPage: 4, perPage: 2, want: 2},
+		{name: "at an empty page", firstPage: 1, lastPage: 4, perPage: 0, want: 1},
+		{name: "when the caller breaks", firstPage: 1, lastPage: 4, perPage: 2, stopAfter: 3, want: 2},
+		{name: "with no last page", firstPage: 1, lastPage: 0, perPage: 2, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetched := 0
+			fetch := func(page int) ([]int, Metadata, error) {
+				fetched++
+				return make([]int, tt.perPage), Metadata{CurrentPage: page, LastPage: tt.lastPage}, nil
+			}
+			taken := 0
+			for _, err := range paginate(fetch, tt.firstPage) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				taken++
+				if taken == tt.stopAfter {
+					break
+				}
+			}
+			if fetched != tt.want {
+				t.Errorf("fetched %d pages, want %d", fetched, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaginateYieldsError(t *testing.T) {
+	failure := errors.New("failed")
+	fetch := func(page int) ([]int, Metadata, error) {
+		if page == 2 {
+			return nil, Metadata{}, failure
+		}
+		return []int{page}, Metadata{CurrentPage: page, LastPage: 3}, nil
+	}
+	var errs []error
+	for _, err := range paginate(fetch, 1) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 1 || errs[0] != failure {
+		t.Errorf("errors = %v, want only %v", errs, failure)
+	}
+}
+
+func TestRetryHonoursRetryAfter(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		attempt := len(times)
+		mu.Unlock()
+		if attempt == 1 {
+			w.Header().Set("Retry-After", "1")
+			writeProblem(w, http.StatusTooManyRequests)
+			return
+		}
+		writeJSON(w, http.StatusOK, `{"status":"available"}`)
+	}))
+	defer server.Close()
+
+	// The retry wait is far longer than Retry-After, so a retry that came
+	// quickly can only have followed the header.
+	c := New(server.URL, WithRetryWait(time.Minute))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := c.Health(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(times) != 2 {
+		t.Fatalf("sent %d requests, want 2", len(times))
+	}
+	if wait := times[1].Sub(times[0]); wait < time.Second || wait > 5*time.Second {
+		t.Errorf("retried after %s, want the 1s Retry-After asked for", wait)
+	}
+}
+
+func TestRetryBacksOff(t *testing.T) {
+	const retryWait = 20 * time.Millisecond
+	var mu sync.Mutex
+	var times []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		writeProblem(w, http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	c := New(server.URL, WithMaxRetries(3), WithRetryWait(retryWait))
+	_, err := c.Health(context.Background())
+
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("error = %v, want a 503 *Error", err)
+	}
+	if len(times) != 4 {
+		t.Fatalf("sent %d requests, want 1 and 3 retries", len(times))
+	}
+	for i := 1; i < len(times); i++ {
+		want := retryWait << (i - 1)
+		if wait := times[i].Sub(times[i-1]); wait < want {
+			t.Errorf("retry %d came after %s, want at least %s", i, wait, want)
+		}
+	}
+}
+
+func TestNoRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		maxRetries int
+	}{
+		{name: "not found", status: http.StatusNotFound, maxRetries: 3},
+		{name: "server error", status: http.StatusInternalServerError, maxRetries: 3},
+		{name: "retries disabled", status: http.StatusTooManyRequests, maxRetries: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				writeProblem(w, tt.status)
+			}))
+			defer server.Close()
+
+			c := New(server.URL, WithMaxRetries(tt.maxRetries), WithRetryWait(time.Millisecond))
+			_, err := c.GetProduct(context.Background(), 1)
+			if err == nil {
+				t.Fatal("no error")
+			}
+			if requests != 1 {
+				t.Errorf("sent %d requests, want 1", requests)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeyReusedAcrossRetries(t *testing.T) {
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if len(keys) < 3 {
+			writeProblem(w, http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, http.StatusCreated, `{"product":{"product_id":7,"name":"Lamp"}}`)
+	}))
+	defer server.Close()
+
+	c := New(server.URL, WithRetryWait(time.Millisecond))
+	product, err := c.CreateProduct(context.Background(), ProductInput{Name: "Lamp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.ProductID != 7 {
+		t.Errorf("product ID = %d, want 7", product.ProductID)
+	}
+
+	if len(keys) != 3 || keys[0] == "" {
+		t.Fatalf("keys = %q, want 3 requests carrying a key", keys)
+	}
+	for _, key := range keys[1:] {
+		if key != keys[0] {
+			t.Errorf("keys = %q, want the same key on every attempt", keys)
+		}
+	}
+
+	// Another create is another operation, so it gets a key of its own.
+	_, err = c.CreateProduct(context.Background(), ProductInput{Name: "Lamp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys[3] == keys[0] {
+		t.Errorf("a second create reused the key %q", keys[0])
+	}
+}
+
+func TestIdempotencyKeyOnlyOnPost(t *testing.T) {
+	var key string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key = r.Header.Get("Idempotency-Key")
+		writeJSON(w, http.StatusOK, `{"product":{"product_id":1}}`)
+	}))
+	defer server.Close()
+
+	name := "Lamp"
+	_, err := New(server.URL).UpdateProduct(context.Background(), 1, ProductUpdate{Name: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		t.Errorf("PATCH sent Idempotency-Key %q", key)
+	}
+}
+
+func TestTraceparentPropagated(t *testing.T) {
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get(tracing.TraceparentHeader)
+		writeJSON(w, http.StatusOK, `{"product":{"product_id":1}}`)
+	}))
+	defer server.Close()
+
+	c := New(server.URL)
+	if _, err := c.GetProduct(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if header != "" {
+		t.Errorf("untraced request sent traceparent %q", header)
+	}
+
+	ctx, span := tracing.NewTracer(nil).StartRoot(context.Background(), "test", tracing.KindInternal, tracing.SpanContext{})
+	if _, err := c.GetProduct(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if want := span.SpanContext().Traceparent(); header != want {
+		t.Errorf("traceparent = %q, want %q", header, want)
+	}
+	if sc, ok := tracing.ParseTraceparent(header); !ok || sc != span.SpanContext() {
+		t.Errorf("traceparent %q doesn't parse back to the span", header)
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	sentinels := []error{ErrNotFound, ErrConflict, ErrValidation, ErrRateLimited}
+	tests := []struct {
+		status int
+		want   error // nil when no sentinel matches
+	}{
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusConflict, ErrConflict},
+		{http.StatusUnprocessableEntity, ErrValidation},
+		{http.StatusTooManyRequests, ErrRateLimited},
+		{http.StatusBadRequest, nil},
+		{http.StatusInternalServerError, nil},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				writeProblem(w, tt.status)
+			}))
+			defer server.Close()
+
+			_, err := New(server.URL, WithMaxRetries(0)).GetReview(context.Background(), 1)
+			var apiErr *Error
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error = %v, want an *Error", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Code != "scripted" {
+				t.Errorf("error = %+v, want the problem details of a %d", apiErr, tt.status)
+			}
+			for _, sentinel := range sentinels {
+				if got := errors.Is(err, sentinel); got != (sentinel == tt.want) {
+					t.Errorf("errors.Is(err, %v) = %t", sentinel, got)
+				}
+			}
+		})
+	}
+}
+
+func TestEnvelopeKeys(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/products/3":
+			writeJSON(w, http.StatusOK, `{"product":{"product_id":3,"name":"Desk"}}`)
+		case "/v2/products":
+			writeJSON(w, http.StatusOK, `{"products":[{"product_id":3},{"product_id":4}],"metadata":{"current_page":1,"last_page":2,"total_records":4}}`)
+		default:
+			writeProblem(w, http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	c := New(server.URL)
+
+	product, err := c.GetProduct(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.ProductID != 3 || product.Name != "Desk" {
+		t.Errorf("product = %+v, want product 3", product)
+	}
+
+	products, metadata, err := c.ListProducts(context.Background(), ProductFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 2 || products[1].ProductID != 4 {
+		t.Errorf("products = %v, want products 3 and 4", products)
+	}
+	if metadata.LastPage != 2 || metadata.TotalRecords != 4 {
+		t.Errorf("metadata = %+v, want 2 pages of 4 records", metadata)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"", 0, 0},
+		{"3", 3 * time.Second, 3 * time.Second},
+		{"soon", 0, 0},
+		{time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), 8 * time.Second, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got < tt.min || got > tt.max {
+			t.Errorf("parseRetryAfter(%q) = %s, want between %s and %s", tt.value, got, tt.min, tt.max)
+		}
+	}
+}
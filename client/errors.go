@@ -0,0 +1,84 @@
+// Filename: client/errors.go
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Errors for the statuses callers usually handle. Every error response is
+// an *Error, which matches the sentinel for its status with errors.Is.
+var (
+	ErrNotFound    = errors.New("client: not found")
+	ErrConflict    = errors.New("client: conflict")
+	ErrValidation  = errors.New("client: validation failed")
+	ErrRateLimited = errors.New("client: rate limit exceeded")
+)
+
+// Error is an error response from the API, which sends RFC 7807 problem
+// details.
+type Error struct {
+	StatusCode int          `json:"status"`
+	Type       string       `json:"type"`
+	Title      string       `json:"title"`
+	Detail     string       `json:"detail"`
+	Code       string       `json:"code"` // stable identifier of the kind of failure
+	Errors     []FieldError `json:"errors"`
+
+	// RetryAfter is how long the server asked the client to wait before
+	// trying again, if it did.
+	RetryAfter time.Duration `json:"-"`
+}
+
+// FieldError is a validation failure of one field of the request.
+type FieldError struct {
+	Field  string         `json:"field"`
+	Code   string         `json:"code"`
+	Detail string         `json:"detail"`
+	Params map[string]any `json:"params"`
+}
+
+func (e *Error) Error() string {
+	message := fmt.Sprintf("client: %d %s", e.StatusCode, e.Title)
+	if e.Detail != "" {
+		message += ": " + e.Detail
+	}
+	for _, fieldError := range e.Errors {
+		message += fmt.Sprintf("; %s %s", fieldError.Field, fieldError.Detail)
+	}
+	return message
+}
+
+// Is matches the sentinel error for the status of e.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrValidation:
+		return e.StatusCode == http.StatusUnprocessableEntity
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// readError builds the Error for an unsuccessful response. Bodies that
+// aren't problem details still give an Error with the status.
+func readError(res *http.Response) *Error {
+	apiErr := &Error{}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	_ = json.Unmarshal(body, apiErr)
+
+	apiErr.StatusCode = res.StatusCode
+	if apiErr.Title == "" {
+		apiErr.Title = http.StatusText(res.StatusCode)
+	}
+	apiErr.RetryAfter = parseRetryAfter(res.Header.Get("Retry-After"))
+	return apiErr
+}
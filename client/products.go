@@ -0,0 +1,149 @@
+// Filename: client/products.go
+package client
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+)
+
+// ProductInput is a new product.
+type ProductInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	ImageURL    string `json:"image_url"`
+	Price       string `json:"price,omitempty"`
+}
+
+// ProductUpdate changes the fields of a product that are set.
+type ProductUpdate struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Category    *string `json:"category,omitempty"`
+	ImageURL    *string `json:"image_url,omitempty"`
+	Price       *string `json:"price,omitempty"`
+}
+
+// ProductFilter narrows and orders a product list. Zero values leave the
+// server's defaults.
+type ProductFilter struct {
+	Name     string // full-text search on the name
+	Category string // full-text search on the category
+	Page     int
+	PageSize int
+	Sort     string // product_id, name, -product_id or -name
+	Locale   string // translation to read, e.g. es
+}
+
+func (f ProductFilter) query() url.Values {
+	query := url.Values{}
+	if f.Name != "" {
+		query.Set("name", f.Name)
+	}
+	if f.Category != "" {
+		query.Set("category", f.Category)
+	}
+	if f.Locale != "" {
+		query.Set("locale", f.Locale)
+	}
+	pageQuery(query, f.Page, f.PageSize, f.Sort)
+	return query
+}
+
+// GetProduct fetches a product.
+func (c *Client) GetProduct(ctx context.Context, id int64) (*Product, error) {
+	var envelope struct {
+		Product *Product `json:"product"`
+	}
+	err := c.do(ctx, request{method: http.MethodGet, path: fmt.Sprintf("/products/%d", id)}, &envelope)
+	if err != nil {
+		return nil, err
+	}
+	return envelope.Product, nil
+}
+
+// CreateProduct adds a product.
+func (c *Client) CreateProduct(ctx context.Context, input ProductInput) (*Product, error) {
+	var envelope struct {
+		Product *Product `json:"product"`
+	}
+	err := c.do(ctx, request{method: http.MethodPost, path: "/products", body: input}, &envelope)
+	if err != nil {
+		return nil, err
+	}
+	return envelope.Product, nil
+}
+
+// UpdateProduct changes a product and returns it as updated.
+func (c *Client) UpdateProduct(ctx context.Context, id int64, update ProductUpdate) (*Product, error) {
+	var envelope struct {
+		Product *Product `json:"product"`
+	}
+	err := c.do(ctx, request{
+		method:      http.MethodPatch,
+		path:        fmt.Sprintf("/products/%d", id),
+		body:        update,
+		contentType: "application/merge-patch+json",
+	}, &envelope)
+	if err != nil {
+		return nil, err
+	}
+	return envelope.Product, nil
+}
+
+// DeleteProduct deletes a product.
+func (c *Client) DeleteProduct(ctx context.Context, id int64) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: fmt.Sprintf("/products/%d", id)}, nil)
+}
+
+// ListProducts fetches one page of products.
+func (c *Client) ListProducts(ctx context.Context, filter ProductFilter) ([]*Product, Metadata, error) {
+	var envelope struct {
+		Products []*Product `json:"products"`
+		Metadata Metadata   `json:"metadata"`
+	}
+	err := c.do(ctx, request{method: http.MethodGet, path: "/products", query: filter.query()}, &envelope)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	return envelope.Products, envelope.Metadata, nil
+}
+
+// Products iterates over every product matching filter, starting at
+// filter.Page and fetching the following pages as needed. Iteration stops
+// after the first error.
+func (c *Client) Products(ctx context.Context, filter ProductFilter) iter.Seq2[*Product, error] {
+	return paginate(func(page int) ([]*Product, Metadata, error) {
+		filter.Page = page
+		return c.ListProducts(ctx, filter)
+	}, filter.Page)
+}
+
+// paginate walks the pages of a list until the last one.
+func paginate[T any](fetch func(page int) ([]T, Metadata, error), firstPage int) iter.Seq2[T, error] {
+	if firstPage < 1 {
+		firstPage = 1
+	}
+	return func(yield func(T, error) bool) {
+		for page := firstPage; ; {
+			items, metadata, err := fetch(page)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			if len(items) == 0 || page >= metadata.LastPage {
+				return
+			}
+			page++
+		}
+	}
+}
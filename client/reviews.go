@@ -0,0 +1,136 @@
+// Filename: client/reviews.go
+package client
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+)
+
+// ReviewInput is a new review of a product.
+type ReviewInput struct {
+	ProductID  int64  `json:"product_id"`
+	Author     string `json:"author"`
+	Rating     int64  `json:"rating"` // 1 to 5
+	ReviewText string `json:"review_text"`
+}
+
+// ReviewUpdate changes the fields of a review that are set.
+type ReviewUpdate struct {
+	Author     *string `json:"author,omitempty"`
+	Rating     *int64  `json:"rating,omitempty"`
+	ReviewText *string `json:"review_text,omitempty"`
+}
+
+// ReviewFilter narrows and orders a review list. Zero values leave the
+// server's defaults.
+type ReviewFilter struct {
+	Author   string // full-text search on the author
+	Page     int
+	PageSize int
+	Sort     string // review_id, author, -review_id or -author
+}
+
+func (f ReviewFilter) query() url.Values {
+	query := url.Values{}
+	if f.Author != "" {
+		query.Set("author", f.Author)
+	}
+	pageQuery(query, f.Page, f.PageSize, f.Sort)
+	return query
+}
+
+// GetReview fetches a review.
+func (c *Client) GetReview(ctx context.Context, id int64) (*Review, error) {
+	var envelope struct {
+		Review *Review `json:"review"`
+	}
+	err := c.do(ctx, request{method: http.MethodGet, path: fmt.Sprintf("/reviews/%d", id)}, &envelope)
+	if err != nil {
+		return nil, err
+	}
+	return envelope.Review, nil
+}
+
+// CreateReview adds a review to a product.
+func (c *Client) CreateReview(ctx context.Context, input ReviewInput) (*Review, error) {
+	var envelope struct {
+		Review *Review `json:"review"`
+	}
+	err := c.do(ctx, request{method: http.MethodPost, path: "/reviews", body: input}, &envelope)
+	if err != nil {
+		return nil, err
+	}
+	return envelope.Review, nil
+}
+
+// UpdateReview changes a review and returns it as updated.
+func (c *Client) UpdateReview(ctx context.Context, id int64, update ReviewUpdate) (*Review, error) {
+	var envelope struct {
+		Review *Review `json:"review"`
+	}
+	err := c.do(ctx, request{
+		method:      http.MethodPatch,
+		path:        fmt.Sprintf("/reviews/%d", id),
+		body:        update,
+		contentType: "application/merge-patch+json",
+	}, &envelope)
+	if err != nil {
+		return nil, err
+	}
+	return envelope.Review, nil
+}
+
+// DeleteReview deletes a review.
+func (c *Client) DeleteReview(ctx context.Context, id int64) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: fmt.Sprintf("/reviews/%d", id)}, nil)
+}
+
+// MarkReviewHelpful adds one to the helpful count of a review.
+func (c *Client) MarkReviewHelpful(ctx context.Context, id int64) (*Review, error) {
+	var envelope struct {
+		Review *Review `json:"review"`
+	}
+	err := c.do(ctx, request{method: http.MethodPatch, path: fmt.Sprintf("/reviews/%d/helpful", id)}, &envelope)
+	if err != nil {
+		return nil, err
+	}
+	return envelope.Review, nil
+}
+
+// ListReviews fetches one page of reviews.
+func (c *Client) ListReviews(ctx context.Context, filter ReviewFilter) ([]*Review, Metadata, error) {
+	var envelope struct {
+		Reviews  []*Review `json:"reviews"`
+		Metadata Metadata  `json:"metadata"`
+	}
+	err := c.do(ctx, request{method: http.MethodGet, path: "/reviews", query: filter.query()}, &envelope)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	return envelope.Reviews, envelope.Metadata, nil
+}
+
+// Reviews iterates over every review matching filter, starting at
+// filter.Page and fetching the following pages as needed. Iteration stops
+// after the first error.
+func (c *Client) Reviews(ctx context.Context, filter ReviewFilter) iter.Seq2[*Review, error] {
+	return paginate(func(page int) ([]*Review, Metadata, error) {
+		filter.Page = page
+		return c.ListReviews(ctx, filter)
+	}, filter.Page)
+}
+
+// ListProductReviews fetches all the reviews of a product.
+func (c *Client) ListProductReviews(ctx context.Context, productID int64) ([]*Review, error) {
+	var envelope struct {
+		Reviews []*Review `json:"reviews"`
+	}
+	err := c.do(ctx, request{method: http.MethodGet, path: fmt.Sprintf("/products/%d/reviews", productID)}, &envelope)
+	if err != nil {
+		return nil, err
+	}
+	return envelope.Reviews, nil
+}
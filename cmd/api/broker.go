@@ -0,0 +1,162 @@
+// Filename: cmd/api/broker.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// brokerEvent is a single event published by the handlers.
+type brokerEvent struct {
+	ID        uint64
+	Type      string
+	ProductID int64
+	Data      []byte
+}
+
+type subscriber struct {
+	productID int64 // 0 means every product
+	events    chan brokerEvent
+}
+
+// eventBroker fans review events out to the live streams. It keeps a short
+// history so that a client reconnecting with Last-Event-ID can catch up on
+// what it missed.
+type eventBroker struct {
+	mu          sync.Mutex
+	nextID      uint64
+	history     []brokerEvent
+	subscribers map[*subscriber]struct{}
+	closed      bool
+}
+
+const brokerHistorySize = 512
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{
+		// Event IDs start from the current time so they keep increasing
+		// across restarts and a stale Last-Event-ID doesn't replay anything.
+		nextID:      uint64(time.Now().UnixMilli()),
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+// streamedEvent reports whether events of eventType go out on the streams.
+// Only review events do; the others would push them out of the history
+// without any stream wanting them.
+func streamedEvent(eventType string) bool {
+	return strings.HasPrefix(eventType, "review.")
+}
+
+func (b *eventBroker) publish(eventType string, productID int64, data []byte) {
+	if !streamedEvent(eventType) {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.nextID++
+	event := brokerEvent{ID: b.nextID, Type: eventType, ProductID: productID, Data: data}
+
+	b.history = append(b.history, event)
+	if len(b.history) > brokerHistorySize {
+		b.history = b.history[len(b.history)-brokerHistorySize:]
+	}
+
+	for s := range b.subscribers {
+		if s.productID != 0 && s.productID != productID {
+			continue
+		}
+		select {
+		case s.events <- event:
+		default:
+			// The client isn't keeping up; drop it rather than block
+			// every handler that publishes. It can resume with
+			// Last-Event-ID.
+			delete(b.subscribers, s)
+			close(s.events)
+		}
+	}
+}
+
+// subscribe registers a new stream. The returned backlog holds the events
+// published after lastEventID that are still in the history.
+func (b *eventBroker) subscribe(productID int64, lastEventID uint64) (*subscriber, []brokerEvent, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, nil, false
+	}
+
+	var backlog []brokerEvent
+	if lastEventID != 0 {
+		for _, event := range b.history {
+			if event.ID <= lastEventID {
+				continue
+			}
+			if productID != 0 && event.ProductID != productID {
+				continue
+			}
+			backlog = append(backlog, event)
+		}
+	}
+
+	s := &subscriber{productID: productID, events: make(chan brokerEvent, 64)}
+	b.subscribers[s] = struct{}{}
+
+	return s, backlog, true
+}
+
+func (b *eventBroker) unsubscribe(s *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, found := b.subscribers[s]
+	if found {
+		delete(b.subscribers, s)
+		close(s.events)
+	}
+}
+
+// close ends every open stream. It is called when the server starts
+// shutting down, since http.Server.Shutdown would otherwise wait on the
+// streams until it times out.
+func (b *eventBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for s := range b.subscribers {
+		delete(b.subscribers, s)
+		close(s.events)
+	}
+}
+
+// publishEvent fans an event out to the live streams and the webhook
+// subscriptions. Failing to record the webhook deliveries is logged but does
+// not fail the request that triggered the event, ctx is its context.
+func (a *applicationDependencies) publishEvent(ctx context.Context, event string, productID int64, payload any) {
+	js, err := json.Marshal(payload)
+	if err != nil {
+		a.logger.ErrorContext(ctx, "encoding event failed", "event", event, "error", err.Error())
+		return
+	}
+
+	a.events.publish(event, productID, js)
+
+	// The change has been made, so the deliveries are recorded even if the
+	// client has gone away.
+	err = a.webhookModel.EnqueueDeliveries(context.WithoutCancel(ctx), event, js)
+	if err != nil {
+		a.logger.ErrorContext(ctx, "enqueueing webhook deliveries failed", "event", event, "error", err.Error())
+	}
+}
@@ -0,0 +1,62 @@
+// Filename: cmd/api/broker_test.go
+package main
+
+import "testing"
+
+// TestBrokerHistory checks that a client resuming a review stream catches
+// up on the review events it missed, however many product events were
+// published meanwhile.
+func TestBrokerHistory(t *testing.T) {
+	b := newEventBroker()
+
+	s, _, _ := b.subscribe(0, 0)
+	b.publish("review.created", 1, []byte(`{"review_id":1}`))
+	last := (<-s.events).ID
+	b.unsubscribe(s)
+
+	b.publish("review.created", 2, []byte(`{"review_id":2}`))
+	for i := 0; i < 2*brokerHistorySize; i++ {
+		b.publish("product.updated", 1, []byte(`{"product_id":1}`))
+	}
+	b.publish("review.deleted", 1, []byte(`{"review_id":1}`))
+
+	tests := []struct {
+		name      string
+		productID int64
+		want      []string
+	}{
+		{name: "every product", want: []string{"review.created", "review.deleted"}},
+		{name: "one product", productID: 1, want: []string{"review.deleted"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, backlog, ok := b.subscribe(tt.productID, last)
+			if !ok {
+				t.Fatal("the broker is closed")
+			}
+			defer b.unsubscribe(s)
+
+			var got []string
+			for _, event := range backlog {
+				got = append(got, event.Type)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("backlog = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("backlog = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	// Product events don't reach the streams either.
+	s, _, _ = b.subscribe(0, 0)
+	defer b.unsubscribe(s)
+	b.publish("product.created", 3, []byte(`{"product_id":3}`))
+	b.publish("review.created", 3, []byte(`{"review_id":3}`))
+	if event := <-s.events; event.Type != "review.created" {
+		t.Errorf("streamed %s, want review.created", event.Type)
+	}
+}
@@ -0,0 +1,490 @@
+// Filename: cmd/api/bulk.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mtechguy/test2/internal/data"
+	"github.com/mtechguy/test2/internal/i18n"
+	"github.com/mtechguy/test2/internal/validator"
+)
+
+const (
+	bulkMaxOperations = 1000
+	bulkMaxBytes      = 8_000_000
+)
+
+// Bulk execution modes.
+const (
+	bulkModeAtomic  = "atomic"
+	bulkModePerItem = "per_item"
+)
+
+type bulkRequest struct {
+	Mode       string `json:"mode"`
+	Operations []struct {
+		Op   string          `json:"op"`
+		ID   int64           `json:"id"`
+		Data json.RawMessage `json:"data"`
+	} `json:"operations"`
+}
+
+// bulkResult is the outcome of one operation, reported by its index in the
+// request. A failure of the operation as a whole has a Code, and Error is
+// its message in the client's language; invalid fields are in Errors.
+type bulkResult struct {
+	Index   int                          `json:"index"`
+	Op      string                       `json:"op"`
+	Status  int                          `json:"status"`
+	Product *data.Product                `json:"product,omitempty"`
+	Review  *data.Review                 `json:"review,omitempty"`
+	Code    string                       `json:"code,omitempty"`
+	Params  map[string]any               `json:"params,omitempty"`
+	Error   string                       `json:"error,omitempty"`
+	Errors  map[string][]validator.Error `json:"errors,omitempty"`
+}
+
+func (res *bulkResult) ok() bool {
+	return res.Status < 300
+}
+
+// fail records why the operation failed. The message is filled in by
+// writeBulkResponse.
+func (res *bulkResult) fail(status int, detail validator.Error) {
+	res.Status = status
+	res.Code = detail.Code
+	res.Params = detail.Params
+}
+
+// decodeOperationData decodes the data of a single operation with the same
+// strictness as readJSON.
+func decodeOperationData(raw json.RawMessage, destination any) *requestError {
+	if len(raw) == 0 {
+		return newRequestError("data_missing")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(destination)
+	if err != nil {
+		var unmarshalTypeError *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+			return newRequestError("data_field_type", "field", unmarshalTypeError.Field)
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			if unquoted, err := strconv.Unquote(fieldName); err == nil {
+				fieldName = unquoted
+			}
+			return newRequestError("data_unknown_field", "field", fieldName)
+		default:
+			return newRequestError("data_invalid")
+		}
+	}
+	return nil
+}
+
+// readBulkRequest reads and checks the envelope shared by the bulk endpoints.
+func (a *applicationDependencies) readBulkRequest(w http.ResponseWriter, r *http.Request) (*bulkRequest, bool) {
+	var input bulkRequest
+	err := a.readJSONWithLimit(w, r, &input, bulkMaxBytes)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	if input.Mode == "" {
+		input.Mode = bulkModeAtomic
+	}
+
+	v := validator.New()
+	v.Check(validator.PermittedValue(input.Mode, bulkModeAtomic, bulkModePerItem), "mode", "one_of", "values", "atomic, per_item")
+	v.Check(len(input.Operations) > 0, "operations", "min_items", "min", 1)
+	v.Check(len(input.Operations) <= bulkMaxOperations, "operations", "max_items", "max", bulkMaxOperations)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return nil, false
+	}
+
+	// A large batch takes longer than the server's WriteTimeout allows. The
+	// response gets as long as the operations may run, and as long again
+	// for the lookups that validate them.
+	err = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(2 * data.BulkTimeout(len(input.Operations))))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	return &input, true
+}
+
+// writeBulkResponse merges the outcome of the executed operations into the
+// results and sends them. Atomic requests that didn't commit get a 422.
+func (a *applicationDependencies) writeBulkResponse(w http.ResponseWriter, r *http.Request, mode string, results []*bulkResult) {
+	language := requestLanguage(r)
+	succeeded := 0
+	for _, res := range results {
+		if res.ok() {
+			succeeded++
+		}
+		if res.Code != "" {
+			res.Error = i18n.Translate(language, res.Code, res.Params)
+		}
+		localizeErrors(r, res.Errors)
+	}
+
+	status := http.StatusOK
+	committed := succeeded > 0
+	if mode == bulkModeAtomic && succeeded != len(results) {
+		status = http.StatusUnprocessableEntity
+		committed = false
+	}
+
+	w.Header().Add("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", language)
+	data := envelope{
+		"mode":      mode,
+		"committed": committed,
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+		"results":   results,
+	}
+	err := a.writeResponse(w, r, status, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// applyExecutionResult records what happened when an operation that passed
+// validation was executed.
+func (a *applicationDependencies) applyExecutionResult(r *http.Request, res *bulkResult, err error, successStatus int) {
+	switch {
+	case err == nil:
+		res.Status = successStatus
+	case errors.Is(err, data.ErrRolledBack):
+		res.fail(http.StatusConflict, validator.NewError("operation_rolled_back"))
+	case errors.Is(err, data.ErrRecordNotFound):
+		res.fail(http.StatusNotFound, validator.NewError("not_found"))
+	default:
+		a.logError(r, err)
+		res.fail(http.StatusInternalServerError, validator.NewError("operation_failed"))
+	}
+}
+
+func (a *applicationDependencies) bulkProductHandler(w http.ResponseWriter, r *http.Request) {
+	input, ok := a.readBulkRequest(w, r)
+	if !ok {
+		return
+	}
+
+	results := make([]*bulkResult, len(input.Operations))
+	ops := make([]data.ProductOperation, 0, len(input.Operations))
+	opIndex := make([]int, 0, len(input.Operations))
+
+	// Validate every operation before anything is written.
+	for i, item := range input.Operations {
+		res := &bulkResult{Index: i, Op: item.Op}
+		results[i] = res
+
+		op, err := a.prepareProductOperation(r.Context(), item.Op, item.ID, item.Data, res)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		if res.Status != 0 {
+			continue
+		}
+		ops = append(ops, op)
+		opIndex = append(opIndex, i)
+	}
+
+	// In atomic mode a single invalid operation means nothing is written.
+	if input.Mode == bulkModeAtomic && len(ops) != len(input.Operations) {
+		for _, i := range opIndex {
+			results[i].fail(http.StatusConflict, validator.NewError("operation_not_executed"))
+		}
+		a.writeBulkResponse(w, r, input.Mode, results)
+		return
+	}
+
+	outcomes, err := a.productModel.BulkProducts(r.Context(), ops, input.Mode == bulkModeAtomic)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for j, outcome := range outcomes {
+		res := results[opIndex[j]]
+		op := ops[j]
+
+		successStatus := http.StatusOK
+		if op.Op == data.BulkCreate {
+			successStatus = http.StatusCreated
+		}
+		a.applyExecutionResult(r, res, outcome, successStatus)
+		if !res.ok() {
+			continue
+		}
+
+		switch op.Op {
+		case data.BulkCreate:
+			res.Product = op.Product
+			a.publishEvent(r.Context(), data.EventProductCreated, op.Product.ProductID, op.Product)
+		case data.BulkUpdate:
+			res.Product = op.Product
+			a.publishEvent(r.Context(), data.EventProductUpdated, op.Product.ProductID, op.Product)
+		case data.BulkDelete:
+			a.publishEvent(r.Context(), data.EventProductDeleted, op.ID, envelope{"product_id": op.ID})
+		}
+	}
+
+	a.writeBulkResponse(w, r, input.Mode, results)
+}
+
+// prepareProductOperation turns one requested operation into a validated
+// data.ProductOperation. Problems with the operation itself are written to
+// res; the returned error is only for failures on our side.
+func (a *applicationDependencies) prepareProductOperation(ctx context.Context, opName string, id int64, raw json.RawMessage, res *bulkResult) (data.ProductOperation, error) {
+	op := data.ProductOperation{Op: opName, ID: id}
+
+	var product *data.Product
+	switch opName {
+	case data.BulkCreate:
+		product = &data.Product{}
+	case data.BulkUpdate, data.BulkDelete:
+		if id < 1 {
+			res.Status = http.StatusUnprocessableEntity
+			res.Errors = map[string][]validator.Error{"id": {validator.NewError("positive")}}
+			return op, nil
+		}
+		if opName == data.BulkDelete {
+			return op, nil
+		}
+		existing, err := a.productModel.GetProduct(ctx, id)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				res.fail(http.StatusNotFound, validator.NewError("product_not_found", "id", id))
+				return op, nil
+			}
+			return op, err
+		}
+		product = existing
+	default:
+		res.Status = http.StatusUnprocessableEntity
+		res.Errors = map[string][]validator.Error{"op": {validator.NewError("one_of", "values", "create, update, delete")}}
+		return op, nil
+	}
+
+	var incomingProductData struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		Category    *string `json:"category"`
+		ImageURL    *string `json:"image_url"`
+		Price       *string `json:"price"`
+	}
+	if re := decodeOperationData(raw, &incomingProductData); re != nil {
+		res.fail(http.StatusBadRequest, re.detail)
+		return op, nil
+	}
+
+	if incomingProductData.Name != nil {
+		product.Name = *incomingProductData.Name
+	}
+	if incomingProductData.Description != nil {
+		product.Description = *incomingProductData.Description
+	}
+	if incomingProductData.Category != nil {
+		product.Category = *incomingProductData.Category
+	}
+	if incomingProductData.ImageURL != nil {
+		product.ImageURL = *incomingProductData.ImageURL
+	}
+	if incomingProductData.Price != nil {
+		product.Price = *incomingProductData.Price
+	}
+
+	v := validator.New()
+	data.ValidateProduct(v, product)
+	if !v.IsEmpty() {
+		res.Status = http.StatusUnprocessableEntity
+		res.Errors = v.Errors
+		return op, nil
+	}
+
+	op.Product = product
+	return op, nil
+}
+
+func (a *applicationDependencies) bulkReviewHandler(w http.ResponseWriter, r *http.Request) {
+	input, ok := a.readBulkRequest(w, r)
+	if !ok {
+		return
+	}
+
+	results := make([]*bulkResult, len(input.Operations))
+	ops := make([]data.ReviewOperation, 0, len(input.Operations))
+	opIndex := make([]int, 0, len(input.Operations))
+
+	// Deletes need the product of the review for their event.
+	deletedProduct := make(map[int64]int64)
+
+	for i, item := range input.Operations {
+		res := &bulkResult{Index: i, Op: item.Op}
+		results[i] = res
+
+		op, err := a.prepareReviewOperation(r.Context(), item.Op, item.ID, item.Data, res, deletedProduct)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		if res.Status != 0 {
+			continue
+		}
+		ops = append(ops, op)
+		opIndex = append(opIndex, i)
+	}
+
+	if input.Mode == bulkModeAtomic && len(ops) != len(input.Operations) {
+		for _, i := range opIndex {
+			results[i].fail(http.StatusConflict, validator.NewError("operation_not_executed"))
+		}
+		a.writeBulkResponse(w, r, input.Mode, results)
+		return
+	}
+
+	outcomes, err := a.reviewModel.BulkReviews(r.Context(), ops, input.Mode == bulkModeAtomic)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for j, outcome := range outcomes {
+		res := results[opIndex[j]]
+		op := ops[j]
+
+		successStatus := http.StatusOK
+		if op.Op == data.BulkCreate {
+			successStatus = http.StatusCreated
+		}
+		a.applyExecutionResult(r, res, outcome, successStatus)
+		if !res.ok() {
+			continue
+		}
+
+		switch op.Op {
+		case data.BulkCreate:
+			res.Review = op.Review
+			a.publishEvent(r.Context(), data.EventReviewCreated, op.Review.ProductID, op.Review)
+			a.recountRating(r.Context(), op.Review.ProductID)
+		case data.BulkUpdate:
+			res.Review = op.Review
+			a.publishEvent(r.Context(), data.EventReviewUpdated, op.Review.ProductID, op.Review)
+			a.recountRating(r.Context(), op.Review.ProductID)
+		case data.BulkDelete:
+			productID := deletedProduct[op.ID]
+			a.publishEvent(r.Context(), data.EventReviewDeleted, productID, envelope{"review_id": op.ID, "product_id": productID})
+			a.recountRating(r.Context(), productID)
+		}
+	}
+
+	a.writeBulkResponse(w, r, input.Mode, results)
+}
+
+// prepareReviewOperation is the review counterpart of
+// prepareProductOperation.
+func (a *applicationDependencies) prepareReviewOperation(ctx context.Context, opName string, id int64, raw json.RawMessage, res *bulkResult, deletedProduct map[int64]int64) (data.ReviewOperation, error) {
+	op := data.ReviewOperation{Op: opName, ID: id}
+
+	var review *data.Review
+	switch opName {
+	case data.BulkCreate:
+		review = &data.Review{}
+	case data.BulkUpdate, data.BulkDelete:
+		if id < 1 {
+			res.Status = http.StatusUnprocessableEntity
+			res.Errors = map[string][]validator.Error{"id": {validator.NewError("positive")}}
+			return op, nil
+		}
+		existing, err := a.reviewModel.GetReview(ctx, id)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				res.fail(http.StatusNotFound, validator.NewError("review_not_found", "id", id))
+				return op, nil
+			}
+			return op, err
+		}
+		if opName == data.BulkDelete {
+			deletedProduct[id] = existing.ProductID
+			return op, nil
+		}
+		review = existing
+	default:
+		res.Status = http.StatusUnprocessableEntity
+		res.Errors = map[string][]validator.Error{"op": {validator.NewError("one_of", "values", "create, update, delete")}}
+		return op, nil
+	}
+
+	var incomingReviewData struct {
+		ProductID    *int64  `json:"product_id"`
+		Author       *string `json:"author"`
+		Rating       *int64  `json:"rating"`
+		HelpfulCount *int32  `json:"helpful_count"`
+		ReviewText   *string `json:"review_text"`
+	}
+	if re := decodeOperationData(raw, &incomingReviewData); re != nil {
+		res.fail(http.StatusBadRequest, re.detail)
+		return op, nil
+	}
+
+	if opName == data.BulkCreate {
+		if incomingReviewData.ProductID != nil {
+			review.ProductID = *incomingReviewData.ProductID
+		}
+		if incomingReviewData.HelpfulCount != nil {
+			review.HelpfulCount = *incomingReviewData.HelpfulCount
+		}
+	} else if incomingReviewData.ProductID != nil || incomingReviewData.HelpfulCount != nil {
+		res.Status = http.StatusUnprocessableEntity
+		res.Errors = map[string][]validator.Error{"data": {validator.NewError("immutable_fields", "fields", "product_id, helpful_count")}}
+		return op, nil
+	}
+	if incomingReviewData.Author != nil {
+		review.Author = *incomingReviewData.Author
+	}
+	if incomingReviewData.Rating != nil {
+		review.Rating = *incomingReviewData.Rating
+	}
+	if incomingReviewData.ReviewText != nil {
+		review.ReviewText = *incomingReviewData.ReviewText
+	}
+
+	v := validator.New()
+	data.ValidateReview(v, review)
+	if !v.IsEmpty() {
+		res.Status = http.StatusUnprocessableEntity
+		res.Errors = v.Errors
+		return op, nil
+	}
+
+	if opName == data.BulkCreate {
+		exists, err := a.productModel.ProductExists(ctx, review.ProductID)
+		if err != nil {
+			return op, err
+		}
+		if !exists {
+			res.fail(http.StatusNotFound, validator.NewError("product_not_found", "id", review.ProductID))
+			return op, nil
+		}
+	}
+
+	op.Review = review
+	return op, nil
+}
@@ -0,0 +1,99 @@
+// Filename: cmd/api/bulk_test.go
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestBulkResultsTranslated sends an atomic batch that fails before
+// reaching the database, and checks each result is coded and its message
+// is in the client's language.
+func TestBulkResultsTranslated(t *testing.T) {
+	router, _ := newTestApplication(t).router()
+	// A real connection, as the handler sets a write deadline.
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	body := `{"operations": [
+		{"op": "create"},
+		{"op": "create", "data": {"name": 1}},
+		{"op": "create", "data": {"colour": "red"}},
+		{"op": "create", "data": [1]},
+		{"op": "update", "id": 0, "data": {}}
+	]}`
+
+	type result struct {
+		Code   string         `json:"code"`
+		Params map[string]any `json:"params"`
+		Error  string         `json:"error"`
+		Errors map[string][]struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	tests := []struct {
+		language string
+		want     []result
+	}{
+		{language: "en", want: []result{
+			{Code: "data_missing", Error: "data must be provided"},
+			{Code: "data_field_type", Params: map[string]any{"field": "name"}, Error: "data contains the incorrect JSON type for field name"},
+			{Code: "data_unknown_field", Params: map[string]any{"field": "colour"}, Error: "data contains unknown key colour"},
+			{Code: "data_invalid", Error: "data must be a JSON object"},
+		}},
+		{language: "es", want: []result{
+			{Code: "data_missing", Error: "se debe indicar data"},
+			{Code: "data_field_type", Params: map[string]any{"field": "name"}, Error: "data tiene un tipo JSON incorrecto para el campo name"},
+			{Code: "data_unknown_field", Params: map[string]any{"field": "colour"}, Error: "data contiene la clave desconocida colour"},
+			{Code: "data_invalid", Error: "data debe ser un objeto JSON"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.language, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodPost, server.URL+"/v1/product/bulk", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("Accept-Language", tt.language)
+			res, err := server.Client().Do(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d, want %d", res.StatusCode, http.StatusUnprocessableEntity)
+			}
+			if got := res.Header.Get("Content-Language"); got != tt.language {
+				t.Errorf("Content-Language = %q, want %q", got, tt.language)
+			}
+			var response struct {
+				Results []result `json:"results"`
+			}
+			if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if len(response.Results) != 5 {
+				t.Fatalf("got %d results, want 5", len(response.Results))
+			}
+
+			for i, want := range tt.want {
+				got := response.Results[i]
+				if got.Code != want.Code || !reflect.DeepEqual(got.Params, want.Params) || got.Error != want.Error {
+					t.Errorf("result %d = %+v, want %+v", i, got, want)
+				}
+			}
+			// Field errors are translated too.
+			id := response.Results[4].Errors["id"]
+			if len(id) != 1 || id[0].Code != "positive" || id[0].Message == "" {
+				t.Errorf("result 4 errors = %+v", response.Results[4].Errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+// Filename: cmd/api/client_test.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mtechguy/test2/client"
+)
+
+// The client package can't import the handler, so it is tested against
+// the real routes here.
+
+func TestClientErrors(t *testing.T) {
+	server := httptest.NewServer(newTestApplication(t).routes())
+	defer server.Close()
+	c := client.New(server.URL, client.WithMaxRetries(0))
+
+	_, err := c.GetProduct(testContext(t), 0)
+	if !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("GetProduct(0) error = %v, want ErrNotFound", err)
+	}
+
+	_, _, err = c.ListProducts(testContext(t), client.ProductFilter{Sort: "price"})
+	var apiErr *client.Error
+	if !errors.Is(err, client.ErrValidation) || !errors.As(err, &apiErr) {
+		t.Fatalf("ListProducts error = %v, want ErrValidation", err)
+	}
+	if len(apiErr.Errors) != 1 || apiErr.Errors[0].Field != "sort" {
+		t.Errorf("field errors = %+v, want one for sort", apiErr.Errors)
+	}
+}
+
+func TestClientRateLimited(t *testing.T) {
+	a := newTestApplication(t)
+	a.config.limiter.enabled = true
+	a.config.limiter.rps = 1
+	a.config.limiter.burst = 1
+	server := httptest.NewServer(a.routes())
+	defer server.Close()
+
+	_, err := client.New(server.URL).Health(testContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without retries the second request is turned away.
+	_, err = client.New(server.URL, client.WithMaxRetries(0)).Health(testContext(t))
+	var apiErr *client.Error
+	if !errors.Is(err, client.ErrRateLimited) || !errors.As(err, &apiErr) {
+		t.Fatalf("error = %v, want ErrRateLimited", err)
+	}
+	if apiErr.RetryAfter != time.Second {
+		t.Errorf("Retry-After = %s, want 1s", apiErr.RetryAfter)
+	}
+
+	// With them the client waits as long as Retry-After asks, rather than
+	// the much longer retry wait, and then gets through.
+	start := time.Now()
+	_, err = client.New(server.URL, client.WithRetryWait(time.Minute)).Health(testContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < 500*time.Millisecond || waited > 5*time.Second {
+		t.Errorf("waited %s, want about the 1s Retry-After asked for", waited)
+	}
+}
+
+// TestClientWithDatabase runs the client through the handlers that need
+// the database.
+func TestClientWithDatabase(t *testing.T) {
+	a := newTestDatabaseApplication(t)
+
+	// The first create's response is lost on the way back, as if the
+	// connection dropped, so the client retries it.
+	var mu sync.Mutex
+	var keys []string
+	handler := a.routes()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/v2/products" {
+			mu.Lock()
+			keys = append(keys, r.Header.Get("Idempotency-Key"))
+			lost := len(keys) == 1
+			mu.Unlock()
+			if lost {
+				handler.ServeHTTP(httptest.NewRecorder(), r)
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	c := client.New(server.URL, client.WithRetryWait(time.Millisecond))
+	ctx := testContext(t)
+
+	// The name is unique to the run, so the products it finds are its own.
+	name := fmt.Sprintf("clienttest%d", time.Now().UnixNano())
+	created, err := c.CreateProduct(ctx, client.ProductInput{
+		Name: name, Description: "Made by the client test", Category: "tests", ImageURL: "https://example.com/test.png",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Errorf("Idempotency-Key of each attempt = %q, want the same key twice", keys)
+	}
+	for range 4 {
+		_, err := c.CreateProduct(ctx, client.ProductInput{
+			Name: name, Description: "Made by the client test", Category: "tests", ImageURL: "https://example.com/test.png",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		for product, err := range c.Products(ctx, client.ProductFilter{Name: name}) {
+			if err == nil {
+				_ = c.DeleteProduct(ctx, product.ProductID)
+			}
+		}
+	})
+
+	// The product envelope.
+	product, err := c.GetProduct(ctx, created.ProductID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.ProductID != created.ProductID || product.Name != name {
+		t.Errorf("product = %+v, want %+v", product, created)
+	}
+
+	// The products and metadata envelope. The retried create was replayed
+	// rather than run twice, so there are five products on three pages.
+	products, metadata, err := c.ListProducts(ctx, client.ProductFilter{Name: name, PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 2 || metadata.TotalRecords != 5 || metadata.LastPage != 3 {
+		t.Errorf("first page = %d products, %+v, want 2 of 5 products on 3 pages", len(products), metadata)
+	}
+
+	// Iteration ends at the last page.
+	seen := 0
+	for _, err := range c.Products(ctx, client.ProductFilter{Name: name, PageSize: 2}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen++
+	}
+	if seen != 5 {
+		t.Errorf("iterated over %d products, want 5", seen)
+	}
+
+	err = c.DeleteProduct(ctx, created.ProductID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetProduct(ctx, created.ProductID)
+	if !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("GetProduct after delete error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,193 @@
+// Filename: cmd/api/config.go
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mtechguy/test2/internal/config"
+	"github.com/mtechguy/test2/internal/i18n"
+	"github.com/mtechguy/test2/internal/validator"
+)
+
+// envPrefix starts the environment variable of every setting, e.g.
+// PRODUCT_REVIEW_DB_DSN for -db-dsn.
+const envPrefix = "PRODUCT_REVIEW_"
+
+// loadConfig builds the configuration from the flag defaults, the file
+// given with -config, the environment and the command line, in increasing
+// order of precedence, and checks it.
+func loadConfig(args []string) (serverConfig, error) {
+	var setting serverConfig
+	var configFile string
+
+	flags := flag.NewFlagSet("api", flag.ContinueOnError)
+	flags.StringVar(&configFile, "config", "", "Path of a TOML config file")
+
+	flags.IntVar(&setting.port, "port", 4000, "Server port")
+	flags.StringVar(&setting.environment, "env", "development", "Environment (development|staging|production)")
+
+	flags.DurationVar(&setting.http.idleTimeout, "http-idle-timeout", time.Minute, "How long idle keep-alive connections stay open")
+	flags.DurationVar(&setting.http.readTimeout, "http-read-timeout", 5*time.Second, "Time allowed to read a request")
+	flags.DurationVar(&setting.http.writeTimeout, "http-write-timeout", 10*time.Second, "Time allowed to write a response")
+	flags.DurationVar(&setting.http.shutdownTimeout, "shutdown-timeout", 30*time.Second, "Time given to in-flight requests on shutdown")
+	flags.DurationVar(&setting.http.shutdownDelay, "shutdown-delay", 0, "Time /readyz fails before the server stops accepting requests, for load balancers to drain it")
+
+	flags.StringVar(&setting.db.dsn, "db-dsn", "", "PostgreSQL DSN")
+	flags.StringVar(&setting.db.dsnFile, "db-dsn-file", "", "File holding the PostgreSQL DSN, instead of -db-dsn")
+	flags.IntVar(&setting.db.maxOpenConns, "db-max-open-conns", 25, "Maximum open database connections (0 means unlimited)")
+	flags.IntVar(&setting.db.maxIdleConns, "db-max-idle-conns", 25, "Maximum idle database connections")
+	flags.DurationVar(&setting.db.maxIdleTime, "db-max-idle-time", 15*time.Minute, "How long a database connection may stay idle")
+	flags.DurationVar(&setting.db.maxLifetime, "db-max-lifetime", time.Hour, "How long a database connection may be reused (0 means forever)")
+	flags.DurationVar(&setting.db.statsInterval, "db-stats-interval", time.Minute, "How often database pool stats are logged (0 disables them)")
+
+	flags.Float64Var(&setting.limiter.rps, "limiter-rps", 2, "Rate Limiter maximum requests per second")
+	flags.IntVar(&setting.limiter.burst, "limiter-burst", 5, "Rate Limiter maximum burst")
+	flags.BoolVar(&setting.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+
+	flags.IntVar(&setting.webhook.maxAttempts, "webhook-max-attempts", 8, "Webhook delivery attempts before giving up")
+	flags.DurationVar(&setting.webhook.pollInterval, "webhook-poll-interval", 5*time.Second, "Webhook delivery poll interval")
+	flags.DurationVar(&setting.webhook.timeout, "webhook-timeout", 10*time.Second, "Webhook delivery request timeout")
+
+	flags.IntVar(&setting.jobs.workers, "jobs-workers", 4, "Number of background job workers")
+	flags.DurationVar(&setting.jobs.pollInterval, "jobs-poll-interval", time.Second, "Background job poll interval")
+
+	flags.DurationVar(&setting.idempotency.ttl, "idempotency-ttl", 24*time.Hour, "How long Idempotency-Key responses are kept")
+
+	flags.StringVar(&setting.trace.exporter, "trace-exporter", "none", "Where request traces are written (none|stdout|file)")
+	flags.StringVar(&setting.trace.file, "trace-file", "traces.jsonl", "File traces are appended to with -trace-exporter file")
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage of api:\n\nEvery flag can also be set in the -config file or with an environment\nvariable, e.g. %s for -db-dsn.\n\n", config.EnvName(envPrefix, "db-dsn"))
+		flags.PrintDefaults()
+	}
+
+	err := config.Load(flags, args, config.Options{EnvPrefix: envPrefix, FileFlag: "config"})
+	if err != nil {
+		return serverConfig{}, err
+	}
+
+	v := validator.New()
+	v.Check(setting.db.dsn == "" || setting.db.dsnFile == "", "db-dsn-file", "exclusive", "other", "-db-dsn")
+	if setting.db.dsnFile != "" && v.IsEmpty() {
+		setting.db.dsn, err = config.ReadSecret(setting.db.dsnFile)
+		if err != nil {
+			return serverConfig{}, fmt.Errorf("reading -db-dsn-file: %w", err)
+		}
+	}
+
+	validateConfig(v, setting)
+	if !v.IsEmpty() {
+		return serverConfig{}, configError(v)
+	}
+	return setting, nil
+}
+
+// validateConfig checks the settings that would otherwise only fail once
+// the server is running.
+func validateConfig(v *validator.Validator, setting serverConfig) {
+	v.Check(setting.port >= 1 && setting.port <= 65535, "port", "between", "min", 1, "max", 65535)
+	environments := []string{"development", "staging", "production"}
+	v.Check(validator.PermittedValue(setting.environment, environments...), "env", "one_of", "values", strings.Join(environments, ", "))
+
+	v.Check(setting.http.idleTimeout > 0, "http-idle-timeout", "positive")
+	v.Check(setting.http.readTimeout > 0, "http-read-timeout", "positive")
+	v.Check(setting.http.writeTimeout > 0, "http-write-timeout", "positive")
+	v.Check(setting.http.shutdownTimeout > 0, "shutdown-timeout", "positive")
+	v.Check(setting.http.shutdownDelay >= 0, "shutdown-delay", "min_value", "min", 0)
+
+	v.Check(setting.db.dsn != "", "db-dsn", "required")
+	v.Check(setting.db.maxOpenConns >= 0, "db-max-open-conns", "min_value", "min", 0)
+	v.Check(setting.db.maxIdleConns >= 0, "db-max-idle-conns", "min_value", "min", 0)
+	v.Check(setting.db.maxIdleTime >= 0, "db-max-idle-time", "min_value", "min", 0)
+	v.Check(setting.db.maxLifetime >= 0, "db-max-lifetime", "min_value", "min", 0)
+	v.Check(setting.db.statsInterval >= 0, "db-stats-interval", "min_value", "min", 0)
+
+	if setting.limiter.enabled {
+		v.Check(setting.limiter.rps > 0, "limiter-rps", "positive")
+		v.Check(setting.limiter.burst > 0, "limiter-burst", "positive")
+	}
+
+	v.Check(setting.webhook.maxAttempts > 0, "webhook-max-attempts", "positive")
+	v.Check(setting.webhook.pollInterval > 0, "webhook-poll-interval", "positive")
+	v.Check(setting.webhook.timeout > 0, "webhook-timeout", "positive")
+	v.Check(setting.jobs.workers > 0, "jobs-workers", "positive")
+	v.Check(setting.jobs.pollInterval > 0, "jobs-poll-interval", "positive")
+	v.Check(setting.idempotency.ttl > 0, "idempotency-ttl", "positive")
+
+	exporters := []string{"none", "stdout", "file"}
+	v.Check(validator.PermittedValue(setting.trace.exporter, exporters...), "trace-exporter", "one_of", "values", strings.Join(exporters, ", "))
+	if setting.trace.exporter == "file" {
+		v.Check(setting.trace.file != "", "trace-file", "required")
+	}
+}
+
+// configError lists the problems found in the configuration, one per
+// setting.
+func configError(v *validator.Validator) error {
+	var problems []string
+	for name, errs := range v.Errors {
+		for _, e := range errs {
+			problems = append(problems, fmt.Sprintf("-%s %s", name, i18n.Translate(i18n.DefaultLanguage, e.Code, e.Params)))
+		}
+	}
+	sort.Strings(problems)
+	return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+}
+
+// LogValue logs the configuration with the database password hidden, so
+// the settings the server runs with can be checked in its logs.
+func (c serverConfig) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("port", c.port),
+		slog.String("env", c.environment),
+		slog.Group("http",
+			slog.Duration("idle_timeout", c.http.idleTimeout),
+			slog.Duration("read_timeout", c.http.readTimeout),
+			slog.Duration("write_timeout", c.http.writeTimeout),
+			slog.Duration("shutdown_timeout", c.http.shutdownTimeout),
+			slog.Duration("shutdown_delay", c.http.shutdownDelay),
+		),
+		slog.Group("db",
+			slog.String("dsn", config.RedactDSN(c.db.dsn)),
+			slog.String("dsn_file", c.db.dsnFile),
+			slog.Int("max_open_conns", c.db.maxOpenConns),
+			slog.Int("max_idle_conns", c.db.maxIdleConns),
+			slog.Duration("max_idle_time", c.db.maxIdleTime),
+			slog.Duration("max_lifetime", c.db.maxLifetime),
+			slog.Duration("stats_interval", c.db.statsInterval),
+		),
+		slog.Group("limiter",
+			slog.Bool("enabled", c.limiter.enabled),
+			slog.Float64("rps", c.limiter.rps),
+			slog.Int("burst", c.limiter.burst),
+		),
+		slog.Group("webhook",
+			slog.Int("max_attempts", c.webhook.maxAttempts),
+			slog.Duration("poll_interval", c.webhook.pollInterval),
+			slog.Duration("timeout", c.webhook.timeout),
+		),
+		slog.Group("jobs",
+			slog.Int("workers", c.jobs.workers),
+			slog.Duration("poll_interval", c.jobs.pollInterval),
+		),
+		slog.Group("idempotency",
+			slog.Duration("ttl", c.idempotency.ttl),
+		),
+		slog.Group("trace",
+			slog.String("exporter", c.trace.exporter),
+			slog.String("file", c.trace.file),
+		),
+	)
+}
+
+// String keeps the password out of anything that prints the configuration
+// with fmt.
+func (c serverConfig) String() string {
+	return c.LogValue().String()
+}
@@ -0,0 +1,85 @@
+// Filename: cmd/api/dbstats.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+)
+
+// poolStats is the state of the database connection pool, from
+// sql.DB.Stats. The counters are totals since the server started.
+type poolStats struct {
+	MaxOpenConnections int `json:"max_open_connections"` // zero means unlimited
+	OpenConnections    int `json:"open_connections"`
+	InUse              int `json:"in_use"`
+	Idle               int `json:"idle"`
+
+	WaitCount           int64   `json:"wait_count"`            // times a request had to wait for a connection
+	WaitDurationSeconds float64 `json:"wait_duration_seconds"` // total time spent waiting
+	MaxIdleClosed       int64   `json:"max_idle_closed"`       // closed because of db-max-idle-conns
+	MaxIdleTimeClosed   int64   `json:"max_idle_time_closed"`  // closed because of db-max-idle-time
+	MaxLifetimeClosed   int64   `json:"max_lifetime_closed"`   // closed because of db-max-lifetime
+}
+
+func newPoolStats(s sql.DBStats) poolStats {
+	return poolStats{
+		MaxOpenConnections:  s.MaxOpenConnections,
+		OpenConnections:     s.OpenConnections,
+		InUse:               s.InUse,
+		Idle:                s.Idle,
+		WaitCount:           s.WaitCount,
+		WaitDurationSeconds: s.WaitDuration.Seconds(),
+		MaxIdleClosed:       s.MaxIdleClosed,
+		MaxIdleTimeClosed:   s.MaxIdleTimeClosed,
+		MaxLifetimeClosed:   s.MaxLifetimeClosed,
+	}
+}
+
+// dbStatsHandler reports the state of the connection pool, to size it
+// against the load seen in production.
+func (a *applicationDependencies) dbStatsHandler(w http.ResponseWriter, r *http.Request) {
+	err := a.writeResponse(w, r, http.StatusOK, envelope{"pool": newPoolStats(a.db.Stats())}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// logPoolStats logs the state of the connection pool every interval until
+// ctx is done. Requests having waited for a connection since the previous
+// report are logged as a warning, the pool being too small for the load.
+func (a *applicationDependencies) logPoolStats(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var previous sql.DBStats
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stats := a.db.Stats()
+		waits := stats.WaitCount - previous.WaitCount
+		waited := stats.WaitDuration - previous.WaitDuration
+		previous = stats
+
+		level, message := a.logger.Info, "database pool stats"
+		if waits > 0 {
+			level, message = a.logger.Warn, "database pool stats: requests waited for a connection, consider raising -db-max-open-conns"
+		}
+		level(message,
+			"max_open", stats.MaxOpenConnections,
+			"open", stats.OpenConnections,
+			"in_use", stats.InUse,
+			"idle", stats.Idle,
+			"waits", waits,
+			"waited", waited.String(),
+			"max_idle_closed", stats.MaxIdleClosed,
+			"max_idle_time_closed", stats.MaxIdleTimeClosed,
+			"max_lifetime_closed", stats.MaxLifetimeClosed,
+		)
+	}
+}
@@ -2,35 +2,190 @@
 package main
 
 import (
-	"fmt"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"net/http"
+	"sort"
+
+	"github.com/mtechguy/test2/internal/i18n"
+	"github.com/mtechguy/test2/internal/validator"
 )
 
+// problem is an RFC 7807 problem details object. Code is a stable,
+// machine-readable identifier for the kind of failure; clients should match
+// on it rather than on the human-readable title and detail, which are
+// written in the client's language.
+type problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Errors   []fieldError `json:"errors,omitempty"`
+}
+
+// fieldError is one validation failure of a request field.
+type fieldError struct {
+	Field  string         `json:"field"`
+	Code   string         `json:"code"`
+	Detail string         `json:"detail"`
+	Params map[string]any `json:"params,omitempty"`
+}
+
 func (a *applicationDependencies) logError(r *http.Request, err error) {
 
 	method := r.Method
 	uri := r.URL.RequestURI()
-	a.logger.Error(err.Error(), "method", method, "uri", uri)
+	a.logger.ErrorContext(r.Context(), err.Error(), "method", method, "uri", uri)
+
+}
+
+// requestLanguage is the language to answer r in, from its Accept-Language
+// header.
+func requestLanguage(r *http.Request) string {
+	return i18n.Negotiate(r.Header.Get("Accept-Language"))
+}
+
+// newProblem fills in a problem for the request from its status and code.
+// The title and detail come from the message catalog, with params filling
+// in the detail.
+func newProblem(r *http.Request, status int, code string, params map[string]any) *problem {
+	language := requestLanguage(r)
+
+	title := i18n.Translate(language, code+".title", nil)
+	if title == code+".title" {
+		title = http.StatusText(status)
+	}
 
+	return &problem{
+		Type:     "/problems/" + code,
+		Title:    title,
+		Status:   status,
+		Detail:   i18n.Translate(language, code, params),
+		Instance: r.URL.RequestURI(),
+		Code:     code,
+	}
+}
+
+// localizeErrors fills in the message of each validation error in the
+// language of the request.
+func localizeErrors(r *http.Request, errors map[string][]validator.Error) {
+	language := requestLanguage(r)
+	for _, fieldErrors := range errors {
+		for i := range fieldErrors {
+			fieldErrors[i].Message = i18n.Translate(language, fieldErrors[i].Code, fieldErrors[i].Params)
+		}
+	}
 }
 
-func (a *applicationDependencies) errorResponseJSON(w http.ResponseWriter,
+func (a *applicationDependencies) errorResponse(w http.ResponseWriter,
 	r *http.Request,
 	status int,
-	message any) {
+	code string,
+	params map[string]any) {
 
-	errorData := envelope{"error": message}
-	err := a.writeJSON(w, status, errorData, nil)
+	a.problemResponse(w, r, newProblem(r, status, code, params))
+}
+
+func (a *applicationDependencies) problemResponse(w http.ResponseWriter, r *http.Request, p *problem) {
+	format, ok := negotiateFormat(r.Header.Get("Accept"), false)
+	if !ok {
+		format = formatJSON
+	}
+	w.Header().Add("Vary", "Accept")
+	w.Header().Add("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", requestLanguage(r))
+
+	err := writeProblem(w, format, p)
 	if err != nil {
 		a.logError(r, err)
 		w.WriteHeader(500)
 	}
 }
 
-func (a *applicationDependencies) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
+func writeProblem(w http.ResponseWriter, format responseFormat, p *problem) error {
+	var body []byte
+	var err error
+
+	switch format {
+	case formatXML:
+		body, err = problemXML(p)
+		w.Header().Set("Content-Type", "application/problem+xml; charset=utf-8")
+	case formatCompactJSON:
+		body, err = json.Marshal(p)
+		w.Header().Set("Content-Type", "application/problem+json")
+	default:
+		body, err = json.MarshalIndent(p, "", "\t")
+		w.Header().Set("Content-Type", "application/problem+json")
+	}
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(p.Status)
+	_, err = w.Write(append(body, '\n'))
+	return err
+}
+
+// problemXML renders p in the XML format of RFC 7807 appendix A.
+func problemXML(p *problem) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "\t")
+
+	start := xml.StartElement{
+		Name: xml.Name{Local: "problem"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: "urn:ietf:rfc:7807"}},
+	}
+	err := enc.EncodeToken(start)
+	if err != nil {
+		return nil, err
+	}
 
-	message := "rate limit exceeded"
-	a.errorResponseJSON(w, r, http.StatusTooManyRequests, message)
+	members := []struct {
+		name  string
+		value any
+	}{
+		{"type", p.Type}, {"title", p.Title}, {"status", p.Status}, {"detail", p.Detail},
+		{"instance", p.Instance}, {"code", p.Code},
+	}
+	for _, member := range members {
+		if member.value == "" {
+			continue
+		}
+		err = encodeXMLElement(enc, member.name, member.value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(p.Errors) > 0 {
+		generic, err := toGeneric(p.Errors)
+		if err != nil {
+			return nil, err
+		}
+		err = encodeXMLElement(enc, "errors", generic)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = enc.EncodeToken(start.End())
+	if err != nil {
+		return nil, err
+	}
+	err = enc.Flush()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (a *applicationDependencies) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
+	a.errorResponse(w, r, http.StatusTooManyRequests, "rate_limit_exceeded", nil)
 }
 
 func (a *applicationDependencies) serverErrorResponse(w http.ResponseWriter,
@@ -39,52 +194,107 @@ func (a *applicationDependencies) serverErrorResponse(w http.ResponseWriter,
 
 	a.logError(r, err)
 
-	message := "the server encountered a problem and could not process your request"
-	a.errorResponseJSON(w, r, http.StatusInternalServerError, message)
+	a.errorResponse(w, r, http.StatusInternalServerError, "internal_error", nil)
 }
 
 func (a *applicationDependencies) notFoundResponse(w http.ResponseWriter,
 	r *http.Request) {
 
-	message := "the requested resource could not be found"
-	a.errorResponseJSON(w, r, http.StatusNotFound, message)
+	a.errorResponse(w, r, http.StatusNotFound, "not_found", nil)
+}
+
+func (a *applicationDependencies) productNotFoundResponse(w http.ResponseWriter, r *http.Request, id int64) {
+	a.errorResponse(w, r, http.StatusNotFound, "product_not_found", map[string]any{"id": id})
+}
+
+func (a *applicationDependencies) reviewNotFoundResponse(w http.ResponseWriter, r *http.Request, id int64) {
+	a.errorResponse(w, r, http.StatusNotFound, "review_not_found", map[string]any{"id": id})
+}
+
+func (a *applicationDependencies) translationNotFoundResponse(w http.ResponseWriter, r *http.Request, id int64, locale string) {
+	a.errorResponse(w, r, http.StatusNotFound, "translation_not_found", map[string]any{"id": id, "locale": locale})
+}
+
+func (a *applicationDependencies) serviceUnavailableResponse(w http.ResponseWriter, r *http.Request) {
+	a.errorResponse(w, r, http.StatusServiceUnavailable, "service_unavailable", nil)
 }
 
-func (a *applicationDependencies) PRIDnotFound(w http.ResponseWriter, r *http.Request, id int64) {
-	message := fmt.Sprintf("Product with id = %d was not found", id)
-	a.errorResponseJSON(w, r, http.StatusNotFound, message)
+func (a *applicationDependencies) idempotencyKeyMismatchResponse(w http.ResponseWriter, r *http.Request) {
+	a.errorResponse(w, r, http.StatusUnprocessableEntity, "idempotency_key_mismatch", nil)
 }
 
-func (a *applicationDependencies) RRIDnotFound(w http.ResponseWriter, r *http.Request, id int64) {
-	message := fmt.Sprintf("Review with id = %d was not found", id)
-	a.errorResponseJSON(w, r, http.StatusNotFound, message)
+func (a *applicationDependencies) idempotencyKeyInProgressResponse(w http.ResponseWriter, r *http.Request) {
+	a.errorResponse(w, r, http.StatusConflict, "idempotency_key_in_progress", nil)
 }
 
-func (a *applicationDependencies) PIDnotFound(w http.ResponseWriter, r *http.Request, id int64) {
-	message := fmt.Sprintf("Product with id = %d was already deleted", id)
-	a.errorResponseJSON(w, r, http.StatusNotFound, message)
+func (a *applicationDependencies) patchConflictResponse(w http.ResponseWriter, r *http.Request, err error) {
+	a.errorResponse(w, r, http.StatusConflict, "patch_test_failed", map[string]any{"error": err.Error()})
 }
-func (a *applicationDependencies) RIDnotFound(w http.ResponseWriter, r *http.Request, id int64) {
-	message := fmt.Sprintf("Review with id = %d was already deleted", id)
-	a.errorResponseJSON(w, r, http.StatusNotFound, message)
+
+// patchNotApplicableResponse reports a patch that doesn't fit the record.
+// As in badRequestResponse, the detail of a requestError is translated.
+func (a *applicationDependencies) patchNotApplicableResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var re *requestError
+	if errors.As(err, &re) {
+		p := newProblem(r, http.StatusUnprocessableEntity, "patch_not_applicable", nil)
+		p.Detail = i18n.Translate(requestLanguage(r), re.detail.Code, re.detail.Params)
+		a.problemResponse(w, r, p)
+		return
+	}
+
+	a.errorResponse(w, r, http.StatusUnprocessableEntity, "patch_not_applicable", map[string]any{"error": err.Error()})
 }
 
 func (a *applicationDependencies) methodNotAllowedResponse(
 	w http.ResponseWriter,
 	r *http.Request) {
 
-	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
+	a.errorResponse(w, r, http.StatusMethodNotAllowed, "method_not_allowed", map[string]any{"method": r.Method})
+}
+
+// requestError is a malformed request, with a message code and parameters
+// like a validation error so it can be reported in the client's language.
+type requestError struct {
+	detail validator.Error
+}
+
+func newRequestError(code string, params ...any) *requestError {
+	return &requestError{validator.NewError(code, params...)}
+}
 
-	a.errorResponseJSON(w, r, http.StatusMethodNotAllowed, message)
+func (e *requestError) Error() string {
+	return i18n.Translate(i18n.DefaultLanguage, e.detail.Code, e.detail.Params)
 }
 
+// badRequestResponse reports a malformed request. The detail of a
+// requestError is translated; any other error's text is passed on as is.
 func (a *applicationDependencies) badRequestResponse(w http.ResponseWriter,
 	r *http.Request, err error) {
 
-	a.errorResponseJSON(w, r, http.StatusBadRequest, err.Error())
+	var re *requestError
+	if errors.As(err, &re) {
+		p := newProblem(r, http.StatusBadRequest, "bad_request", nil)
+		p.Detail = i18n.Translate(requestLanguage(r), re.detail.Code, re.detail.Params)
+		a.problemResponse(w, r, p)
+		return
+	}
+
+	a.errorResponse(w, r, http.StatusBadRequest, "bad_request", map[string]any{"error": err.Error()})
 }
 
+// failedValidationResponse lists each error of each invalid field, ordered
+// by field name so the response is stable.
 func (a *applicationDependencies) failedValidationResponse(w http.ResponseWriter, r *http.Request,
-	errors map[string]string) {
-	a.errorResponseJSON(w, r, http.StatusUnprocessableEntity, errors)
+	errors map[string][]validator.Error) {
+
+	p := newProblem(r, http.StatusUnprocessableEntity, "validation_failed", nil)
+	localizeErrors(r, errors)
+	for field, fieldErrors := range errors {
+		for _, e := range fieldErrors {
+			p.Errors = append(p.Errors, fieldError{Field: field, Code: e.Code, Detail: e.Message, Params: e.Params})
+		}
+	}
+	sort.SliceStable(p.Errors, func(i, j int) bool { return p.Errors[i].Field < p.Errors[j].Field })
+
+	a.problemResponse(w, r, p)
 }
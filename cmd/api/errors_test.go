@@ -0,0 +1,99 @@
+// Filename: cmd/api/errors_test.go
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestBadRequestTranslated checks that a body readJSON rejects is reported
+// in the client's language, like a validation error.
+func TestBadRequestTranslated(t *testing.T) {
+	router, _ := newTestApplication(t).router()
+
+	tests := []struct {
+		name     string
+		body     string
+		language string
+		want     string
+	}{
+		{name: "malformed", body: `{"name":`, language: "en", want: "the body contains badly-formed JSON"},
+		{name: "malformed at", body: `{"name" "Lamp"}`, language: "en", want: "the body contains badly-formed JSON (at character 9)"},
+		{name: "field type", body: `{"name":1}`, language: "en", want: "the body contains the incorrect JSON type for field name"},
+		{name: "unknown field", body: `{"colour":"red"}`, language: "en", want: "the body contains unknown key colour"},
+		{name: "empty", body: ``, language: "en", want: "the body must not be empty"},
+		{name: "two values", body: `{}{}`, language: "en", want: "the body must only contain a single JSON value"},
+		{name: "too large", body: `"` + strings.Repeat("a", 256_000) + `"`, language: "en", want: "the body must not be larger than 256000 bytes"},
+		{name: "malformed in spanish", body: `{"name":`, language: "es", want: "el cuerpo contiene JSON mal formado"},
+		{name: "unknown field in spanish", body: `{"colour":"red"}`, language: "es-MX", want: "el cuerpo contiene la clave desconocida colour"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v2/products", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("Accept-Language", tt.language)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+			}
+			var p problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Code != "bad_request" || p.Detail != tt.want {
+				t.Errorf("code = %q, detail = %q, want bad_request, %q", p.Code, p.Detail, tt.want)
+			}
+		})
+	}
+}
+
+// TestPatchNotApplicableTranslated checks that a patch which doesn't fit the
+// record is reported in the client's language.
+func TestPatchNotApplicableTranslated(t *testing.T) {
+	a := newTestApplication(t)
+
+	tests := []struct {
+		name     string
+		patch    string
+		language string
+		want     string
+	}{
+		{name: "field type", patch: `{"name":1}`, language: "en", want: "the patched document has the incorrect JSON type for field name"},
+		{name: "unknown field", patch: `{"colour":"red"}`, language: "en", want: "the patched document contains unknown key colour"},
+		{name: "not an object", patch: `[]`, language: "en", want: "the patched document must be a JSON object"},
+		{name: "unknown field in spanish", patch: `{"colour":"red"}`, language: "es", want: "el documento parcheado contiene la clave desconocida colour"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPatch, "/v2/products/1", strings.NewReader(tt.patch))
+			r.Header.Set("Content-Type", mergePatchContentType)
+			r.Header.Set("Accept-Language", tt.language)
+			w := httptest.NewRecorder()
+
+			document := struct {
+				Name string `json:"name"`
+			}{Name: "Lamp"}
+			handled, err := a.readPatch(w, r, &document)
+			if !handled || err == nil {
+				t.Fatalf("readPatch = %v, %v, want an error", handled, err)
+			}
+			a.patchErrorResponse(w, r, err)
+
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusUnprocessableEntity, w.Body)
+			}
+			var p problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Code != "patch_not_applicable" || p.Detail != tt.want {
+				t.Errorf("code = %q, detail = %q, want patch_not_applicable, %q", p.Code, p.Detail, tt.want)
+			}
+		})
+	}
+}
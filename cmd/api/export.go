@@ -0,0 +1,315 @@
+// Filename: cmd/api/export.go
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mtechguy/test2/internal/data"
+	"github.com/mtechguy/test2/internal/i18n"
+	"github.com/mtechguy/test2/internal/validator"
+)
+
+// exportMaxDuration bounds how long a single export may run.
+const exportMaxDuration = 30 * time.Minute
+
+// exportFormat picks csv or ndjson from the format parameter, falling back
+// to the Accept header and then to ndjson.
+func exportFormat(r *http.Request, v *validator.Validator) string {
+	format := r.URL.Query().Get("format")
+	if format != "" {
+		v.Check(validator.PermittedValue(format, "csv", "ndjson"), "format", "one_of", "values", "csv, ndjson")
+		return format
+	}
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(accepted))
+		switch mediaType {
+		case "text/csv", "application/csv":
+			return "csv"
+		case "application/x-ndjson", "application/ndjson", "application/jsonl":
+			return "ndjson"
+		}
+	}
+	return "ndjson"
+}
+
+// exportWriter writes the rows of an export as CSV or NDJSON. Headers are
+// only sent once the query has started successfully, so an early failure
+// can still be reported as a normal error response.
+type exportWriter struct {
+	w        http.ResponseWriter
+	rc       *http.ResponseController
+	format   string
+	filename string
+	columns  []string
+	fields   []string // the fields asked for, nil for all of them
+	indexes  []int    // of the fields in a full CSV row
+	csv      *csv.Writer
+	json     *json.Encoder
+	started  bool
+}
+
+// newExportWriter returns a writer for rows with the given columns. Like
+// the lists, the rows are narrowed to fields, in the order they were asked
+// for, when there are any.
+func newExportWriter(w http.ResponseWriter, format string, filename string, columns []string, fields []string) *exportWriter {
+	e := &exportWriter{
+		w:        w,
+		rc:       http.NewResponseController(w),
+		format:   format,
+		filename: filename,
+		columns:  columns,
+	}
+	if len(fields) > 0 {
+		e.columns = nil
+		for _, field := range fields {
+			if !slices.Contains(e.columns, field) {
+				e.columns = append(e.columns, field)
+				e.indexes = append(e.indexes, slices.Index(columns, field))
+			}
+		}
+		e.fields = e.columns
+	}
+	return e
+}
+
+func (e *exportWriter) start() error {
+	if e.started {
+		return nil
+	}
+
+	// The first batch may have taken a while; start the clock again.
+	err := e.rc.SetWriteDeadline(time.Now().Add(time.Minute))
+	if err != nil {
+		return err
+	}
+	e.started = true
+
+	if e.format == "csv" {
+		e.w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		e.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", e.filename+".csv"))
+		e.w.WriteHeader(http.StatusOK)
+		e.csv = csv.NewWriter(e.w)
+		return e.csv.Write(e.columns)
+	}
+
+	e.w.Header().Set("Content-Type", "application/x-ndjson")
+	e.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", e.filename+".ndjson"))
+	e.w.WriteHeader(http.StatusOK)
+	e.json = json.NewEncoder(e.w)
+	return nil
+}
+
+// writeRow writes one record; record is the full CSV row and value the
+// NDJSON object.
+func (e *exportWriter) writeRow(record []string, value any) error {
+	if e.format == "csv" {
+		if e.indexes != nil {
+			selected := make([]string, len(e.indexes))
+			for i, index := range e.indexes {
+				selected[i] = record[index]
+			}
+			record = selected
+		}
+		return e.csv.Write(record)
+	}
+
+	if e.fields != nil {
+		res, err := newResource(value, e.fields)
+		if err != nil {
+			return err
+		}
+		value = res
+	}
+	return e.json.Encode(value)
+}
+
+// writeError ends a stream that failed part way with a record saying so,
+// so the rows sent aren't mistaken for the whole export. In NDJSON it is an
+// object with an error member; in CSV a row with a single field, which
+// readers expecting the header's columns reject.
+func (e *exportWriter) writeError(r *http.Request) error {
+	message := i18n.Translate(requestLanguage(r), "export_interrupted", nil)
+	if e.format == "csv" {
+		err := e.csv.Write([]string{message})
+		if err != nil {
+			return err
+		}
+	} else {
+		err := e.json.Encode(envelope{"error": map[string]string{"code": "export_interrupted", "detail": message}})
+		if err != nil {
+			return err
+		}
+	}
+	return e.flush()
+}
+
+// flush pushes the batch to the client and moves the write deadline along,
+// so the server's WriteTimeout only applies to a stalled client rather
+// than to the export as a whole.
+func (e *exportWriter) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	err := e.rc.SetWriteDeadline(time.Now().Add(time.Minute))
+	if err != nil {
+		return err
+	}
+	return e.rc.Flush()
+}
+
+// finishExport handles the outcome of an export. Before anything was sent the
+// error is reported normally; after that it is logged, the stream ends with
+// an error record and the connection is cut short.
+func (a *applicationDependencies) finishExport(w http.ResponseWriter, r *http.Request, e *exportWriter, err error) {
+	if err == nil {
+		err = e.start()
+		if err == nil {
+			err = e.flush()
+		}
+	}
+	if err == nil {
+		return
+	}
+
+	if !e.started {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	// A cancelled export has lost its client, so there is no one to tell.
+	if !errors.Is(err, context.Canceled) {
+		a.logError(r, err)
+		err = e.writeError(r)
+		if err != nil {
+			a.logError(r, err)
+		}
+	}
+	panic(http.ErrAbortHandler)
+}
+
+func (a *applicationDependencies) exportProductHandler(w http.ResponseWriter, r *http.Request) {
+	var queryParametersData struct {
+		Name     string
+		Category string
+		data.Filters
+	}
+
+	queryParameters := r.URL.Query()
+	queryParametersData.Name = a.getSingleQueryParameter(queryParameters, "name", "")
+	queryParametersData.Category = a.getSingleQueryParameter(queryParameters, "category", "")
+
+	v := validator.New()
+	queryParametersData.Filters.Sort = a.getSingleQueryParameter(queryParameters, "sort", "product_id")
+	queryParametersData.Filters.SortSafeList = []string{"product_id", "name", "-product_id", "-name"}
+	v.Check(validator.PermittedValue(queryParametersData.Filters.Sort, queryParametersData.Filters.SortSafeList...), "sort",
+		"one_of", "values", strings.Join(queryParametersData.Filters.SortSafeList, ", "))
+	queryParametersData.Filters.Fields = a.getMultipleQueryParameters(queryParameters, "fields", nil)
+	data.ValidateFields(v, queryParametersData.Filters.Fields, data.ProductFieldSafeList)
+	queryParametersData.Filters.Locales = a.contentLocales(r, v)
+	format := exportFormat(r, v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), exportMaxDuration)
+	defer cancel()
+
+	// As in the list, the products can come in different languages.
+	setContentLanguage(w, "")
+	e := newExportWriter(w, format, "products", []string{"product_id", "name", "description", "category",
+		"image_url", "price", "average_rating", "version"}, queryParametersData.Filters.Fields)
+
+	err := a.productModel.ExportProducts(ctx, queryParametersData.Name, queryParametersData.Category, queryParametersData.Filters,
+		func(products []*data.Product) error {
+			err := e.start()
+			if err != nil {
+				return err
+			}
+			for _, product := range products {
+				err = e.writeRow([]string{
+					strconv.FormatInt(product.ProductID, 10),
+					product.Name,
+					product.Description,
+					product.Category,
+					product.ImageURL,
+					product.Price,
+					strconv.FormatFloat(float64(product.AverageRating), 'f', 2, 32),
+					strconv.FormatInt(int64(product.Version), 10),
+				}, product)
+				if err != nil {
+					return err
+				}
+			}
+			return e.flush()
+		})
+
+	a.finishExport(w, r, e, err)
+}
+
+func (a *applicationDependencies) exportReviewHandler(w http.ResponseWriter, r *http.Request) {
+	var queryParametersData struct {
+		Author string
+		data.Filters
+	}
+
+	queryParameters := r.URL.Query()
+	queryParametersData.Author = a.getSingleQueryParameter(queryParameters, "author", "")
+
+	v := validator.New()
+	queryParametersData.Filters.Sort = a.getSingleQueryParameter(queryParameters, "sort", "review_id")
+	queryParametersData.Filters.SortSafeList = []string{"review_id", "author", "-review_id", "-author"}
+	v.Check(validator.PermittedValue(queryParametersData.Filters.Sort, queryParametersData.Filters.SortSafeList...), "sort",
+		"one_of", "values", strings.Join(queryParametersData.Filters.SortSafeList, ", "))
+	queryParametersData.Filters.Fields = a.getMultipleQueryParameters(queryParameters, "fields", nil)
+	data.ValidateFields(v, queryParametersData.Filters.Fields, data.ReviewFieldSafeList)
+	format := exportFormat(r, v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), exportMaxDuration)
+	defer cancel()
+
+	e := newExportWriter(w, format, "reviews", []string{"review_id", "product_id", "author", "rating",
+		"review_text", "helpful_count", "version"}, queryParametersData.Filters.Fields)
+
+	err := a.reviewModel.ExportReviews(ctx, queryParametersData.Author, queryParametersData.Filters,
+		func(reviews []*data.Review) error {
+			err := e.start()
+			if err != nil {
+				return err
+			}
+			for _, review := range reviews {
+				err = e.writeRow([]string{
+					strconv.FormatInt(review.ReviewID, 10),
+					strconv.FormatInt(review.ProductID, 10),
+					review.Author,
+					strconv.FormatInt(review.Rating, 10),
+					review.ReviewText,
+					strconv.FormatInt(int64(review.HelpfulCount), 10),
+					strconv.Itoa(review.Version),
+				}, review)
+				if err != nil {
+					return err
+				}
+			}
+			return e.flush()
+		})
+
+	a.finishExport(w, r, e, err)
+}
@@ -0,0 +1,90 @@
+// Filename: cmd/api/export_test.go
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// TestExportWriter streams two rows, narrowed to some fields, then fails
+// and checks the stream ends with an error record before it is cut short.
+func TestExportWriter(t *testing.T) {
+	type thing struct {
+		ID    int64  `json:"id"`
+		Name  string `json:"name"`
+		Price string `json:"price"`
+	}
+	things := []thing{{1, "Lamp", "9.99"}, {2, "Desk, large", "120.00"}}
+
+	tests := []struct {
+		name   string
+		format string
+		fields []string
+		want   string
+	}{
+		{
+			name:   "csv with fields",
+			format: "csv",
+			fields: []string{"name", "id", "name"},
+			want:   "name,id\nLamp,1\n\"Desk, large\",2\n\"la exportación falló antes de completarse, las filas enviadas no son todas\"\n",
+		},
+		{
+			name:   "ndjson with fields",
+			format: "ndjson",
+			fields: []string{"price", "id"},
+			want: `{"price":"9.99","id":1}` + "\n" + `{"price":"120.00","id":2}` + "\n" +
+				`{"error":{"code":"export_interrupted","detail":"la exportación falló antes de completarse, las filas enviadas no son todas"}}` + "\n",
+		},
+		{
+			name:   "ndjson",
+			format: "ndjson",
+			want: `{"id":1,"name":"Lamp","price":"9.99"}` + "\n" + `{"id":2,"name":"Desk, large","price":"120.00"}` + "\n" +
+				`{"error":{"code":"export_interrupted","detail":"la exportación falló antes de completarse, las filas enviadas no son todas"}}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestApplication(t)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				e := newExportWriter(w, tt.format, "things", []string{"id", "name", "price"}, tt.fields)
+				err := e.start()
+				for _, th := range things {
+					if err == nil {
+						err = e.writeRow([]string{strconv.FormatInt(th.ID, 10), th.Name, th.Price}, th)
+					}
+				}
+				if err == nil {
+					err = e.flush()
+				}
+				if err != nil {
+					t.Error(err)
+				}
+				a.finishExport(w, r, e, errors.New("the database went away"))
+			}))
+			defer server.Close()
+
+			r, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set("Accept-Language", "es")
+			res, err := server.Client().Do(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			body, err := io.ReadAll(res.Body)
+			if err == nil {
+				t.Error("the stream ended normally, want it cut short")
+			}
+			if string(body) != tt.want {
+				t.Errorf("body = %q, want %q", body, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Filename: cmd/api/fields.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// resource is a JSON object written with its members in a fixed order. It
+// is used when a client narrowed a response with ?fields= or asked for
+// related data to be embedded with ?include=.
+type resource struct {
+	keys   []string
+	values map[string]any
+}
+
+// newResource turns value into a resource keeping only the given fields,
+// in the order they were asked for. No fields keeps every member.
+func newResource(value any, fields []string) (*resource, error) {
+	js, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	keys, raw, err := orderedObject(js)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) > 0 {
+		keys = keys[:0:0]
+		seen := make(map[string]bool, len(fields))
+		for _, field := range fields {
+			if _, found := raw[field]; found && !seen[field] {
+				keys = append(keys, field)
+				seen[field] = true
+			}
+		}
+	}
+
+	res := &resource{keys: keys, values: make(map[string]any, len(keys))}
+	for _, key := range keys {
+		res.values[key] = raw[key]
+	}
+	return res, nil
+}
+
+// embed adds a related value under key, after the resource's own fields.
+func (res *resource) embed(key string, value any) {
+	if _, found := res.values[key]; !found {
+		res.keys = append(res.keys, key)
+	}
+	res.values[key] = value
+}
+
+func (res *resource) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range res.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(res.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// selectFields narrows every item of a list to the given fields. The list
+// is returned as it is when no fields were asked for.
+func selectFields[T any](items []T, fields []string) (any, error) {
+	if len(fields) == 0 {
+		return items, nil
+	}
+
+	resources := make([]*resource, len(items))
+	for i, item := range items {
+		res, err := newResource(item, fields)
+		if err != nil {
+			return nil, err
+		}
+		resources[i] = res
+	}
+	return resources, nil
+}
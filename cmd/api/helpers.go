@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -44,7 +45,16 @@ func (a *applicationDependencies) readJSON(w http.ResponseWriter,
 	r *http.Request,
 	destination any) error {
 
-	maxBytes := 256_000
+	return a.readJSONWithLimit(w, r, destination, 256_000)
+}
+
+// readJSONWithLimit is readJSON for endpoints that accept larger bodies,
+// such as the bulk endpoints.
+func (a *applicationDependencies) readJSONWithLimit(w http.ResponseWriter,
+	r *http.Request,
+	destination any,
+	maxBytes int) error {
+
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
 
 	dec := json.NewDecoder(r.Body)
@@ -61,39 +71,29 @@ func (a *applicationDependencies) readJSON(w http.ResponseWriter,
 
 		switch {
 		case errors.As(err, &syntaxError):
-			return fmt.Errorf("the body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+			return newRequestError("body_malformed_at", "offset", syntaxError.Offset)
 			// Decode can also send back an io error message
 		case errors.Is(err, io.ErrUnexpectedEOF):
-			return errors.New("the body contains badly-formed JSON")
+			return newRequestError("body_malformed")
 
 		case errors.As(err, &unmarshalTypeError):
 			if unmarshalTypeError.Field != "" {
-				return fmt.Errorf("the body contains the incorrect JSON type for field %q", unmarshalTypeError.Field)
+				return newRequestError("body_field_type", "field", unmarshalTypeError.Field)
 			}
-			return fmt.Errorf("the body contains the incorrect  JSON type (at character %d)",
-				unmarshalTypeError.Offset)
-		case errors.Is(err, io.EOF):
-			return errors.New("the body must not be empty")
-
-		case strings.HasPrefix(err.Error(), "json: unknown field "):
-			fieldName := strings.TrimPrefix(err.Error(),
-				"json: unknown field ")
-			return fmt.Errorf("body contains unknown key %s", fieldName)
+			return newRequestError("body_type_at", "offset", unmarshalTypeError.Offset)
 
-		case errors.As(err, &maxBytesError):
-			return fmt.Errorf("the body must not be larger that %d bytes", maxBytesError.Limit)
 		case errors.Is(err, io.EOF):
-			return errors.New("the body must not be empty")
+			return newRequestError("body_empty")
 
 		case strings.HasPrefix(err.Error(), "json: unknown field "):
 			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
-			return fmt.Errorf("body contains unknown key %s", fieldName)
+			if unquoted, err := strconv.Unquote(fieldName); err == nil {
+				fieldName = unquoted
+			}
+			return newRequestError("body_unknown_field", "field", fieldName)
 
 		case errors.As(err, &maxBytesError):
-			return fmt.Errorf("the body must not be larger that %d bytes", maxBytesError.Limit)
-
-		case errors.Is(err, io.EOF):
-			return errors.New("the body must not be empty")
+			return newRequestError("body_too_large", "max", maxBytesError.Limit)
 
 		case errors.As(err, &invalidUnmarshalError):
 			panic(err)
@@ -106,12 +106,30 @@ func (a *applicationDependencies) readJSON(w http.ResponseWriter,
 	err = dec.Decode(&struct{}{})
 
 	if !errors.Is(err, io.EOF) {
-		return errors.New("body must only contain a single JSON value")
+		return newRequestError("body_multiple_values")
 	}
 
 	return nil
 }
 
+// background runs fn in its own goroutine. serve() waits for these to
+// finish before the process exits, and a panic is logged, with ctx so it
+// carries the request ID and trace, instead of crashing the server.
+func (a *applicationDependencies) background(ctx context.Context, fn func()) {
+	a.wg.Add(1)
+
+	go func() {
+		defer a.wg.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				a.logger.ErrorContext(ctx, fmt.Sprintf("%v", err))
+			}
+		}()
+
+		fn()
+	}()
+}
+
 func (a *applicationDependencies) readIDParam(r *http.Request, paramName string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
@@ -152,7 +170,7 @@ func (a *applicationDependencies) getSingleIntegerParameter(queryParameters url.
 	// try to convert to an integer
 	intValue, err := strconv.Atoi(result)
 	if err != nil {
-		v.AddError(key, "must be an integer value")
+		v.AddError(key, "integer")
 		return defaultValue
 	}
 
@@ -0,0 +1,183 @@
+// Filename: cmd/api/idempotency.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mtechguy/test2/internal/data"
+	"github.com/mtechguy/test2/internal/jobs"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// recordingResponseWriter passes the response through to the client while
+// keeping a copy of it.
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+func (rw *recordingResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// callerID identifies who sent the request. There are no user accounts, so
+// like rateLimit we go by the client IP address.
+func (a *applicationDependencies) callerID(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// idempotencyRequestHash identifies what a request asks for, to tell a
+// retry from a different request reusing the key. It covers the route
+// rather than the path, without the version prefix, so /product and
+// /v1/product are the same request. The format and language the response
+// is rendered in are part of it too, since the stored response is replayed
+// as it is: a retry asking for another one is a different request.
+func idempotencyRequestHash(r *http.Request, body []byte) string {
+	_, route := routeOf(r)
+	format, _ := negotiateFormat(r.Header.Get("Accept"), false)
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n%d %s\n", r.Method, strings.TrimPrefix(route.pattern, routePrefix(r)), format, requestLanguage(r))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// idempotent makes a create handler safe to retry. The first response for
+// an Idempotency-Key is stored, and later requests with the same key get
+// that response back instead of creating another record. Requests without
+// the header are passed straight through.
+func (a *applicationDependencies) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > 255 {
+			a.badRequestResponse(w, r, newRequestError("idempotency_key_too_long", "max", 255))
+			return
+		}
+
+		// The payload is hashed so a reused key with a different request
+		// can be told apart from a genuine retry. The handler still applies
+		// its own, usually smaller, limit to the body.
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, bulkMaxBytes))
+		if err != nil {
+			a.badRequestResponse(w, r, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		requestHash := idempotencyRequestHash(r, body)
+
+		caller := a.callerID(r)
+		record, created, err := a.idempotencyModel.ReserveKey(r.Context(), caller, key, requestHash, a.config.idempotency.ttl)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !created {
+			switch {
+			case record.RequestHash != requestHash:
+				a.idempotencyKeyMismatchResponse(w, r)
+			case record.Status == data.IdempotencyInProgress:
+				a.idempotencyKeyInProgressResponse(w, r)
+			default:
+				for name, values := range record.ResponseHeaders {
+					w.Header()[name] = values
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(record.ResponseStatus)
+				w.Write(record.ResponseBody)
+			}
+			return
+		}
+
+		rw := &recordingResponseWriter{ResponseWriter: w}
+		defer func() {
+			// The outcome is recorded even when the client has gone away,
+			// or a retry would find the key in progress until it expires.
+			ctx := context.WithoutCancel(r.Context())
+			// A server error (or a panic on its way to recoverPanic) is
+			// worth retrying, so the key is given up rather than stored.
+			if rw.status == 0 || rw.status >= 500 {
+				err := a.idempotencyModel.ReleaseKey(ctx, caller, key)
+				if err != nil {
+					a.logError(r, err)
+				}
+				return
+			}
+
+			record.ResponseStatus = rw.status
+			record.ResponseHeaders = make(http.Header)
+			for _, name := range []string{"Content-Type", "Content-Language", "Location"} {
+				if value := w.Header().Get(name); value != "" {
+					record.ResponseHeaders.Set(name, value)
+				}
+			}
+			record.ResponseBody = rw.body.Bytes()
+
+			err := a.idempotencyModel.CompleteKey(ctx, record)
+			if err != nil {
+				a.logError(r, err)
+			}
+		}()
+
+		next(rw, r)
+	}
+}
+
+// pruneIdempotencyKeysJob deletes expired keys once an hour. Each run
+// schedules the next one; the unique key is per hour so instances sharing
+// the queue don't schedule duplicates.
+func (a *applicationDependencies) pruneIdempotencyKeysJob(ctx context.Context, runAt time.Time) error {
+	n, err := a.idempotencyModel.DeleteExpiredKeys(ctx)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		a.logger.Info("pruned expired idempotency keys", "count", n)
+	}
+
+	return a.schedulePruneIdempotencyKeys(ctx, runAt.Truncate(time.Hour).Add(time.Hour))
+}
+
+func (a *applicationDependencies) schedulePruneIdempotencyKeys(ctx context.Context, runAt time.Time) error {
+	_, err := jobs.Enqueue(ctx, a.jobModel, jobs.KindPruneIdempotencyKeys, struct{}{}, jobs.Options{
+		RunAt:     runAt,
+		UniqueKey: jobs.KindPruneIdempotencyKeys + ":" + strconv.FormatInt(runAt.Unix(), 10),
+	})
+	return err
+}
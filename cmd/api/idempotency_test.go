@@ -0,0 +1,64 @@
+// Filename: cmd/api/idempotency_test.go
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIdempotencyRequestHash(t *testing.T) {
+	// hash returns the hash of a request matching pattern, under version
+	// (0 for the legacy routes).
+	hash := func(version int, pattern string, body string, header http.Header) string {
+		var got string
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			got = idempotencyRequestHash(r, []byte(body))
+		}
+		if version > 0 {
+			handler = withVersion(version, handler)
+		}
+
+		r := httptest.NewRequest(http.MethodPost, pattern, strings.NewReader(body))
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		r, _ = routeOf(r)
+		withRoute(pattern, handler)(httptest.NewRecorder(), r)
+		return got
+	}
+
+	body := `{"name":"Lamp"}`
+	original := hash(0, "/product", body, nil)
+
+	same := []struct {
+		name string
+		hash string
+	}{
+		{"v1 prefix", hash(1, "/v1/product", body, nil)},
+		{"explicit JSON", hash(1, "/v1/product", body, http.Header{"Accept": {"application/json"}})},
+		{"English variant", hash(0, "/product", body, http.Header{"Accept-Language": {"en-GB"}})},
+	}
+	for _, tt := range same {
+		if tt.hash != original {
+			t.Errorf("%s: hash differs from the original request", tt.name)
+		}
+	}
+
+	different := []struct {
+		name string
+		hash string
+	}{
+		{"other route", hash(1, "/v1/review", body, nil)},
+		{"v2 route", hash(2, "/v2/products", body, nil)},
+		{"other body", hash(0, "/product", `{"name":"Desk"}`, nil)},
+		{"XML", hash(0, "/product", body, http.Header{"Accept": {"application/xml"}})},
+		{"Spanish", hash(0, "/product", body, http.Header{"Accept-Language": {"es"}})},
+	}
+	for _, tt := range different {
+		if tt.hash == original {
+			t.Errorf("%s: hash is the same as the original request's", tt.name)
+		}
+	}
+}
@@ -0,0 +1,482 @@
+// Filename: cmd/api/import.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mtechguy/test2/internal/data"
+	"github.com/mtechguy/test2/internal/i18n"
+	"github.com/mtechguy/test2/internal/validator"
+)
+
+const (
+	importMaxBytes     = 100 << 20 // 100 MB
+	importMaxRowErrors = 1000      // row errors kept on the import resource
+	importFlushEvery   = 250       // rows between progress updates
+)
+
+// importFields are the product fields an import can set. external_ref is
+// the merchandisers' own reference; rows that have one update the product
+// with the same reference instead of creating a new one.
+var importFields = []string{"external_ref", "name", "description", "category", "image_url", "price"}
+
+// importRowReader returns the rows of an upload one at a time, keyed by
+// column name (CSV) or by key (NDJSON).
+type importRowReader interface {
+	Next() (map[string]string, error)
+}
+
+// errRowUnreadable is a problem with a single row. The import records
+// its detail against the row and carries on with the next one.
+type errRowUnreadable struct {
+	detail validator.Error
+}
+
+func (e errRowUnreadable) Error() string {
+	return i18n.Translate(i18n.DefaultLanguage, e.detail.Code, e.detail.Params)
+}
+
+type csvRowReader struct {
+	reader *csv.Reader
+	header []string
+}
+
+func newCSVRowReader(r io.Reader) (*csvRowReader, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = false
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		var parseError *csv.ParseError
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil, newRequestError("import_header_missing")
+		case errors.As(err, &parseError):
+			return nil, newRequestError("import_header_malformed", "line", parseError.Line, "column", parseError.Column)
+		default:
+			return nil, err
+		}
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+	}
+
+	return &csvRowReader{reader: reader, header: header}, nil
+}
+
+func (c *csvRowReader) Next() (map[string]string, error) {
+	record, err := c.reader.Read()
+	if err != nil {
+		var parseError *csv.ParseError
+		switch {
+		case errors.Is(err, csv.ErrFieldCount):
+			return nil, errRowUnreadable{validator.NewError("row_column_count")}
+		case errors.As(err, &parseError):
+			return nil, errRowUnreadable{validator.NewError("row_malformed", "line", parseError.Line, "column", parseError.Column)}
+		}
+		return nil, err
+	}
+
+	row := make(map[string]string, len(c.header))
+	for i, column := range c.header {
+		row[column] = record[i]
+	}
+	return row, nil
+}
+
+type ndjsonRowReader struct {
+	scanner *bufio.Scanner
+}
+
+func newNDJSONRowReader(r io.Reader) *ndjsonRowReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	return &ndjsonRowReader{scanner: scanner}
+}
+
+func (n *ndjsonRowReader) Next() (map[string]string, error) {
+	for n.scanner.Scan() {
+		line := bytes.TrimSpace(n.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var object map[string]any
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		err := dec.Decode(&object)
+		if err != nil {
+			return nil, errRowUnreadable{validator.NewError("row_not_object")}
+		}
+
+		row := make(map[string]string, len(object))
+		for key, value := range object {
+			switch value := value.(type) {
+			case nil:
+			case string:
+				row[key] = value
+			case json.Number:
+				row[key] = value.String()
+			case bool:
+				row[key] = strconv.FormatBool(value)
+			default:
+				return nil, errRowUnreadable{validator.NewError("row_value_type", "field", key)}
+			}
+		}
+		return row, nil
+	}
+
+	if err := n.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// parseImportMapping reads the mapping query parameter, a comma separated
+// list of field=column pairs. Fields that aren't mapped are read from the
+// column with the same name.
+func parseImportMapping(value string, v *validator.Validator) map[string]string {
+	mapping := make(map[string]string, len(importFields))
+	for _, field := range importFields {
+		mapping[field] = field
+	}
+	if value == "" {
+		return mapping
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		field, column, found := strings.Cut(pair, "=")
+		field = strings.TrimSpace(field)
+		column = strings.TrimSpace(column)
+		if !found || column == "" {
+			v.AddError("mapping", "mapping_format")
+			continue
+		}
+		if !validator.PermittedValue(field, importFields...) {
+			v.AddError("mapping", "unknown_field", "field", field, "values", strings.Join(importFields, ", "))
+			continue
+		}
+		mapping[field] = column
+	}
+	return mapping
+}
+
+// importFormat works out whether the upload is CSV or NDJSON, preferring the
+// format query parameter over the Content-Type header.
+func importFormat(r *http.Request) string {
+	format := r.URL.Query().Get("format")
+	if format != "" {
+		return format
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv", "application/csv":
+		return "csv"
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines":
+		return "ndjson"
+	}
+	return ""
+}
+
+// lineCounter counts newlines on their way to the spool file, which gives a
+// close estimate of the number of rows before processing starts.
+type lineCounter struct {
+	lines int
+}
+
+func (l *lineCounter) Write(b []byte) (int, error) {
+	l.lines += bytes.Count(b, []byte{'\n'})
+	return len(b), nil
+}
+
+func (a *applicationDependencies) importProductHandler(w http.ResponseWriter, r *http.Request) {
+	queryParameters := r.URL.Query()
+
+	v := validator.New()
+	format := importFormat(r)
+	v.Check(validator.PermittedValue(format, "csv", "ndjson"), "format", "import_format")
+	mapping := parseImportMapping(queryParameters.Get("mapping"), v)
+
+	dryRun := false
+	if value := queryParameters.Get("dry_run"); value != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(value)
+		v.Check(err == nil, "dry_run", "boolean")
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Uploads can take longer than the server's ReadTimeout and
+	// WriteTimeout allow.
+	rc := http.NewResponseController(w)
+	err := rc.SetReadDeadline(time.Now().Add(10 * time.Minute))
+	if err == nil {
+		err = rc.SetWriteDeadline(time.Now().Add(11 * time.Minute))
+	}
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Spool the upload to disk so it can be processed after the response
+	// has been sent, without holding it in memory.
+	spool, err := os.CreateTemp("", "product-import-*")
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	keepSpool := false
+	defer func() {
+		if !keepSpool {
+			spool.Close()
+			os.Remove(spool.Name())
+		}
+	}()
+
+	counter := &lineCounter{}
+	_, err = io.Copy(io.MultiWriter(spool, counter), http.MaxBytesReader(w, r.Body, importMaxBytes))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			a.badRequestResponse(w, r, newRequestError("upload_too_large", "max", maxBytesError.Limit))
+			return
+		}
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	_, err = spool.Seek(0, io.SeekStart)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var rows importRowReader
+	estimatedRows := counter.lines
+	if format == "csv" {
+		csvRows, err := newCSVRowReader(spool)
+		if err != nil {
+			var re *requestError
+			if errors.As(err, &re) {
+				a.badRequestResponse(w, r, err)
+			} else {
+				a.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		// Columns named in the mapping must exist in the header.
+		for field, column := range mapping {
+			if column != field && !validator.PermittedValue(column, csvRows.header...) {
+				v.AddError("mapping", "missing_column", "column", column)
+			}
+		}
+		if !v.IsEmpty() {
+			a.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		rows = csvRows
+		estimatedRows--
+	} else {
+		rows = newNDJSONRowReader(spool)
+	}
+
+	imp := &data.Import{
+		Format:    format,
+		DryRun:    dryRun,
+		Status:    data.ImportRunning,
+		TotalRows: max(estimatedRows, 0),
+	}
+	err = a.importModel.InsertImport(r.Context(), imp)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The import keeps changing in the background, respond with a copy.
+	snapshot := *imp
+
+	// The import outlives the request but keeps its ID in the logs. It is
+	// cancelled when the server shuts down, rather than holding it up.
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	stopOnShutdown := context.AfterFunc(a.shutdown, cancel)
+	keepSpool = true
+	a.background(ctx, func() {
+		defer stopOnShutdown()
+		defer cancel()
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+		a.runImport(ctx, imp, rows, mapping)
+	})
+
+	headers := make(http.Header)
+	headers.Set("Location", location(r, fmt.Sprintf("/imports/%d", imp.ImportID)))
+
+	data := envelope{
+		"import": snapshot,
+	}
+	err = a.writeResponse(w, r, http.StatusAccepted, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// runImport validates and (unless it's a dry run) stores every row,
+// updating the import resource as it goes. ctx is checked between rows:
+// once it is cancelled the import stops and is marked as failed, so
+// pollers don't wait on it forever.
+func (a *applicationDependencies) runImport(ctx context.Context, imp *data.Import, rows importRowReader, mapping map[string]string) {
+	// A row that was started is finished, and the progress saved, even
+	// after ctx is cancelled.
+	work := context.WithoutCancel(ctx)
+
+	saveProgress := func() {
+		err := a.importModel.UpdateImport(work, imp)
+		if err != nil {
+			a.logger.ErrorContext(ctx, "saving import progress failed", "import_id", imp.ImportID, "error", err.Error())
+		}
+	}
+
+	addRowError := func(row int, errs map[string][]validator.Error) {
+		imp.FailedCount++
+		if len(imp.Errors) < importMaxRowErrors {
+			imp.Errors = append(imp.Errors, data.ImportRowError{Row: row, Errors: errs})
+		}
+	}
+
+	for rowNumber := 1; ; rowNumber++ {
+		if ctx.Err() != nil {
+			message := fmt.Sprintf("the import was interrupted after %d rows", imp.ProcessedRows)
+			imp.Message = &message
+			imp.Status = data.ImportFailed
+			saveProgress()
+			a.logger.WarnContext(ctx, "import interrupted", "import_id", imp.ImportID, "rows", imp.ProcessedRows)
+			return
+		}
+
+		values, err := rows.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var unreadable errRowUnreadable
+			if !errors.As(err, &unreadable) {
+				message := fmt.Sprintf("the upload could not be read: %s", err.Error())
+				imp.Message = &message
+				imp.Status = data.ImportFailed
+				saveProgress()
+				return
+			}
+			addRowError(rowNumber, map[string][]validator.Error{"row": {unreadable.detail}})
+		} else {
+			a.importRow(work, imp, rowNumber, values, mapping, addRowError)
+		}
+
+		imp.ProcessedRows++
+		if imp.ProcessedRows%importFlushEvery == 0 {
+			imp.TotalRows = max(imp.TotalRows, imp.ProcessedRows)
+			saveProgress()
+		}
+	}
+
+	imp.TotalRows = imp.ProcessedRows
+	imp.Status = data.ImportCompleted
+	saveProgress()
+
+	a.logger.InfoContext(ctx, "import finished", "import_id", imp.ImportID, "rows", imp.ProcessedRows,
+		"created", imp.CreatedCount, "updated", imp.UpdatedCount, "failed", imp.FailedCount, "dry_run", imp.DryRun)
+}
+
+func (a *applicationDependencies) importRow(ctx context.Context, imp *data.Import, rowNumber int, values map[string]string, mapping map[string]string, addRowError func(int, map[string][]validator.Error)) {
+	field := func(name string) string {
+		return strings.TrimSpace(values[mapping[name]])
+	}
+
+	externalRef := field("external_ref")
+	product := &data.Product{
+		Name:        field("name"),
+		Description: field("description"),
+		Category:    field("category"),
+		ImageURL:    field("image_url"),
+		Price:       field("price"),
+	}
+
+	v := validator.New()
+	data.ValidateProduct(v, product)
+	v.Field("external_ref", externalRef, validator.MaxLength(255))
+	if !v.IsEmpty() {
+		addRowError(rowNumber, v.Errors)
+		return
+	}
+
+	if imp.DryRun {
+		return
+	}
+
+	created := true
+	var err error
+	if externalRef == "" {
+		err = a.productModel.InsertProduct(ctx, product)
+	} else {
+		created, err = a.productModel.UpsertProductByExternalRef(ctx, externalRef, product)
+	}
+	if err != nil {
+		a.logger.ErrorContext(ctx, "importing row failed", "import_id", imp.ImportID, "row", rowNumber, "error", err.Error())
+		addRowError(rowNumber, map[string][]validator.Error{"row": {validator.NewError("row_not_saved")}})
+		return
+	}
+
+	if created {
+		imp.CreatedCount++
+		a.publishEvent(ctx, data.EventProductCreated, product.ProductID, product)
+	} else {
+		imp.UpdatedCount++
+		a.publishEvent(ctx, data.EventProductUpdated, product.ProductID, product)
+	}
+}
+
+func (a *applicationDependencies) displayImportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "iid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	imp, err := a.importModel.GetImport(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	for _, rowError := range imp.Errors {
+		localizeErrors(r, rowError.Errors)
+	}
+
+	data := envelope{
+		"import": imp,
+	}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,96 @@
+// Filename: cmd/api/import_test.go
+package main
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mtechguy/test2/internal/validator"
+)
+
+func TestImportRowReaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		upload string
+		// want holds, per row, either the values or the detail of why the
+		// row couldn't be read.
+		want []any
+	}{
+		{
+			name:   "csv",
+			format: "csv",
+			upload: "\ufeffname, price\nLamp,9.99\n\"Desk \"\"XL\"\"\",120.00\n",
+			want:   []any{map[string]string{"name": "Lamp", "price": "9.99"}, map[string]string{"name": `Desk "XL"`, "price": "120.00"}},
+		},
+		{
+			name:   "csv bad rows",
+			format: "csv",
+			upload: "name,price\nLamp\nDesk,\"12\"0\nChair,5.00\n",
+			want: []any{
+				validator.NewError("row_column_count"),
+				validator.NewError("row_malformed", "line", 3, "column", 9),
+				map[string]string{"name": "Chair", "price": "5.00"},
+			},
+		},
+		{
+			name:   "ndjson",
+			format: "ndjson",
+			upload: "{\"name\":\"Lamp\",\"price\":9.99,\"sale\":true,\"note\":null}\n\n[1]\n{\"tags\":[\"a\"]}\n",
+			want: []any{
+				map[string]string{"name": "Lamp", "price": "9.99", "sale": "true"},
+				validator.NewError("row_not_object"),
+				validator.NewError("row_value_type", "field", "tags"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rows importRowReader = newNDJSONRowReader(strings.NewReader(tt.upload))
+			if tt.format == "csv" {
+				csvRows, err := newCSVRowReader(strings.NewReader(tt.upload))
+				if err != nil {
+					t.Fatal(err)
+				}
+				rows = csvRows
+			}
+
+			for i, want := range tt.want {
+				values, err := rows.Next()
+				var got any = values
+				var unreadable errRowUnreadable
+				if errors.As(err, &unreadable) {
+					got = unreadable.detail
+				} else if err != nil {
+					t.Fatalf("row %d: %v", i+1, err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("row %d = %#v, want %#v", i+1, got, want)
+				}
+			}
+			if _, err := rows.Next(); !errors.Is(err, io.EOF) {
+				t.Errorf("after the last row: error = %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestCSVHeaderErrors(t *testing.T) {
+	tests := []struct {
+		upload string
+		want   validator.Error
+	}{
+		{"", validator.NewError("import_header_missing")},
+		{"name,\"price\n", validator.NewError("import_header_malformed", "line", 1, "column", 13)},
+	}
+	for _, tt := range tests {
+		_, err := newCSVRowReader(strings.NewReader(tt.upload))
+		var re *requestError
+		if !errors.As(err, &re) || !reflect.DeepEqual(re.detail, tt.want) {
+			t.Errorf("newCSVRowReader(%q) error = %v, want %+v", tt.upload, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Filename: cmd/api/jobs.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/mtechguy/test2/internal/data"
+	"github.com/mtechguy/test2/internal/jobs"
+)
+
+// registerJobs sets up the handlers for every kind of job the API runs.
+func (a *applicationDependencies) registerJobs() {
+	a.jobs.Register(jobs.KindRecomputeRating, a.recomputeRatingJob)
+	a.jobs.Register(jobs.KindPruneIdempotencyKeys, func(ctx context.Context, job *data.Job) error {
+		return a.pruneIdempotencyKeysJob(ctx, job.RunAt)
+	})
+}
+
+// scheduleJobs queues the recurring jobs that keep themselves going once
+// they have run for the first time.
+func (a *applicationDependencies) scheduleJobs(ctx context.Context) error {
+	return a.schedulePruneIdempotencyKeys(ctx, time.Now().Truncate(time.Hour).Add(time.Hour))
+}
+
+// recountRating queues a recount of the average rating of a product whose
+// reviews changed. The trigger on reviews updates the rating with each
+// write, but a product update saves the rating it read, which can undo a
+// review written meanwhile; the job puts it right. Failing to queue it is
+// logged but does not fail the request, ctx is its context.
+func (a *applicationDependencies) recountRating(ctx context.Context, productID int64) {
+	_, err := jobs.EnqueueRecomputeRating(context.WithoutCancel(ctx), a.jobModel, productID)
+	if err != nil {
+		a.logger.ErrorContext(ctx, "enqueueing rating recount failed", "product_id", productID, "error", err.Error())
+	}
+}
+
+func (a *applicationDependencies) recomputeRatingJob(ctx context.Context, job *data.Job) error {
+	var payload jobs.RecomputeRatingPayload
+	err := json.Unmarshal(job.Payload, &payload)
+	if err != nil {
+		return err
+	}
+
+	err = a.productModel.RecomputeAverageRating(ctx, payload.ProductID)
+	if errors.Is(err, data.ErrRecordNotFound) {
+		// The product was deleted in the meantime, nothing left to do
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+// Filename: cmd/api/logging.go
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/mtechguy/test2/internal/requestid"
+)
+
+// requestID gives every request an ID, the client's X-Request-ID when it
+// sent a usable one, so a request can be followed across services and
+// through the logs. The ID is returned in the response and added to every
+// line logged with the request's context.
+func (a *applicationDependencies) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+		w.Header().Set(requestid.Header, id)
+		next.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), id)))
+	})
+}
+
+// logRequest writes an access log line for every request once it has been
+// answered. The probes and metrics scrapes are logged at debug level, they
+// would drown out everything else. A response the handler cut short with a
+// panic, which recoverPanic only lets through for http.ErrAbortHandler, is
+// logged as aborted before the panic carries on to net/http.
+func (a *applicationDependencies) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		r, route := routeOf(r)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		defer func() {
+			err := recover()
+
+			level := slog.LevelInfo
+			if unlimitedPaths[r.URL.Path] {
+				level = slog.LevelDebug
+			}
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("uri", r.URL.RequestURI()),
+				slog.String("route", route.pattern),
+				slog.Int("status", recorder.status),
+				slog.Int64("bytes", recorder.bytes),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("client_ip", a.callerID(r)),
+				slog.String("user_agent", r.UserAgent()),
+			}
+			if err != nil {
+				level = slog.LevelWarn
+				attrs = append(attrs, slog.Bool("aborted", true))
+			}
+			a.logger.LogAttrs(r.Context(), level, "request", attrs...)
+
+			if err != nil {
+				panic(err)
+			}
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
@@ -0,0 +1,47 @@
+// Filename: cmd/api/logging_test.go
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestLogRequestAborted checks that a response cut short with
+// http.ErrAbortHandler is logged and counted, and that the panic still
+// reaches net/http.
+func TestLogRequestAborted(t *testing.T) {
+	var logs bytes.Buffer
+	a := newTestApplication(t)
+	a.logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	handler := a.logRequest(a.instrument(a.recoverPanic(withRoute("/v2/products/:pid", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic(http.ErrAbortHandler)
+	}))))
+
+	func() {
+		defer func() {
+			if err := recover(); err != http.ErrAbortHandler {
+				t.Errorf("recovered %v, want http.ErrAbortHandler", err)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v2/products/export", nil))
+	}()
+
+	line := logs.String()
+	for _, want := range []string{"level=WARN", "msg=request", "uri=/v2/products/export", "route=/v2/products/:pid", "status=200", "bytes=7", "aborted=true"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("log %q doesn't contain %s", line, want)
+		}
+	}
+
+	scrape := httptest.NewRecorder()
+	a.metrics.registry.Handler().ServeHTTP(scrape, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if want := `http_requests_total{method="GET",route="/v2/products/:pid",status="200"} 1`; !strings.Contains(scrape.Body.String(), want) {
+		t.Errorf("metrics don't contain %s:\n%s", want, scrape.Body)
+	}
+}
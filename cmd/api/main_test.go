@@ -0,0 +1,73 @@
+// Filename: cmd/api/main_test.go
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mtechguy/test2/internal/data"
+)
+
+// testDSNVariable names the environment variable holding the DSN of a
+// migrated database the tests may write to. The tests needing one are
+// skipped when it isn't set.
+const testDSNVariable = "PRODUCT_REVIEW_TEST_DB_DSN"
+
+// newTestApplication returns dependencies good enough to build the routes
+// and serve requests that don't reach the database.
+func newTestApplication(t *testing.T) *applicationDependencies {
+	t.Helper()
+	return &applicationDependencies{
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		events:   newEventBroker(),
+		metrics:  newAppMetrics(),
+		shutdown: context.Background(),
+	}
+}
+
+// newTestDatabaseApplication returns dependencies wired to the test
+// database, skipping the test when there is none.
+func newTestDatabaseApplication(t *testing.T) *applicationDependencies {
+	t.Helper()
+	dsn := os.Getenv(testDSNVariable)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNVariable)
+	}
+
+	a := newTestApplication(t)
+	a.config.db.dsn = dsn
+	a.config.db.maxIdleConns = 2
+	a.config.idempotency.ttl = time.Hour
+
+	db, err := openDB(a.config, a.metrics.observeQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		a.wg.Wait()
+		db.Close()
+	})
+
+	a.db = db
+	a.productModel = data.ProductModel{DB: db}
+	a.reviewModel = data.ReviewModel{DB: db}
+	a.webhookModel = data.WebhookModel{DB: db}
+	a.jobModel = data.JobModel{DB: db}
+	a.idempotencyModel = data.IdempotencyModel{DB: db}
+	a.migrationModel = data.MigrationModel{DB: db}
+	a.importModel = data.ImportModel{DB: db}
+	a.translationModel = data.ProductTranslationModel{DB: db}
+	return a
+}
+
+// testContext returns a context that ends with the test.
+func testContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
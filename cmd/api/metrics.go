@@ -0,0 +1,157 @@
+// Filename: cmd/api/metrics.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mtechguy/test2/internal/metrics"
+)
+
+// appMetrics are the metrics served at /metrics.
+type appMetrics struct {
+	registry *metrics.Registry
+
+	requests      *metrics.CounterVec
+	duration      *metrics.HistogramVec
+	inFlight      *metrics.GaugeVec
+	rateLimited   *metrics.CounterVec
+	panics        *metrics.CounterVec
+	queryDuration *metrics.HistogramVec
+}
+
+func newAppMetrics() *appMetrics {
+	r := metrics.NewRegistry()
+	return &appMetrics{
+		registry: r,
+		requests: r.Counter("http_requests_total",
+			"HTTP requests handled, by route pattern and status.", "method", "route", "status"),
+		duration: r.Histogram("http_request_duration_seconds",
+			"Time taken to handle HTTP requests, by route pattern.", metrics.DefaultBuckets, "method", "route"),
+		inFlight: r.Gauge("http_requests_in_flight",
+			"HTTP requests being handled."),
+		rateLimited: r.Counter("http_rate_limited_total",
+			"Requests turned away by the rate limiter."),
+		panics: r.Counter("http_panics_recovered_total",
+			"Panics in handlers recovered into a 500 response."),
+		queryDuration: r.Histogram("db_query_duration_seconds",
+			"Time taken by database statements, by their first keyword.", metrics.DefaultBuckets, "operation"),
+	}
+}
+
+// observeQuery records the duration of a database statement.
+func (m *appMetrics) observeQuery(operation string, d time.Duration) {
+	m.queryDuration.Observe(d.Seconds(), operation)
+}
+
+// registerPool adds the connection pool statistics of db, read when the
+// metrics are scraped.
+func (m *appMetrics) registerPool(db *sql.DB) {
+	stat := func(value func(s sql.DBStats) float64) func() float64 {
+		return func() float64 { return value(db.Stats()) }
+	}
+
+	m.registry.GaugeFunc("db_pool_max_open_connections", "Maximum open connections, 0 when unlimited.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	m.registry.GaugeFunc("db_pool_open_connections", "Open connections, in use or idle.",
+		stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	m.registry.GaugeFunc("db_pool_in_use_connections", "Connections in use.",
+		stat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	m.registry.GaugeFunc("db_pool_idle_connections", "Idle connections.",
+		stat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	m.registry.CounterFunc("db_pool_wait_count_total", "Times a request waited for a connection.",
+		stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	m.registry.CounterFunc("db_pool_wait_duration_seconds_total", "Time spent waiting for connections.",
+		stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	m.registry.CounterFunc("db_pool_max_idle_closed_total", "Connections closed because of db-max-idle-conns.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }))
+	m.registry.CounterFunc("db_pool_max_idle_time_closed_total", "Connections closed because of db-max-idle-time.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) }))
+	m.registry.CounterFunc("db_pool_max_lifetime_closed_total", "Connections closed because of db-max-lifetime.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }))
+}
+
+// unmatchedRoute labels requests that matched no route, or were answered
+// before reaching the router, so raw URLs never become label values.
+const unmatchedRoute = "unmatched"
+
+type routeContextKey struct{}
+
+// matchedRoute is filled in by the route a request reaches.
+type matchedRoute struct {
+	pattern string
+}
+
+// routeOf returns the route holder of r, adding one to its context when
+// it has none yet, so every middleware sees the same route.
+func routeOf(r *http.Request) (*http.Request, *matchedRoute) {
+	if route, ok := r.Context().Value(routeContextKey{}).(*matchedRoute); ok {
+		return r, route
+	}
+	route := &matchedRoute{pattern: unmatchedRoute}
+	return r.WithContext(context.WithValue(r.Context(), routeContextKey{}, route)), route
+}
+
+// withRoute records pattern as the route of the request, for instrument
+// and logRequest.
+func withRoute(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if route, ok := r.Context().Value(routeContextKey{}).(*matchedRoute); ok {
+			route.pattern = pattern
+		}
+		next(w, r)
+	}
+}
+
+// instrument counts and times every request by the pattern of the route it
+// matched, e.g. /v2/products/:pid.
+func (a *applicationDependencies) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		a.metrics.inFlight.Add(1)
+		defer a.metrics.inFlight.Add(-1)
+
+		r, route := routeOf(r)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		// Deferred, so a request cut short with http.ErrAbortHandler, which
+		// recoverPanic passes on to net/http, is still counted.
+		defer func() {
+			a.metrics.requests.Inc(r.Method, route.pattern, strconv.Itoa(recorder.status))
+			a.metrics.duration.Observe(time.Since(start).Seconds(), r.Method, route.pattern)
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+// statusRecorder remembers the status and size of a response. Unwrap lets
+// http.ResponseController reach the flushing and deadlines of the
+// underlying writer.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if !s.wroteHeader && status >= 200 {
+		s.status = status
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
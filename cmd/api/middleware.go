@@ -2,8 +2,10 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -17,6 +19,12 @@ func (a *applicationDependencies) recoverPanic(next http.Handler) http.Handler {
 			// recover() checks for panics
 			err := recover()
 			if err != nil {
+				// http.ErrAbortHandler is how a handler that has already
+				// started its response cuts it short; let net/http see it
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				a.metrics.panics.Inc()
 				w.Header().Set("Connection", "close")
 				a.serverErrorResponse(w, r, fmt.Errorf("%s", err))
 			}
@@ -25,6 +33,30 @@ func (a *applicationDependencies) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
+// requireAcceptable turns away requests that change data when none of the
+// formats in their Accept header can be rendered, before the change is
+// made. Reads are negotiated when the response is written.
+func (a *applicationDependencies) requireAcceptable(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			_, ok := negotiateFormat(r.Header.Get("Accept"), false)
+			if !ok {
+				w.Header().Add("Vary", "Accept")
+				err := a.writeNotAcceptable(w, r)
+				if err != nil {
+					a.logError(r, err)
+				}
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// unlimitedPaths are the routes of the probes and metrics, which aren't
+// rate limited.
+var unlimitedPaths = map[string]bool{"/livez": true, "/readyz": true, "/metrics": true}
+
 func (a *applicationDependencies) rateLimit(next http.Handler) http.Handler {
 
 	type client struct {
@@ -48,7 +80,10 @@ func (a *applicationDependencies) rateLimit(next http.Handler) http.Handler {
 		}
 	}()
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if a.config.limiter.enabled {
+		// Probes and scrapes come often and from few addresses, limiting
+		// them would take healthy servers out of rotation and leave gaps
+		// in the metrics
+		if a.config.limiter.enabled && !unlimitedPaths[r.URL.Path] {
 
 			ip, _, err := net.SplitHostPort(r.RemoteAddr)
 			if err != nil {
@@ -69,7 +104,12 @@ func (a *applicationDependencies) rateLimit(next http.Handler) http.Handler {
 			clients[ip].lastSeen = time.Now()
 
 			if !clients[ip].limiter.Allow() {
+				// Tell the client when its next token is due, in whole
+				// seconds as Retry-After requires.
+				wait := (1 - clients[ip].limiter.Tokens()) / a.config.limiter.rps
 				mu.Unlock()
+				a.metrics.rateLimited.Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(wait)))))
 				a.rateLimitExceededResponse(w, r)
 				return
 			}
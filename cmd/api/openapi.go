@@ -0,0 +1,725 @@
+// Filename: cmd/api/openapi.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mtechguy/test2/internal/data"
+	"github.com/mtechguy/test2/internal/requestid"
+	"github.com/mtechguy/test2/internal/validator"
+)
+
+// apiOperation describes one operation of the API for the OpenAPI
+// document. Most operations exist in v1 and v2 under different paths; the
+// v1 path is also described under its deprecated, unprefixed form.
+type apiOperation struct {
+	method      string
+	v1Path      string // empty when the operation is not in v1
+	v2Path      string // empty when the operation is not in v2
+	unversioned bool   // served at v1Path only, outside the versioned trees
+	id          string
+	summary     string
+	tag         string
+	query       []map[string]any
+	idempotent  bool // accepts an Idempotency-Key header
+
+	body      map[string]any // JSON request body
+	patchable bool           // the body may also be a merge patch or a JSON patch
+	media     map[string]any // request body content when it isn't JSON
+
+	status     int
+	envelope   string // key of the result in v1 responses
+	v2Envelope string // key of the result in v2, when not from v2EnvelopeKeys
+	result     map[string]any
+	paginated  bool           // the envelope also holds @metadata
+	content    map[string]any // response content when it isn't an envelope
+	errors     []int
+	others     map[int]map[string]any // further responses that aren't problems
+}
+
+// problemResponses names the shared error responses by status.
+var problemResponses = map[int]struct {
+	name        string
+	description string
+}{
+	http.StatusBadRequest:          {"BadRequest", "The request could not be read."},
+	http.StatusNotFound:            {"NotFound", "The resource does not exist."},
+	http.StatusNotAcceptable:       {"NotAcceptable", "None of the accepted formats can be produced."},
+	http.StatusConflict:            {"Conflict", "The request conflicts with the state of the resource."},
+	http.StatusUnprocessableEntity: {"ValidationFailed", "The request failed validation."},
+	http.StatusTooManyRequests:     {"RateLimitExceeded", "The client sent too many requests."},
+	http.StatusInternalServerError: {"InternalError", "The server could not process the request."},
+}
+
+func queryParameter(name string, description string, schema map[string]any) map[string]any {
+	return map[string]any{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"schema":      schema,
+	}
+}
+
+func stringSchema() map[string]any {
+	return map[string]any{"type": "string"}
+}
+
+func enumSchema(values ...string) map[string]any {
+	return map[string]any{"type": "string", "enum": values}
+}
+
+func pageParameters(defaultPageSize int) []map[string]any {
+	return []map[string]any{
+		queryParameter("page", "Page number.",
+			map[string]any{"type": "integer", "minimum": 1, "maximum": 500, "default": 1}),
+		queryParameter("page_size", "Number of records per page.",
+			map[string]any{"type": "integer", "minimum": 1, "maximum": 100, "default": defaultPageSize}),
+	}
+}
+
+func sortParameter(defaultSort string, safeList ...string) map[string]any {
+	schema := enumSchema(safeList...)
+	schema["default"] = defaultSort
+	return queryParameter("sort", "Field to sort by, descending when prefixed with -.", schema)
+}
+
+func fieldsParameter(safeList []string) map[string]any {
+	return queryParameter("fields",
+		"Comma separated fields to return, out of "+strings.Join(safeList, ", ")+"; all of them when absent.", stringSchema())
+}
+
+func localeParameter() map[string]any {
+	return queryParameter("locale",
+		"Translation to read, such as es or es-MX. Defaults to the Accept-Language header.", stringSchema())
+}
+
+func exportFormatParameter() map[string]any {
+	return queryParameter("format", "Export format. Defaults to the Accept header, then ndjson.", enumSchema("csv", "ndjson"))
+}
+
+func join(lists ...[]map[string]any) []map[string]any {
+	var joined []map[string]any
+	for _, list := range lists {
+		joined = append(joined, list...)
+	}
+	return joined
+}
+
+// apiOperations lists every operation routes() registers.
+func apiOperations(s *schemaBuilder) []apiOperation {
+	productSort := []string{"product_id", "name", "-product_id", "-name"}
+	reviewSort := []string{"review_id", "author", "-review_id", "-author"}
+	message := map[string]any{"type": "string"}
+	exportSchema := map[string]any{"type": "string", "description": "One row per line. An export that fails part way " +
+		`ends with an error record: {"error": {"code": "export_interrupted", ...}} in NDJSON, a single-field row in CSV.`}
+	ndjsonOrCSV := map[string]any{
+		"application/x-ndjson": map[string]any{"schema": exportSchema},
+		"text/csv":             map[string]any{"schema": exportSchema},
+	}
+	eventStream := map[string]any{
+		"text/event-stream": map[string]any{"schema": stringSchema()},
+	}
+
+	return []apiOperation{
+		{
+			method: http.MethodGet, v1Path: "/healthcheck", v2Path: "/healthcheck",
+			id: "healthcheck", summary: "Report the status of the service", tag: "health",
+			status: http.StatusOK,
+			content: map[string]any{"application/json": map[string]any{"schema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"status": stringSchema(),
+					"system_info": map[string]any{"type": "object", "properties": map[string]any{
+						"environment": stringSchema(),
+						"version":     stringSchema(),
+					}},
+				},
+			}}},
+		},
+		{
+			method: http.MethodGet, v1Path: "/openapi.json", unversioned: true,
+			id: "openapi", summary: "This OpenAPI document", tag: "health",
+			status:  http.StatusOK,
+			content: map[string]any{"application/json": map[string]any{"schema": map[string]any{"type": "object"}}},
+		},
+		{
+			method: http.MethodGet, v1Path: "/livez", unversioned: true,
+			id: "liveness", summary: "Report that the process is running", tag: "health",
+			status: http.StatusOK,
+			content: map[string]any{"application/json": map[string]any{"schema": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"status": enumSchema("alive")},
+			}}},
+		},
+		{
+			method: http.MethodGet, v1Path: "/readyz", unversioned: true,
+			id: "readiness", summary: "Report whether the service can take traffic, checking its dependencies", tag: "health",
+			status:  http.StatusOK,
+			content: readinessContent("ready", "degraded"),
+			others: map[int]map[string]any{http.StatusServiceUnavailable: {
+				"description": "A dependency is down or the service is shutting down.",
+				"content":     readinessContent("unavailable", "shutting_down"),
+			}},
+		},
+		{
+			method: http.MethodGet, v1Path: "/debug/db", unversioned: true,
+			id: "databasePoolStats", summary: "Report the state of the database connection pool", tag: "health",
+			status: http.StatusOK, envelope: "pool", result: ref("PoolStats"),
+		},
+		{
+			method: http.MethodGet, v1Path: "/metrics", unversioned: true,
+			id: "metrics", summary: "Expose metrics in the Prometheus text format", tag: "health",
+			status:  http.StatusOK,
+			content: map[string]any{"text/plain": map[string]any{"schema": stringSchema()}},
+		},
+
+		// Products
+		{
+			method: http.MethodGet, v1Path: "/product", v2Path: "/products",
+			id: "listProducts", summary: "List products", tag: "products",
+			query: join([]map[string]any{
+				queryParameter("name", "Full-text search on the name.", stringSchema()),
+				queryParameter("category", "Full-text search on the category.", stringSchema()),
+			}, pageParameters(10), []map[string]any{
+				sortParameter("product_id", productSort...),
+				fieldsParameter(data.ProductFieldSafeList),
+				localeParameter(),
+			}),
+			status: http.StatusOK, envelope: "products", result: arrayOf(ref("Product")), paginated: true,
+			errors: []int{http.StatusUnprocessableEntity},
+		},
+		{
+			method: http.MethodPost, v1Path: "/product", v2Path: "/products",
+			id: "createProduct", summary: "Create a product", tag: "products", idempotent: true,
+			body:   s.inputSchema("Product", true, "name", "description", "category", "image_url", "price"),
+			status: http.StatusCreated, envelope: "Product", result: ref("Product"),
+			errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity},
+		},
+		{
+			method: http.MethodPost, v1Path: "/product/bulk", v2Path: "/products/bulk",
+			id: "bulkProducts", summary: "Create, update and delete products in one request", tag: "products", idempotent: true,
+			body:   ref("BulkRequest"),
+			status: http.StatusOK, content: bulkContent(),
+			errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity},
+		},
+		{
+			method: http.MethodPost, v1Path: "/product/import", v2Path: "/products/import",
+			id: "importProducts", summary: "Start an import of products from CSV or NDJSON", tag: "products",
+			query: []map[string]any{
+				queryParameter("format", "Upload format. Defaults to the Content-Type header.", enumSchema("csv", "ndjson")),
+				queryParameter("mapping", "Comma separated field=column pairs.", stringSchema()),
+				queryParameter("dry_run", "Validate the rows without saving them.", map[string]any{"type": "boolean"}),
+			},
+			media:  ndjsonOrCSV,
+			status: http.StatusAccepted, envelope: "import", result: ref("Import"),
+			errors: []int{http.StatusBadRequest, http.StatusUnprocessableEntity},
+		},
+		{
+			method: http.MethodGet, v1Path: "/imports/:iid", v2Path: "/imports/:iid",
+			id: "displayImport", summary: "Show the progress of an import", tag: "products",
+			status: http.StatusOK, envelope: "import", result: ref("Import"),
+			errors: []int{http.StatusNotFound},
+		},
+		{
+			method: http.MethodGet, v1Path: "/product/:pid", v2Path: "/products/:pid",
+			id: "displayProduct", summary: "Show a product", tag: "products",
+			query: []map[string]any{
+				fieldsParameter(data.ProductFieldSafeList),
+				queryParameter("include", fmt.Sprintf("Comma separated related data to embed. "+
+					"reviews embeds the %d most recent reviews; the product's review list has all of them.", embeddedReviewLimit),
+					enumSchema("reviews", "rating_summary")),
+				localeParameter(),
+			},
+			status: http.StatusOK, envelope: "Product", result: ref("Product"),
+			errors: []int{http.StatusNotFound, http.StatusUnprocessableEntity},
+		},
+		{
+			method: http.MethodGet, v1Path: "/product/export", v2Path: "/products/export",
+			id: "exportProducts", summary: "Export products as CSV or NDJSON", tag: "products",
+			query: []map[string]any{
+				exportFormatParameter(),
+				queryParameter("name", "Full-text search on the name.", stringSchema()),
+				queryParameter("category", "Full-text search on the category.", stringSchema()),
+				sortParameter("product_id", productSort...),
+				fieldsParameter(data.ProductFieldSafeList),
+				localeParameter(),
+			},
+			status: http.StatusOK, content: ndjsonOrCSV,
+			errors: []int{http.StatusUnprocessableEntity},
+		},
+		{
+			method: http.MethodPatch, v1Path: "/product/:pid", v2Path: "/products/:pid",
+			id: "updateProduct", summary: "Update a product", tag: "products",
+			body:      s.inputSchema("Product", false, "name", "description", "category", "image_url", "price"),
+			patchable: true,
+			status:    http.StatusOK, envelope: "Product", result: ref("Product"),
+			errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity},
+		},
+		{
+			method: http.MethodDelete, v1Path: "/product/:pid", v2Path: "/products/:pid",
+			id: "deleteProduct", summary: "Delete a product", tag: "products",
+			status: http.StatusOK, envelope: "message", result: message,
+			errors: []int{http.StatusNotFound},
+		},
+		{
+			method: http.MethodGet, v1Path: "/product/:pid/translations", v2Path: "/products/:pid/translations",
+			id: "listProductTranslations", summary: "List the translations of a product", tag: "translations",
+			status: http.StatusOK, envelope: "translations", result: arrayOf(ref("ProductTranslation")),
+			errors: []int{http.StatusNotFound},
+		},
+		{
+			method: http.MethodGet, v1Path: "/product/:pid/translations/:locale", v2Path: "/products/:pid/translations/:locale",
+			id: "displayProductTranslation", summary: "Show a translation of a product", tag: "translations",
+			status: http.StatusOK, envelope: "translation", result: ref("ProductTranslation"),
+			errors: []int{http.StatusNotFound},
+		},
+		{
+			method: http.MethodPut, v1Path: "/product/:pid/translations/:locale", v2Path: "/products/:pid/translations/:locale",
+			id: "putProductTranslation", summary: "Add or replace a translation of a product", tag: "translations",
+			body:   s.inputSchema("ProductTranslation", true, "name", "description", "category"),
+			status: http.StatusOK, envelope: "translation", result: ref("ProductTranslation"),
+			errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity},
+		},
+		{
+			method: http.MethodDelete, v1Path: "/product/:pid/translations/:locale", v2Path: "/products/:pid/translations/:locale",
+			id: "deleteProductTranslation", summary: "Delete a translation of a product", tag: "translations",
+			status: http.StatusOK, envelope: "message", result: message,
+			errors: []int{http.StatusNotFound},
+		},
+
+		// Reviews
+		{
+			method: http.MethodGet, v1Path: "/review", v2Path: "/reviews",
+			id: "listReviews", summary: "List reviews", tag: "reviews",
+			query: join([]map[string]any{
+				queryParameter("author", "Full-text search on the author.", stringSchema()),
+			}, pageParameters(10), []map[string]any{
+				sortParameter("review_id", reviewSort...),
+				fieldsParameter(data.ReviewFieldSafeList),
+			}),
+			status: http.StatusOK, envelope: "Reviews", result: arrayOf(ref("Review")), paginated: true,
+			errors: []int{http.StatusUnprocessableEntity},
+		},
+		{
+			method: http.MethodPost, v1Path: "/review", v2Path: "/reviews",
+			id: "createReview", summary: "Create a review", tag: "reviews", idempotent: true,
+			body:   s.inputSchema("Review", true, "product_id", "author", "rating", "review_text", "helpful_count"),
+			status: http.StatusCreated, envelope: "Review", result: ref("Review"),
+			errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity},
+		},
+		{
+			method: http.MethodPost, v1Path: "/review/bulk", v2Path: "/reviews/bulk",
+			id: "bulkReviews", summary: "Create, update and delete reviews in one request", tag: "reviews", idempotent: true,
+			body:   ref("BulkRequest"),
+			status: http.StatusOK, content: bulkContent(),
+			errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity},
+		},
+		{
+			method: http.MethodGet, v1Path: "/review/:rid", v2Path: "/reviews/:rid",
+			id: "displayReview", summary: "Show a review", tag: "reviews",
+			query:  []map[string]any{fieldsParameter(data.ReviewFieldSafeList)},
+			status: http.StatusOK, envelope: "Review", result: ref("Review"),
+			errors: []int{http.StatusNotFound, http.StatusUnprocessableEntity},
+		},
+		{
+			method: http.MethodGet, v1Path: "/review/stream", v2Path: "/reviews/stream",
+			id: "streamReviews", summary: "Stream review events as Server-Sent Events", tag: "reviews",
+			status: http.StatusOK, content: eventStream,
+			errors: []int{http.StatusBadRequest},
+		},
+		{
+			method: http.MethodGet, v1Path: "/review/export", v2Path: "/reviews/export",
+			id: "exportReviews", summary: "Export reviews as CSV or NDJSON", tag: "reviews",
+			query: []map[string]any{
+				exportFormatParameter(),
+				queryParameter("author", "Full-text search on the author.", stringSchema()),
+				sortParameter("review_id", reviewSort...),
+				fieldsParameter(data.ReviewFieldSafeList),
+			},
+			status: http.StatusOK, content: ndjsonOrCSV,
+			errors: []int{http.StatusUnprocessableEntity},
+		},
+		{
+			method: http.MethodPatch, v1Path: "/review/:rid", v2Path: "/reviews/:rid",
+			id: "updateReview", summary: "Update a review", tag: "reviews",
+			body:      s.inputSchema("Review", false, "author", "rating", "review_text"),
+			patchable: true,
+			status:    http.StatusOK, envelope: "review", result: ref("Review"),
+			errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity},
+		},
+		{
+			method: http.MethodDelete, v1Path: "/review/:rid", v2Path: "/reviews/:rid",
+			id: "deleteReview", summary: "Delete a review", tag: "reviews",
+			status: http.StatusOK, envelope: "message", result: message,
+			errors: []int{http.StatusNotFound},
+		},
+		{
+			method: http.MethodGet, v1Path: "/product-review/:pid", v2Path: "/products/:pid/reviews",
+			id: "listProductReviews", summary: "List the reviews of a product", tag: "reviews",
+			query:  []map[string]any{fieldsParameter(data.ReviewFieldSafeList)},
+			status: http.StatusOK, envelope: "Review", v2Envelope: "reviews", result: arrayOf(ref("Review")),
+			errors: []int{http.StatusNotFound, http.StatusUnprocessableEntity},
+		},
+		{
+			method: http.MethodGet, v1Path: "/product/:pid/review/:rid", v2Path: "/products/:pid/reviews/:rid",
+			id: "displayProductReview", summary: "Show a review of a product", tag: "reviews",
+			query:  []map[string]any{fieldsParameter(data.ReviewFieldSafeList)},
+			status: http.StatusOK, envelope: "review", result: ref("Review"),
+			errors: []int{http.StatusNotFound, http.StatusUnprocessableEntity},
+		},
+		{
+			method: http.MethodGet, v1Path: "/product/:pid/review/stream", v2Path: "/products/:pid/reviews/stream",
+			id: "streamProductReviews", summary: "Stream the review events of a product", tag: "reviews",
+			status: http.StatusOK, content: eventStream,
+			errors: []int{http.StatusBadRequest, http.StatusNotFound},
+		},
+		{
+			method: http.MethodPatch, v1Path: "/helpful-count/:rid", v2Path: "/reviews/:rid/helpful",
+			id: "markReviewHelpful", summary: "Add one to the helpful count of a review", tag: "reviews",
+			status: http.StatusOK, envelope: "review", result: ref("Review"),
+			errors: []int{http.StatusNotFound},
+		},
+
+		// Webhooks
+		{
+			method: http.MethodGet, v1Path: "/webhooks", v2Path: "/webhooks",
+			id: "listWebhooks", summary: "List webhook subscriptions", tag: "webhooks",
+			query: join(pageParameters(10), []map[string]any{
+				sortParameter("webhook_id", "webhook_id", "url", "-webhook_id", "-url"),
+			}),
+			status: http.StatusOK, envelope: "webhooks", result: arrayOf(ref("Webhook")), paginated: true,
+			errors: []int{http.StatusUnprocessableEntity},
+		},
+		{
+			method: http.MethodPost, v1Path: "/webhooks", v2Path: "/webhooks",
+			id: "createWebhook", summary: "Subscribe to events", tag: "webhooks",
+			body:   s.inputSchema("Webhook", true, "url", "secret", "events", "active"),
+			status: http.StatusCreated, envelope: "webhook", result: ref("Webhook"),
+			errors: []int{http.StatusBadRequest, http.StatusUnprocessableEntity},
+		},
+		{
+			method: http.MethodGet, v1Path: "/webhooks/:wid", v2Path: "/webhooks/:wid",
+			id: "displayWebhook", summary: "Show a webhook subscription", tag: "webhooks",
+			status: http.StatusOK, envelope: "webhook", result: ref("Webhook"),
+			errors: []int{http.StatusNotFound},
+		},
+		{
+			method: http.MethodPatch, v1Path: "/webhooks/:wid", v2Path: "/webhooks/:wid",
+			id: "updateWebhook", summary: "Update a webhook subscription", tag: "webhooks",
+			body:   s.inputSchema("Webhook", false, "url", "secret", "events", "active"),
+			status: http.StatusOK, envelope: "webhook", result: ref("Webhook"),
+			errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity},
+		},
+		{
+			method: http.MethodDelete, v1Path: "/webhooks/:wid", v2Path: "/webhooks/:wid",
+			id: "deleteWebhook", summary: "Delete a webhook subscription", tag: "webhooks",
+			status: http.StatusOK, envelope: "message", result: message,
+			errors: []int{http.StatusNotFound},
+		},
+		{
+			method: http.MethodGet, v1Path: "/webhooks/:wid/deliveries", v2Path: "/webhooks/:wid/deliveries",
+			id: "listWebhookDeliveries", summary: "List the deliveries of a webhook", tag: "webhooks",
+			query: join([]map[string]any{
+				queryParameter("status", "Only deliveries with this status.",
+					enumSchema(data.DeliveryPending, data.DeliveryDelivered, data.DeliveryDead)),
+			}, pageParameters(20), []map[string]any{
+				sortParameter("-delivery_id", "delivery_id", "created_at", "-delivery_id", "-created_at"),
+			}),
+			status: http.StatusOK, envelope: "deliveries", result: arrayOf(ref("WebhookDelivery")), paginated: true,
+			errors: []int{http.StatusNotFound, http.StatusUnprocessableEntity},
+		},
+		{
+			method: http.MethodPost, v1Path: "/webhooks/:wid/deliveries/:did/retry", v2Path: "/webhooks/:wid/deliveries/:did/retry",
+			id: "retryWebhookDelivery", summary: "Deliver a dead-lettered delivery again", tag: "webhooks",
+			status: http.StatusAccepted, envelope: "delivery", result: ref("WebhookDelivery"),
+			errors: []int{http.StatusNotFound, http.StatusConflict},
+		},
+	}
+}
+
+func arrayOf(items map[string]any) map[string]any {
+	return map[string]any{"type": "array", "items": items}
+}
+
+func bulkContent() map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"mode":      enumSchema(bulkModeAtomic, bulkModePerItem),
+			"committed": map[string]any{"type": "boolean"},
+			"succeeded": map[string]any{"type": "integer"},
+			"failed":    map[string]any{"type": "integer"},
+			"results":   arrayOf(ref("BulkResult")),
+		},
+	}}}
+}
+
+// readinessContent describes the report of the readiness probe with one
+// of statuses.
+func readinessContent(statuses ...string) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": map[string]any{
+		"type":     "object",
+		"required": []string{"status"},
+		"properties": map[string]any{
+			"status": enumSchema(statuses...),
+			"checks": map[string]any{
+				"type":                 "object",
+				"additionalProperties": ref("DependencyCheck"),
+			},
+		},
+	}}}
+}
+
+// openAPIDocument describes the API as an OpenAPI 3.1 document.
+func (a *applicationDependencies) openAPIDocument() map[string]any {
+	s := newSchemaBuilder(map[string]any{
+		"Product":            data.Product{},
+		"Review":             data.Review{},
+		"ProductTranslation": data.ProductTranslation{},
+		"RatingSummary":      data.RatingSummary{},
+		"Metadata":           data.Metadata{},
+		"Webhook":            data.Webhook{},
+		"WebhookDelivery":    data.WebhookDelivery{},
+		"Import":             data.Import{},
+		"ImportRowError":     data.ImportRowError{},
+		"BulkRequest":        bulkRequest{},
+		"BulkResult":         bulkResult{},
+		"Problem":            problem{},
+		"FieldError":         fieldError{},
+		"ValidationError":    validator.Error{},
+		"PoolStats":          poolStats{},
+		"DependencyCheck":    dependencyCheck{},
+	})
+	// Rules checked in code rather than in validate tags.
+	webhookProperties := s.components["Webhook"].(map[string]any)["properties"].(map[string]any)
+	webhookProperties["url"].(map[string]any)["format"] = "uri"
+	webhookProperties["events"].(map[string]any)["items"] = enumSchema(data.WebhookEvents...)
+	s.components["Webhook"].(map[string]any)["required"] = []string{"url", "events"}
+	s.components["JSONPatch"] = arrayOf(map[string]any{
+		"type":     "object",
+		"required": []string{"op", "path"},
+		"properties": map[string]any{
+			"op":    enumSchema("add", "remove", "replace", "move", "copy", "test"),
+			"path":  stringSchema(),
+			"from":  stringSchema(),
+			"value": map[string]any{},
+		},
+	})
+
+	paths := make(map[string]any)
+	addOperation := func(path string, op apiOperation, id string, version int, deprecated bool) {
+		operations, found := paths[openAPIPath(path)].(map[string]any)
+		if !found {
+			operations = make(map[string]any)
+			paths[openAPIPath(path)] = operations
+		}
+		operations[strings.ToLower(op.method)] = op.describe(id, version, path, deprecated)
+	}
+
+	for _, op := range apiOperations(s) {
+		if op.unversioned {
+			addOperation(op.v1Path, op, op.id, 1, false)
+			continue
+		}
+		if op.v1Path != "" {
+			// The unprefixed health check is for load balancers and stays.
+			deprecated := op.v1Path != "/healthcheck"
+			addOperation(op.v1Path, op, "legacy"+exported(op.id), 1, deprecated)
+			addOperation("/v1"+op.v1Path, op, "v1"+exported(op.id), 1, false)
+		}
+		if op.v2Path != "" {
+			addOperation("/v2"+op.v2Path, op, "v2"+exported(op.id), 2, false)
+		}
+	}
+
+	problemContent := map[string]any{
+		"application/problem+json": map[string]any{"schema": ref("Problem")},
+		"application/problem+xml":  map[string]any{"schema": ref("Problem")},
+	}
+	responses := make(map[string]any)
+	for _, response := range problemResponses {
+		responses[response.name] = map[string]any{
+			"description": response.description,
+			"content":     problemContent,
+		}
+	}
+	responses[problemResponses[http.StatusTooManyRequests].name].(map[string]any)["headers"] = map[string]any{
+		"Retry-After": map[string]any{
+			"description": "How many seconds to wait before trying again.",
+			"schema":      map[string]any{"type": "integer"},
+		},
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":   "Product Review API",
+			"version": appVersion,
+			"description": "Products and their reviews. Errors are RFC 7807 problem details, " +
+				"localized from the Accept-Language header. The unprefixed routes are deprecated in favour of /v1.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas":   s.components,
+			"responses": responses,
+			"headers": map[string]any{
+				"Deprecation": map[string]any{
+					"description": "When the route was deprecated (RFC 9745).",
+					"schema":      stringSchema(),
+				},
+				"Sunset": map[string]any{
+					"description": "When the route will be removed (RFC 8594).",
+					"schema":      stringSchema(),
+				},
+				"RequestID": map[string]any{
+					"description": "The ID the request is logged under: the request's own " + requestid.Header +
+						" when it sent a usable one, otherwise a new one.",
+					"schema": stringSchema(),
+				},
+			},
+		},
+	}
+}
+
+// describe builds the OpenAPI operation object of op as served at path.
+func (op apiOperation) describe(id string, version int, path string, deprecated bool) map[string]any {
+	operation := map[string]any{
+		"operationId": id,
+		"summary":     op.summary,
+		"tags":        []string{op.tag},
+	}
+	if deprecated {
+		operation["deprecated"] = true
+	}
+
+	var parameters []map[string]any
+	for _, segment := range strings.Split(path, "/") {
+		name, isParam := strings.CutPrefix(segment, ":")
+		if !isParam {
+			continue
+		}
+		schema := map[string]any{"type": "integer", "format": "int64", "minimum": 1}
+		if name == "locale" {
+			schema = map[string]any{"type": "string", "pattern": "^[A-Za-z]{2,3}(-[A-Za-z]{2})?$"}
+		}
+		parameters = append(parameters, map[string]any{
+			"name": name, "in": "path", "required": true, "schema": schema,
+		})
+	}
+	parameters = append(parameters, op.query...)
+	if op.idempotent {
+		parameters = append(parameters, map[string]any{
+			"name":        idempotencyKeyHeader,
+			"in":          "header",
+			"description": "Makes the request safe to retry: the first response for a key is replayed to retries with the same body, format and language.",
+			"schema":      map[string]any{"type": "string", "maxLength": 255},
+		})
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+
+	switch {
+	case op.body != nil:
+		content := map[string]any{"application/json": map[string]any{"schema": op.body}}
+		if op.patchable {
+			content[mergePatchContentType] = map[string]any{"schema": op.body}
+			content[jsonPatchContentType] = map[string]any{"schema": ref("JSONPatch")}
+		}
+		operation["requestBody"] = map[string]any{"required": true, "content": content}
+	case op.media != nil:
+		operation["requestBody"] = map[string]any{"required": true, "content": op.media}
+	}
+
+	success := map[string]any{"description": http.StatusText(op.status)}
+	if op.content != nil {
+		success["content"] = op.content
+	} else {
+		success["content"] = op.envelopeContent(version)
+	}
+	headers := map[string]any{
+		requestid.Header: map[string]any{"$ref": "#/components/headers/RequestID"},
+	}
+	if deprecated {
+		headers["Deprecation"] = map[string]any{"$ref": "#/components/headers/Deprecation"}
+		headers["Sunset"] = map[string]any{"$ref": "#/components/headers/Sunset"}
+	}
+	success["headers"] = headers
+
+	responses := map[string]any{strconv.Itoa(op.status): success}
+	for status, response := range op.others {
+		responses[strconv.Itoa(status)] = response
+	}
+	for _, status := range append(op.errors, http.StatusNotAcceptable, http.StatusTooManyRequests, http.StatusInternalServerError) {
+		responses[strconv.Itoa(status)] = map[string]any{
+			"$ref": "#/components/responses/" + problemResponses[status].name,
+		}
+	}
+	operation["responses"] = responses
+
+	return operation
+}
+
+// envelopeContent describes the enveloped response of op in version.
+func (op apiOperation) envelopeContent(version int) map[string]any {
+	key := op.envelope
+	metadata := "@metadata"
+	if version >= 2 {
+		if v2Key, found := v2EnvelopeKeys[key]; found {
+			key = v2Key
+		}
+		if op.v2Envelope != "" {
+			key = op.v2Envelope
+		}
+		metadata = v2EnvelopeKeys[metadata]
+	}
+
+	properties := map[string]any{key: op.result}
+	if op.paginated {
+		properties[metadata] = ref("Metadata")
+	}
+	schema := map[string]any{"type": "object", "required": []string{key}, "properties": properties}
+
+	content := map[string]any{
+		"application/json": map[string]any{"schema": schema},
+		"application/xml":  map[string]any{"schema": schema},
+	}
+	if op.paginated {
+		content["text/csv"] = map[string]any{"schema": stringSchema()}
+	}
+	return content
+}
+
+// openAPIPath turns an httprouter path into an OpenAPI one: /product/:pid
+// becomes /product/{pid}.
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, isParam := strings.CutPrefix(segment, ":"); isParam {
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func exported(id string) string {
+	return strings.ToUpper(id[:1]) + id[1:]
+}
+
+// openAPIHandler serves the OpenAPI document.
+func openAPIHandler(document map[string]any) http.HandlerFunc {
+	body, err := json.MarshalIndent(document, "", "\t")
+	if err != nil {
+		panic(err)
+	}
+	body = append(body, '\n')
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}
+}
@@ -0,0 +1,166 @@
+// Filename: cmd/api/openapi_schema.go
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mtechguy/test2/internal/validator"
+)
+
+// schemaBuilder derives JSON Schemas for the OpenAPI document from the Go
+// types the handlers encode, so the document follows the code. Types given
+// a name are described once under components/schemas and referenced.
+type schemaBuilder struct {
+	names      map[reflect.Type]string
+	components map[string]any
+}
+
+func newSchemaBuilder(named map[string]any) *schemaBuilder {
+	b := &schemaBuilder{
+		names:      make(map[reflect.Type]string),
+		components: make(map[string]any),
+	}
+	for name, value := range named {
+		b.names[reflect.TypeOf(value)] = name
+	}
+	for t, name := range b.names {
+		b.components[name] = b.structSchema(t)
+	}
+	return b
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// ref returns a reference to the component schema called name.
+func ref(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+// schemaOf describes how a value of type t is encoded as JSON.
+func (b *schemaBuilder) schemaOf(t reflect.Type) map[string]any {
+	if name, found := b.names[t]; found {
+		return ref(name)
+	}
+
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := b.schemaOf(t.Elem())
+		if _, isRef := schema["$ref"]; isRef {
+			return map[string]any{"anyOf": []any{schema, map[string]any{"type": "null"}}}
+		}
+		if typ, ok := schema["type"].(string); ok {
+			schema["type"] = []string{typ, "null"}
+		}
+		return schema
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Float32:
+		return map[string]any{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]any{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": b.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schemaOf(t.Elem())}
+	case reflect.Struct:
+		return b.structSchema(t)
+	}
+	return map[string]any{}
+}
+
+// structSchema describes the JSON object of a struct, turning its validate
+// tags into the matching JSON Schema keywords.
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := b.schemaOf(field.Type)
+		for _, option := range strings.Split(field.Tag.Get("validate"), ",") {
+			rule, argument, _ := strings.Cut(option, "=")
+			n, _ := strconv.ParseFloat(argument, 64)
+			switch rule {
+			case "required":
+				required = append(required, name)
+			case "minlen":
+				schema["minLength"] = n
+			case "maxlen":
+				schema["maxLength"] = n
+			case "min":
+				schema["minimum"] = n
+			case "max":
+				schema["maximum"] = n
+			case "url":
+				schema["format"] = "uri"
+			case "email":
+				schema["format"] = "email"
+			case "oneof":
+				schema["enum"] = strings.Fields(argument)
+			case "unique":
+				schema["uniqueItems"] = true
+			}
+		}
+		properties[name] = schema
+	}
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// inputSchema describes a request body made of some of the properties of a
+// component schema. With required false every property is optional, as in
+// a partial update.
+func (b *schemaBuilder) inputSchema(component string, required bool, properties ...string) map[string]any {
+	source := b.components[component].(map[string]any)
+	sourceProperties := source["properties"].(map[string]any)
+	sourceRequired, _ := source["required"].([]string)
+
+	input := map[string]any{
+		"type":                 "object",
+		"properties":           map[string]any{},
+		"additionalProperties": false,
+	}
+	var inputRequired []string
+	for _, property := range properties {
+		input["properties"].(map[string]any)[property] = sourceProperties[property]
+		if required && validator.PermittedValue(property, sourceRequired...) {
+			inputRequired = append(inputRequired, property)
+		}
+	}
+	if len(inputRequired) > 0 {
+		input["required"] = inputRequired
+	}
+	return input
+}
@@ -0,0 +1,34 @@
+// Filename: cmd/api/openapi_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestRoutesDescribed checks that every registered route is described in
+// the OpenAPI document, and that the document describes nothing the router
+// doesn't serve.
+func TestRoutesDescribed(t *testing.T) {
+	a := newTestApplication(t)
+	_, registered := a.router()
+	paths := a.openAPIDocument()["paths"].(map[string]any)
+
+	served := make(map[[2]string]bool)
+	for _, route := range registered {
+		method, path := strings.ToLower(route[0]), openAPIPath(route[1])
+		served[[2]string{method, path}] = true
+		operations, _ := paths[path].(map[string]any)
+		if _, ok := operations[method]; !ok {
+			t.Errorf("%s %s is registered but not described in apiOperations", route[0], route[1])
+		}
+	}
+
+	for path, item := range paths {
+		for method := range item.(map[string]any) {
+			if !served[[2]string{method, path}] {
+				t.Errorf("%s %s is described but not registered", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Filename: cmd/api/patch.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/mtechguy/test2/internal/jsonpatch"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// errPatchNotApplicable is returned when a patch is well formed but can't
+// be applied to the current record.
+var errPatchNotApplicable = errors.New("the patch cannot be applied to this resource")
+
+// readPatch applies a merge patch or JSON patch request body to document,
+// which must be a pointer to a struct holding the record's patchable
+// fields. handled is false for any other content type, in which case the
+// body is left unread for the plain JSON update.
+func (a *applicationDependencies) readPatch(w http.ResponseWriter, r *http.Request, document any) (handled bool, err error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != mergePatchContentType && mediaType != jsonPatchContentType {
+		return false, nil
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 256_000)
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return true, newRequestError("body_too_large", "max", maxBytesError.Limit)
+		}
+		return true, err
+	}
+	if len(bytes.TrimSpace(patch)) == 0 {
+		return true, newRequestError("body_empty")
+	}
+
+	current, err := json.Marshal(document)
+	if err != nil {
+		return true, err
+	}
+
+	var patched []byte
+	if mediaType == mergePatchContentType {
+		patched, err = jsonpatch.MergePatch(current, patch)
+	} else {
+		patched, err = jsonpatch.Apply(current, patch)
+	}
+	if err != nil {
+		return true, err
+	}
+
+	// Members the patch removed must come back as zero values rather than
+	// keep their old contents.
+	reflect.ValueOf(document).Elem().SetZero()
+
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(document)
+	if err != nil {
+		var unmarshalTypeError *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+			return true, fmt.Errorf("%w: %w", errPatchNotApplicable,
+				newRequestError("patch_field_type", "field", unmarshalTypeError.Field))
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			if unquoted, err := strconv.Unquote(fieldName); err == nil {
+				fieldName = unquoted
+			}
+			return true, fmt.Errorf("%w: %w", errPatchNotApplicable,
+				newRequestError("patch_unknown_field", "field", fieldName))
+		default:
+			return true, fmt.Errorf("%w: %w", errPatchNotApplicable, newRequestError("patch_not_object"))
+		}
+	}
+
+	return true, nil
+}
+
+// patchErrorResponse reports an error from readPatch: a failed test
+// operation is a conflict with the current state, a patch that doesn't fit
+// the record is unprocessable and anything else is a bad request.
+func (a *applicationDependencies) patchErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, jsonpatch.ErrTestFailed):
+		a.patchConflictResponse(w, r, err)
+	case errors.Is(err, jsonpatch.ErrPathNotFound), errors.Is(err, errPatchNotApplicable):
+		a.patchNotApplicableResponse(w, r, err)
+	default:
+		a.badRequestResponse(w, r, err)
+	}
+}
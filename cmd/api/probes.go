@@ -0,0 +1,128 @@
+// Filename: cmd/api/probes.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mtechguy/test2/internal/data"
+)
+
+// probeTimeout bounds each dependency check of the readiness probe, so a
+// hanging database makes the probe fail rather than time out.
+const probeTimeout = 2 * time.Second
+
+// Statuses of a dependency checked by the readiness probe.
+const (
+	dependencyUp       = "up"
+	dependencyDegraded = "degraded" // usable, but something needs looking at
+	dependencyDown     = "down"
+)
+
+// dependencyCheck is the outcome of checking one dependency.
+type dependencyCheck struct {
+	Status     string  `json:"status"`
+	DurationMS float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+	Version    *int64  `json:"version,omitempty"`  // migrations only
+	Expected   *int64  `json:"expected,omitempty"` // migrations only
+}
+
+// livenessHandler reports that the process is running and serving
+// requests. It doesn't look at dependencies: restarting the server
+// wouldn't bring the database back.
+func (a *applicationDependencies) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	err := a.writeResponse(w, r, http.StatusOK, envelope{"status": "alive"}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// readinessHandler reports whether the server should get traffic. It
+// fails with a 503 once shutdown has started, so load balancers stop
+// sending requests before the server stops accepting them, and whenever a
+// dependency is down.
+func (a *applicationDependencies) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	if a.shuttingDown.Load() {
+		err := a.writeResponse(w, r, http.StatusServiceUnavailable, envelope{"status": "shutting_down"}, nil)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	checks := map[string]dependencyCheck{}
+	checks["database"] = a.checkDatabase(r.Context())
+	if checks["database"].Status == dependencyDown {
+		checks["migrations"] = dependencyCheck{Status: dependencyDown, Error: "database unavailable"}
+	} else {
+		checks["migrations"] = a.checkMigrations(r.Context())
+	}
+
+	status, code := "ready", http.StatusOK
+	for name, check := range checks {
+		switch check.Status {
+		case dependencyDown:
+			status, code = "unavailable", http.StatusServiceUnavailable
+		case dependencyDegraded:
+			if code == http.StatusOK {
+				status = "degraded"
+			}
+		}
+		if check.Status != dependencyUp {
+			a.logger.WarnContext(r.Context(), "readiness check", "dependency", name, "status", check.Status, "error", check.Error)
+		}
+	}
+
+	err := a.writeResponse(w, r, code, envelope{"status": status, "checks": checks}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkDatabase pings the database.
+func (a *applicationDependencies) checkDatabase(ctx context.Context) dependencyCheck {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := a.db.PingContext(ctx)
+	check := dependencyCheck{Status: dependencyUp, DurationMS: milliseconds(time.Since(start))}
+	if err != nil {
+		check.Status, check.Error = dependencyDown, err.Error()
+	}
+	return check
+}
+
+// checkMigrations compares the schema of the database to the one the code
+// expects. A schema behind the code, or a migration that failed halfway,
+// breaks queries. A schema ahead of it happens during rolling deploys, when
+// the new version has migrated the database before the old one is gone.
+func (a *applicationDependencies) checkMigrations(ctx context.Context) dependencyCheck {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	version, dirty, err := a.migrationModel.Version(ctx)
+	expected := int64(data.SchemaVersion)
+	check := dependencyCheck{Status: dependencyUp, DurationMS: milliseconds(time.Since(start)), Expected: &expected}
+	switch {
+	case err != nil:
+		check.Status, check.Error = dependencyDown, err.Error()
+		return check
+	case dirty:
+		check.Status, check.Error = dependencyDown, fmt.Sprintf("migration %d failed and must be fixed by hand", version)
+	case version < expected:
+		check.Status, check.Error = dependencyDown, fmt.Sprintf("migrations up to %d have not been applied", expected)
+	case version > expected:
+		check.Status, check.Error = dependencyDegraded, "the database has been migrated by a newer version of the API"
+	}
+	check.Version = &version
+	return check
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
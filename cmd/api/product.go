@@ -47,24 +47,31 @@ func (a *applicationDependencies) createProductHandler(w http.ResponseWriter, r
 		return
 	}
 
-	err = a.productModel.InsertProduct(product)
+	err = a.productModel.InsertProduct(r.Context(), product)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
+	a.publishEvent(r.Context(), data.EventProductCreated, product.ProductID, product)
 
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("products/%d", product.ProductID))
+	headers.Set("Location", versionedLocation(r,
+		fmt.Sprintf("/product/%d", product.ProductID),
+		fmt.Sprintf("/products/%d", product.ProductID)))
 
 	data := envelope{
 		"Product": product,
 	}
-	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	err = a.writeResponse(w, r, http.StatusCreated, data, headers)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
 }
 
+// embeddedReviewLimit caps the reviews embedded with ?include=reviews to
+// the most recent ones; the product's review list has all of them.
+const embeddedReviewLimit = 10
+
 func (a *applicationDependencies) displayProductHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := a.readIDParam(r, "pid")
 	if err != nil {
@@ -72,21 +79,67 @@ func (a *applicationDependencies) displayProductHandler(w http.ResponseWriter, r
 		return
 	}
 
-	product, err := a.productModel.GetProduct(id)
+	queryParameters := r.URL.Query()
+	fields := a.getMultipleQueryParameters(queryParameters, "fields", nil)
+	include := a.getMultipleQueryParameters(queryParameters, "include", nil)
+
+	v := validator.New()
+	locales := a.contentLocales(r, v)
+	data.ValidateFields(v, fields, data.ProductFieldSafeList)
+	for _, relation := range include {
+		v.Check(validator.PermittedValue(relation, "reviews", "rating_summary"), "include",
+			"one_of", "values", "reviews, rating_summary")
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	product, err := a.productModel.GetLocalizedProduct(r.Context(), id, locales, fields...)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			a.notFoundResponse(w, r)
+			a.productNotFoundResponse(w, r, id)
 		default:
 			a.serverErrorResponse(w, r, err)
 		}
 		return
 	}
+	setContentLanguage(w, product.Locale)
+
+	res, err := newResource(product, fields)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Embed the related data that was asked for
+	for _, relation := range include {
+		switch relation {
+		case "reviews":
+			reviews, err := a.reviewModel.GetLatestProductReviews(r.Context(), id, embeddedReviewLimit)
+			if err != nil {
+				a.serverErrorResponse(w, r, err)
+				return
+			}
+			if reviews == nil {
+				reviews = []data.Review{}
+			}
+			res.embed("reviews", reviews)
+		case "rating_summary":
+			summary, err := a.reviewModel.GetRatingSummary(r.Context(), id)
+			if err != nil {
+				a.serverErrorResponse(w, r, err)
+				return
+			}
+			res.embed("rating_summary", summary)
+		}
+	}
 
 	data := envelope{
-		"Product": product,
+		"Product": res,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -99,16 +152,32 @@ func (a *applicationDependencies) updateProductHandler(w http.ResponseWriter, r
 		return
 	}
 
-	product, err := a.productModel.GetProduct(id)
+	product, err := a.productModel.GetProduct(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
-			a.notFoundResponse(w, r)
+			a.productNotFoundResponse(w, r, id)
 		} else {
 			a.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
+	// Merge patches and JSON patches are applied to the fields a client
+	// may change
+	patchDocument := struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Category    string `json:"category"`
+		ImageURL    string `json:"image_url"`
+		Price       string `json:"price"`
+	}{product.Name, product.Description, product.Category, product.ImageURL, product.Price}
+
+	patched, err := a.readPatch(w, r, &patchDocument)
+	if err != nil {
+		a.patchErrorResponse(w, r, err)
+		return
+	}
+
 	var incomingProductData struct {
 		Name        *string `json:"name"`
 		Description *string `json:"description"`
@@ -119,10 +188,18 @@ func (a *applicationDependencies) updateProductHandler(w http.ResponseWriter, r
 		// AverageRating *float64   `json:"average_rating"`
 	}
 
-	err = a.readJSON(w, r, &incomingProductData)
-	if err != nil {
-		a.badRequestResponse(w, r, err)
-		return
+	if patched {
+		product.Name = patchDocument.Name
+		product.Description = patchDocument.Description
+		product.Category = patchDocument.Category
+		product.ImageURL = patchDocument.ImageURL
+		product.Price = patchDocument.Price
+	} else {
+		err = a.readJSON(w, r, &incomingProductData)
+		if err != nil {
+			a.badRequestResponse(w, r, err)
+			return
+		}
 	}
 
 	if incomingProductData.Name != nil {
@@ -154,16 +231,17 @@ func (a *applicationDependencies) updateProductHandler(w http.ResponseWriter, r
 		return
 	}
 
-	err = a.productModel.UpdateProduct(product)
+	err = a.productModel.UpdateProduct(r.Context(), product)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
+	a.publishEvent(r.Context(), data.EventProductUpdated, product.ProductID, product)
 
 	data := envelope{
 		"Product": product,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -176,21 +254,22 @@ func (a *applicationDependencies) deleteProductHandler(w http.ResponseWriter, r
 		return
 	}
 
-	err = a.productModel.DeleteProduct(id)
+	err = a.productModel.DeleteProduct(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			a.PIDnotFound(w, r, id)
+			a.productNotFoundResponse(w, r, id)
 		default:
 			a.serverErrorResponse(w, r, err)
 		}
 		return
 	}
+	a.publishEvent(r.Context(), data.EventProductDeleted, id, envelope{"product_id": id})
 
 	data := envelope{
 		"message": "Product successfully deleted",
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -212,14 +291,18 @@ func (a *applicationDependencies) listProductHandler(w http.ResponseWriter, r *h
 	queryParametersData.Filters.PageSize = a.getSingleIntegerParameter(queryParameters, "page_size", 10, v)
 	queryParametersData.Filters.Sort = a.getSingleQueryParameter(queryParameters, "sort", "product_id")
 	queryParametersData.Filters.SortSafeList = []string{"product_id", "name", "-product_id", "-name"}
+	queryParametersData.Filters.Fields = a.getMultipleQueryParameters(queryParameters, "fields", nil)
+	queryParametersData.Filters.Locales = a.contentLocales(r, v)
 
 	data.ValidateFilters(v, queryParametersData.Filters)
+	data.ValidateFields(v, queryParametersData.Filters.Fields, data.ProductFieldSafeList)
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
 	products, metadata, err := a.productModel.GetAllProducts(
+		r.Context(),
 		queryParametersData.Name,
 		queryParametersData.Category,
 		queryParametersData.Filters,
@@ -228,11 +311,19 @@ func (a *applicationDependencies) listProductHandler(w http.ResponseWriter, r *h
 		a.serverErrorResponse(w, r, err)
 		return
 	}
+	// Products can come in different languages, so only the Vary header
+	// applies to the whole list.
+	setContentLanguage(w, "")
+	list, err := selectFields(products, queryParametersData.Filters.Fields)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
 	data := envelope{
-		"products":  products,
+		"products":  list,
 		"@metadata": metadata,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,366 @@
+// Filename: cmd/api/render.go
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// responseFormat is a representation the API can render a response in.
+type responseFormat int
+
+const (
+	formatJSON responseFormat = iota
+	formatCompactJSON
+	formatXML
+	formatCSV
+)
+
+// errNotTabular is returned when CSV is asked for but the response has no
+// list to turn into rows.
+var errNotTabular = errors.New("response cannot be represented as CSV")
+
+// negotiateFormat picks the best format for an Accept header, honouring
+// q-values. On a tie the server's order of preference (JSON, XML, CSV)
+// wins. An empty header means JSON. ok is false when nothing in the header
+// can be served.
+func negotiateFormat(accept string, allowCSV bool) (format responseFormat, ok bool) {
+	if strings.TrimSpace(accept) == "" {
+		return formatJSON, true
+	}
+
+	bestQ := 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if value, found := params["q"]; found {
+			q, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		var candidate responseFormat
+		switch mediaType {
+		case "application/json", "application/*", "*/*":
+			candidate = formatJSON
+			if params["pretty"] == "false" {
+				candidate = formatCompactJSON
+			}
+		case "application/xml", "text/xml":
+			candidate = formatXML
+		case "text/csv":
+			if !allowCSV {
+				continue
+			}
+			candidate = formatCSV
+		default:
+			continue
+		}
+
+		if q > bestQ || (q == bestQ && candidate < format) {
+			bestQ = q
+			format = candidate
+			ok = true
+		}
+	}
+
+	return format, ok
+}
+
+// writeResponse renders data in the format negotiated from the request's
+// Accept header: tab-indented JSON (the default), compact JSON
+// (application/json; pretty=false), XML, or CSV for responses holding a
+// list. A format the response can't be rendered in gets a 406.
+func (a *applicationDependencies) writeResponse(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	w.Header().Add("Vary", "Accept")
+
+	format, ok := negotiateFormat(r.Header.Get("Accept"), r.Method == http.MethodGet)
+	if !ok {
+		return a.writeNotAcceptable(w, r)
+	}
+
+	return a.render(w, r, format, status, versionedEnvelope(r, data), headers)
+}
+
+// render writes data in the given format.
+func (a *applicationDependencies) render(w http.ResponseWriter, r *http.Request, format responseFormat, status int, data envelope, headers http.Header) error {
+	var body []byte
+	var contentType string
+	var err error
+
+	switch format {
+	case formatCompactJSON:
+		body, err = json.Marshal(data)
+		body = append(body, '\n')
+		contentType = "application/json"
+	case formatXML:
+		body, err = renderXML(data)
+		contentType = "application/xml; charset=utf-8"
+	case formatCSV:
+		body, err = renderCSV(data)
+		if errors.Is(err, errNotTabular) {
+			return a.writeNotAcceptable(w, r)
+		}
+		contentType = "text/csv; charset=utf-8"
+	default:
+		return a.writeJSON(w, status, data, headers)
+	}
+	if err != nil {
+		return err
+	}
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+	w.Header().Set("Content-Type", contentType)
+
+	w.WriteHeader(status)
+	_, err = w.Write(body)
+	return err
+}
+
+// writeNotAcceptable answers with a 406 problem in JSON, which every client
+// can read even if it didn't ask for it.
+func (a *applicationDependencies) writeNotAcceptable(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Add("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", requestLanguage(r))
+	return writeProblem(w, formatJSON, newProblem(r, http.StatusNotAcceptable, "not_acceptable", nil))
+}
+
+// toGeneric turns data into plain maps, slices and scalars by way of its
+// JSON encoding, so the XML and CSV renderers see the same field names and
+// omissions as JSON clients do.
+func toGeneric(data any) (any, error) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic any
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+	err = dec.Decode(&generic)
+	return generic, err
+}
+
+// xmlName turns a JSON key into a valid XML element name, e.g. "@metadata"
+// becomes "metadata".
+func xmlName(key string) string {
+	var b strings.Builder
+	for i, c := range key {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+			b.WriteRune(c)
+		case (c >= '0' && c <= '9') || c == '-' || c == '.':
+			if i > 0 && b.Len() > 0 {
+				b.WriteRune(c)
+			}
+		}
+	}
+	if b.Len() == 0 {
+		return "value"
+	}
+	return b.String()
+}
+
+func renderXML(data envelope) ([]byte, error) {
+	generic, err := toGeneric(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "\t")
+
+	err = encodeXMLElement(enc, "response", generic)
+	if err != nil {
+		return nil, err
+	}
+	err = enc.Flush()
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
+
+// encodeXMLElement writes value as an element called name. Objects become
+// child elements (in key order), arrays repeat an <item> element and nulls
+// are marked with nil="true".
+func encodeXMLElement(enc *xml.Encoder, name string, value any) error {
+	start := xml.StartElement{Name: xml.Name{Local: xmlName(name)}}
+
+	switch value := value.(type) {
+	case map[string]any:
+		err := enc.EncodeToken(start)
+		if err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			err = encodeXMLElement(enc, key, value[key])
+			if err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case []any:
+		err := enc.EncodeToken(start)
+		if err != nil {
+			return err
+		}
+		for _, item := range value {
+			err = encodeXMLElement(enc, "item", item)
+			if err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case nil:
+		start.Attr = []xml.Attr{{Name: xml.Name{Local: "nil"}, Value: "true"}}
+		return enc.EncodeElement("", start)
+	default:
+		return enc.EncodeElement(fmt.Sprint(value), start)
+	}
+}
+
+// renderCSV writes the list held by the envelope (e.g. "products") as CSV
+// with one column per field of the first row. Nested values are written as
+// JSON. Envelopes without exactly one list can't be rendered.
+func renderCSV(data envelope) ([]byte, error) {
+	var list any
+	lists := 0
+	for key, value := range data {
+		if strings.HasPrefix(key, "@") {
+			continue
+		}
+		generic, err := toGeneric(value)
+		if err != nil {
+			return nil, err
+		}
+		if _, isList := generic.([]any); isList {
+			list = value
+			lists++
+		}
+	}
+	if lists != 1 {
+		return nil, errNotTabular
+	}
+
+	// Decode the rows again keeping the field order, which the columns
+	// follow.
+	js, err := json.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+	var rows []json.RawMessage
+	err = json.Unmarshal(js, &rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	var columns []string
+	for i, raw := range rows {
+		keys, values, err := orderedObject(raw)
+		if err != nil {
+			return nil, errNotTabular
+		}
+		if i == 0 {
+			columns = keys
+			err = writer.Write(columns)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		record := make([]string, len(columns))
+		for j, column := range columns {
+			record[j] = csvValue(values[column])
+		}
+		err = writer.Write(record)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// orderedObject decodes a JSON object, returning its keys in the order they
+// appear along with the raw values.
+func orderedObject(raw json.RawMessage) ([]string, map[string]json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	token, err := dec.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, nil, errNotTabular
+	}
+
+	var keys []string
+	values := make(map[string]json.RawMessage)
+	for dec.More() {
+		token, err = dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key := token.(string)
+
+		var value json.RawMessage
+		err = dec.Decode(&value)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+		values[key] = value
+	}
+
+	_, err = dec.Token()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, err
+	}
+	return keys, values, nil
+}
+
+// csvValue writes strings without their quotes, null as an empty cell and
+// anything else as its JSON text.
+func csvValue(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
@@ -41,18 +41,18 @@ func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *
 
 	// Check if product_id is provided
 	if incomingReviewData.ProductID == nil {
-		a.badRequestResponse(w, r, errors.New("product_id is required"))
+		a.badRequestResponse(w, r, newRequestError("body_missing_field", "field", "product_id"))
 		return
 	}
 
 	// Check if the product exists in the database
-	exists, err := a.productModel.ProductExists(*incomingReviewData.ProductID)
+	exists, err := a.productModel.ProductExists(r.Context(), *incomingReviewData.ProductID)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
 	if !exists {
-		a.PRIDnotFound(w, r, *incomingReviewData.ProductID) // Respond with a 404 if product is not found
+		a.productNotFoundResponse(w, r, *incomingReviewData.ProductID) // Respond with a 404 if product is not found
 		return
 	}
 
@@ -81,20 +81,24 @@ func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *
 	}
 
 	// Insert the review into the database
-	err = a.reviewModel.InsertReview(review)
+	err = a.reviewModel.InsertReview(r.Context(), review)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
+	a.publishEvent(r.Context(), data.EventReviewCreated, review.ProductID, review)
+	a.recountRating(r.Context(), review.ProductID)
 
 	// Set a Location header. The path to the newly created review
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/reviews/%d", review.ReviewID))
+	headers.Set("Location", versionedLocation(r,
+		fmt.Sprintf("/review/%d", review.ReviewID),
+		fmt.Sprintf("/reviews/%d", review.ReviewID)))
 
 	data := envelope{
 		"Review": review,
 	}
-	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	err = a.writeResponse(w, r, http.StatusCreated, data, headers)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -111,23 +115,38 @@ func (a *applicationDependencies) displayReviewHandler(w http.ResponseWriter, r
 		return
 	}
 
+	fields := a.getMultipleQueryParameters(r.URL.Query(), "fields", nil)
+	v := validator.New()
+	data.ValidateFields(v, fields, data.ReviewFieldSafeList)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	// Call Get() to retrieve the comment with the specified id
-	review, err := a.reviewModel.GetReview(id)
+	review, err := a.reviewModel.GetReview(r.Context(), id, fields...)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			a.notFoundResponse(w, r)
+			a.reviewNotFoundResponse(w, r, id)
 		default:
 			a.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
+	// keep only the fields that were asked for
+	res, err := newResource(review, fields)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
 	// display the comment
 	data := envelope{
-		"Review": review,
+		"Review": res,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -144,16 +163,29 @@ func (a *applicationDependencies) updateReviewHandler(w http.ResponseWriter, r *
 	}
 
 	// Retrieve the review from the database
-	review, err := a.reviewModel.GetReview(id)
+	review, err := a.reviewModel.GetReview(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
-			a.notFoundResponse(w, r)
+			a.reviewNotFoundResponse(w, r, id)
 		} else {
 			a.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
+	// Apply a merge patch or JSON patch to the fields a client may change
+	patchDocument := struct {
+		Author     string `json:"author"`
+		Rating     int64  `json:"rating"`
+		ReviewText string `json:"review_text"`
+	}{review.Author, review.Rating, review.ReviewText}
+
+	patched, err := a.readPatch(w, r, &patchDocument)
+	if err != nil {
+		a.patchErrorResponse(w, r, err)
+		return
+	}
+
 	// Define a struct to hold incoming JSON data
 	var incomingReviewData struct {
 		Author     *string `json:"author"`
@@ -161,11 +193,17 @@ func (a *applicationDependencies) updateReviewHandler(w http.ResponseWriter, r *
 		ReviewText *string `json:"review_text"` // non-null text field
 	}
 
-	// Decode the incoming JSON into the struct
-	err = a.readJSON(w, r, &incomingReviewData)
-	if err != nil {
-		a.badRequestResponse(w, r, err)
-		return
+	if patched {
+		review.Author = patchDocument.Author
+		review.Rating = patchDocument.Rating
+		review.ReviewText = patchDocument.ReviewText
+	} else {
+		// Decode the incoming JSON into the struct
+		err = a.readJSON(w, r, &incomingReviewData)
+		if err != nil {
+			a.badRequestResponse(w, r, err)
+			return
+		}
 	}
 
 	// Update the fields if provided in the incoming JSON
@@ -188,17 +226,19 @@ func (a *applicationDependencies) updateReviewHandler(w http.ResponseWriter, r *
 	}
 
 	// Update the review in the database
-	err = a.reviewModel.UpdateReview(review)
+	err = a.reviewModel.UpdateReview(r.Context(), review)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
+	a.publishEvent(r.Context(), data.EventReviewUpdated, review.ProductID, review)
+	a.recountRating(r.Context(), review.ProductID)
 
 	// Send the updated review as a JSON response
 	data := envelope{
 		"review": review,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -211,21 +251,35 @@ func (a *applicationDependencies) deleteReviewHandler(w http.ResponseWriter, r *
 		return
 	}
 
-	err = a.reviewModel.DeleteReview(id)
+	// Look the review up first so the delete event can name its product
+	review, err := a.reviewModel.GetReview(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			a.RIDnotFound(w, r, id) // Pass the ID to the custom message handler
+			a.reviewNotFoundResponse(w, r, id)
 		default:
 			a.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
+	err = a.reviewModel.DeleteReview(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.reviewNotFoundResponse(w, r, id)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	a.publishEvent(r.Context(), data.EventReviewDeleted, review.ProductID, envelope{"review_id": id, "product_id": review.ProductID})
+	a.recountRating(r.Context(), review.ProductID)
+
 	data := envelope{
 		"message": "Review successfully deleted",
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -249,9 +303,11 @@ func (a *applicationDependencies) listReviewHandler(w http.ResponseWriter, r *ht
 	queryParametersData.Filters.PageSize = a.getSingleIntegerParameter(queryParameters, "page_size", 10, v)
 	queryParametersData.Filters.Sort = a.getSingleQueryParameter(queryParameters, "sort", "review_id")
 	queryParametersData.Filters.SortSafeList = []string{"review_id", "author", "-review_id", "-author"}
+	queryParametersData.Filters.Fields = a.getMultipleQueryParameters(queryParameters, "fields", nil)
 
 	// Validate filters
 	data.ValidateFilters(v, queryParametersData.Filters)
+	data.ValidateFields(v, queryParametersData.Filters.Fields, data.ReviewFieldSafeList)
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
@@ -259,6 +315,7 @@ func (a *applicationDependencies) listReviewHandler(w http.ResponseWriter, r *ht
 
 	// Fetch reviews
 	reviews, metadata, err := a.reviewModel.GetAllReviews(
+		r.Context(),
 		queryParametersData.Author,
 		queryParametersData.Filters,
 	)
@@ -267,12 +324,18 @@ func (a *applicationDependencies) listReviewHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
+	list, err := selectFields(reviews, queryParametersData.Filters.Fields)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
 	// Prepare and write response
 	responseData := envelope{
-		"Reviews":   reviews,
+		"Reviews":   list,
 		"@metadata": metadata,
 	}
-	if err := a.writeJSON(w, http.StatusOK, responseData, nil); err != nil {
+	if err := a.writeResponse(w, r, http.StatusOK, responseData, nil); err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
 }
@@ -281,25 +344,33 @@ func (a *applicationDependencies) listProductReviewHandler(w http.ResponseWriter
 	// Get the id from the URL /v1/comments/:id so that we
 	// can use it to query teh comments table. We will
 	// implement the readIDParam() function later
-	id, err := a.readIDParam(r, "rid")
+	id, err := a.readIDParam(r, "pid")
 	if err != nil {
 		a.notFoundResponse(w, r)
 		return
 	}
 
+	fields := a.getMultipleQueryParameters(r.URL.Query(), "fields", nil)
+	v := validator.New()
+	data.ValidateFields(v, fields, data.ReviewFieldSafeList)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	// Check if the review exists
-	exists, err := a.productModel.ProductExists(id) // Assuming you have an Exists method in reviewModel
+	exists, err := a.productModel.ProductExists(r.Context(), id) // Assuming you have an Exists method in reviewModel
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
 	if !exists {
-		a.PRIDnotFound(w, r, id)
+		a.productNotFoundResponse(w, r, id)
 		return
 	}
 
 	// Call Get() to retrieve the comment with the specified id
-	review, err := a.reviewModel.GetAllProductReviews(id)
+	reviews, err := a.reviewModel.GetAllProductReviews(r.Context(), id, fields...)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -309,12 +380,26 @@ func (a *applicationDependencies) listProductReviewHandler(w http.ResponseWriter
 		}
 		return
 	}
+	if reviews == nil {
+		reviews = []data.Review{}
+	}
 
-	// display the comment
+	// keep only the fields that were asked for
+	list, err := selectFields(reviews, fields)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// display the comment. v1 put the list under "Review".
+	key := "Review"
+	if apiVersion(r) >= 2 {
+		key = "reviews"
+	}
 	data := envelope{
-		"Review": review,
+		key: list,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -331,35 +416,36 @@ func (a *applicationDependencies) HelpfulCountHandler(w http.ResponseWriter, r *
 	}
 
 	// Check if the review exists
-	exists, err := a.reviewModel.Exists(id) // Assuming you have an Exists method in reviewModel
+	exists, err := a.reviewModel.Exists(r.Context(), id) // Assuming you have an Exists method in reviewModel
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
 	if !exists {
-		a.RRIDnotFound(w, r, id)
+		a.reviewNotFoundResponse(w, r, id)
 		return
 	}
 
 	// Retrieve and update the review's helpful count in the database
-	review, err := a.reviewModel.UpdateHelpfulCount(id)
+	review, err := a.reviewModel.UpdateHelpfulCount(r.Context(), id)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
+	a.publishEvent(r.Context(), data.EventReviewHelpful, review.ProductID, review)
 
-	// Send the updated review as a JSON response
+	// Send the updated review. v1 responses also carry the confirmation
+	// message they always had.
 	data := envelope{
 		"review": review,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if apiVersion(r) < 2 {
+		data["message"] = fmt.Sprintf("Helpful count incremented by 1 for the review with id = %d", id)
+	}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
-
-	// Log a confirmation message for the incremented helpful count
-	confirmationMessage := fmt.Sprintf("\nHelpful count incremented by 1 for the review with id = %d", id)
-	fmt.Fprintln(w, confirmationMessage)
 }
 
 func (a *applicationDependencies) getProductReviewHandler(w http.ResponseWriter, r *http.Request) {
@@ -377,23 +463,38 @@ func (a *applicationDependencies) getProductReviewHandler(w http.ResponseWriter,
 		return
 	}
 
+	fields := a.getMultipleQueryParameters(r.URL.Query(), "fields", nil)
+	v := validator.New()
+	data.ValidateFields(v, fields, data.ReviewFieldSafeList)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	// Retrieve the review from the model using the new GetProductReview function
-	review, err := a.reviewModel.GetProductReview(rid, pid)
+	review, err := a.reviewModel.GetProductReview(r.Context(), rid, pid, fields...)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			a.notFoundResponse(w, r)
+			a.reviewNotFoundResponse(w, r, rid)
 		default:
 			a.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
+	// keep only the fields that were asked for
+	res, err := newResource(review, fields)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
 	// Send the updated review as a JSON response
 	data := envelope{
-		"review": review,
+		"review": res,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
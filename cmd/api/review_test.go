@@ -0,0 +1,114 @@
+// Filename: cmd/api/review_test.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mtechguy/test2/internal/data"
+)
+
+// TestReviewFieldsValidated checks that every review endpoint reading
+// ?fields= rejects fields reviews don't have.
+func TestReviewFieldsValidated(t *testing.T) {
+	router, _ := newTestApplication(t).router()
+
+	for _, path := range []string{
+		"/v1/review/1",
+		"/v1/product-review/1",
+		"/v1/product/1/review/2",
+		"/v2/reviews/1",
+		"/v2/products/1/reviews",
+		"/v2/products/1/reviews/2",
+	} {
+		t.Run(path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?fields=author,price", nil))
+
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusUnprocessableEntity, w.Body)
+			}
+			var p problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+			if len(p.Errors) != 1 || p.Errors[0].Field != "fields" || p.Errors[0].Params["field"] != "price" {
+				t.Errorf("errors = %+v, want price rejected", p.Errors)
+			}
+		})
+	}
+}
+
+// TestProductReviewsWithDatabase checks that include=reviews embeds only
+// the latest reviews while the product's review list has all of them, and
+// that both review endpoints of a product honour ?fields=.
+func TestProductReviewsWithDatabase(t *testing.T) {
+	a := newTestDatabaseApplication(t)
+	router, _ := a.router()
+	ctx := testContext(t)
+
+	product := &data.Product{Name: "Lamp", Description: "A desk lamp", Category: "lighting", ImageURL: "lamp.png", Price: "19.99"}
+	if err := a.productModel.InsertProduct(ctx, product); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.productModel.DeleteProduct(ctx, product.ProductID) })
+
+	total := embeddedReviewLimit + 2
+	var reviewIDs []int64
+	for i := 0; i < total; i++ {
+		review := &data.Review{ProductID: product.ProductID, Author: fmt.Sprintf("author %d", i), Rating: 4, ReviewText: "Bright"}
+		if err := a.reviewModel.InsertReview(ctx, review); err != nil {
+			t.Fatal(err)
+		}
+		reviewIDs = append(reviewIDs, review.ReviewID)
+	}
+
+	get := func(path string, result any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d: %s", path, w.Code, w.Body)
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), result); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var embedded struct {
+		Product struct {
+			Reviews []data.Review `json:"reviews"`
+		} `json:"product"`
+	}
+	get(fmt.Sprintf("/v2/products/%d?include=reviews", product.ProductID), &embedded)
+	if got := len(embedded.Product.Reviews); got != embeddedReviewLimit {
+		t.Fatalf("embedded %d reviews, want %d", got, embeddedReviewLimit)
+	}
+	if got, want := embedded.Product.Reviews[0].ReviewID, reviewIDs[total-1]; got != want {
+		t.Errorf("first embedded review = %d, want the latest, %d", got, want)
+	}
+
+	var list struct {
+		Reviews []map[string]any `json:"reviews"`
+	}
+	get(fmt.Sprintf("/v2/products/%d/reviews?fields=review_id,rating", product.ProductID), &list)
+	if len(list.Reviews) != total {
+		t.Fatalf("listed %d reviews, want %d", len(list.Reviews), total)
+	}
+	for _, review := range list.Reviews {
+		if len(review) != 2 || review["review_id"] == nil || review["rating"] == nil {
+			t.Errorf("review = %v, want review_id and rating only", review)
+		}
+	}
+
+	var single struct {
+		Review map[string]any `json:"review"`
+	}
+	get(fmt.Sprintf("/v2/products/%d/reviews/%d?fields=author", product.ProductID, reviewIDs[0]), &single)
+	if len(single.Review) != 1 || single.Review["author"] != "author 0" {
+		t.Errorf("review = %v, want author only", single.Review)
+	}
+}
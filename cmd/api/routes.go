@@ -3,37 +3,227 @@ package main
 
 import (
 	"net/http"
+	"path"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 )
 
 func (a *applicationDependencies) routes() http.Handler {
 
+	router, _ := a.router()
+
+	return a.requestID(a.trace(a.logRequest(a.instrument(a.recoverPanic(a.rateLimit(a.requireAcceptable(router)))))))
+
+}
+
+// router registers every route. It also returns the method and path of each,
+// in the order they were registered, which the tests check against the
+// OpenAPI document.
+func (a *applicationDependencies) router() (*httprouter.Router, [][2]string) {
+
 	router := httprouter.New()
 
 	router.NotFound = http.HandlerFunc(a.notFoundResponse)
 
 	router.MethodNotAllowed = http.HandlerFunc(a.methodNotAllowedResponse)
 
+	// register returns a function that adds routes under prefix, passing
+	// their handlers through wrap. Every route is recorded.
+	var routes []route
+	register := func(prefix string, wrap func(http.HandlerFunc) http.HandlerFunc) func(string, string, http.HandlerFunc) {
+		return func(method string, path string, handler http.HandlerFunc) {
+			routes = append(routes, route{method, prefix + path, withRoute(prefix+path, wrap(handler))})
+		}
+	}
+	versioned := func(version int) func(http.HandlerFunc) http.HandlerFunc {
+		return func(next http.HandlerFunc) http.HandlerFunc {
+			return withVersion(version, next)
+		}
+	}
+
+	document := a.openAPIDocument()
+	unversioned := register("", func(next http.HandlerFunc) http.HandlerFunc { return next })
+	unversioned(http.MethodGet, "/healthcheck", a.healthcheckHandler)
+	unversioned(http.MethodGet, "/livez", a.livenessHandler)
+	unversioned(http.MethodGet, "/readyz", a.readinessHandler)
+	unversioned(http.MethodGet, "/openapi.json", openAPIHandler(document))
+	unversioned(http.MethodGet, "/debug/db", a.dbStatsHandler)
+	unversioned(http.MethodGet, "/metrics", a.metrics.registry.Handler().ServeHTTP)
+
+	// The unprefixed routes are v1 from before the API was versioned. They
+	// stay for existing clients but say they are going away.
+	a.v1Routes(register("", a.deprecated))
+
+	v1 := register("/v1", versioned(1))
+	v1(http.MethodGet, "/healthcheck", a.healthcheckHandler)
+	a.v1Routes(v1)
+
+	a.v2Routes(register("/v2", versioned(2)))
+
+	return router, addRoutes(router, routes)
+
+}
+
+// route is a registered route, added to the router once they are all known.
+type route struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+}
+
+// addRoutes adds routes to router and returns their methods and paths.
+// httprouter doesn't let a fixed segment share its position with a
+// parameter, as /review/stream does with /review/:rid. Such a route is
+// served through the parameter's route, which hands the request on when
+// the parameter is the fixed segment.
+func addRoutes(router *httprouter.Router, routes []route) [][2]string {
+	// The parameter ending each route that ends in one, by method and
+	// parent path.
+	params := make(map[[2]string]string)
+	for _, rt := range routes {
+		parent, last := path.Split(rt.path)
+		if strings.HasPrefix(last, ":") {
+			params[[2]string{rt.method, parent}] = last[1:]
+		}
+	}
+
+	// The routes sharing a position with a parameter, by the method and
+	// path of the parameter's route.
+	static := make(map[[2]string]map[string]http.HandlerFunc)
+	var registered [][2]string
+	for _, rt := range routes {
+		registered = append(registered, [2]string{rt.method, rt.path})
+
+		parent, last := path.Split(rt.path)
+		param, found := params[[2]string{rt.method, parent}]
+		if !found || strings.HasPrefix(last, ":") {
+			continue
+		}
+		key := [2]string{rt.method, parent + ":" + param}
+		if static[key] == nil {
+			static[key] = make(map[string]http.HandlerFunc)
+		}
+		static[key][last] = rt.handler
+	}
+
+	for _, rt := range routes {
+		parent, last := path.Split(rt.path)
+		param, found := params[[2]string{rt.method, parent}]
+		switch {
+		case !found:
+			router.HandlerFunc(rt.method, rt.path, rt.handler)
+		case last == ":"+param:
+			handler := rt.handler
+			if segments := static[[2]string{rt.method, rt.path}]; segments != nil {
+				handler = withStaticSegments(param, handler, segments)
+			}
+			router.HandlerFunc(rt.method, rt.path, handler)
+		}
+	}
+
+	return registered
+}
+
+// v1Routes registers the v1 API with handle.
+func (a *applicationDependencies) v1Routes(handle func(method string, path string, handler http.HandlerFunc)) {
 	//Product part
-	router.HandlerFunc(http.MethodGet, "/healthcheck", a.healthcheckHandler)
-	router.HandlerFunc(http.MethodGet, "/product", a.listProductHandler)
-	router.HandlerFunc(http.MethodPost, "/product", a.createProductHandler)
-	router.HandlerFunc(http.MethodGet, "/product/:pid", a.displayProductHandler)
-	router.HandlerFunc(http.MethodPatch, "/product/:pid", a.updateProductHandler)
-	router.HandlerFunc(http.MethodDelete, "/product/:pid", a.deleteProductHandler)
+	handle(http.MethodGet, "/product", a.listProductHandler)
+	handle(http.MethodPost, "/product", a.idempotent(a.createProductHandler))
+	handle(http.MethodPost, "/product/bulk", a.idempotent(a.bulkProductHandler))
+	handle(http.MethodPost, "/product/import", a.importProductHandler)
+	handle(http.MethodGet, "/imports/:iid", a.displayImportHandler)
+	handle(http.MethodGet, "/product/export", a.exportProductHandler)
+	handle(http.MethodGet, "/product/:pid", a.displayProductHandler)
+	handle(http.MethodPatch, "/product/:pid", a.updateProductHandler)
+	handle(http.MethodDelete, "/product/:pid", a.deleteProductHandler)
+	handle(http.MethodGet, "/product/:pid/translations", a.listProductTranslationHandler)
+	handle(http.MethodGet, "/product/:pid/translations/:locale", a.displayProductTranslationHandler)
+	handle(http.MethodPut, "/product/:pid/translations/:locale", a.putProductTranslationHandler)
+	handle(http.MethodDelete, "/product/:pid/translations/:locale", a.deleteProductTranslationHandler)
 
 	// //Review part
-	router.HandlerFunc(http.MethodGet, "/review", a.listReviewHandler)
-	router.HandlerFunc(http.MethodPost, "/review", a.createReviewHandler)
-	router.HandlerFunc(http.MethodGet, "/review/:rid", a.displayReviewHandler)
-	router.HandlerFunc(http.MethodPatch, "/review/:rid", a.updateReviewHandler)
-	router.HandlerFunc(http.MethodDelete, "/review/:rid", a.deleteReviewHandler)
+	handle(http.MethodGet, "/review", a.listReviewHandler)
+	handle(http.MethodPost, "/review", a.idempotent(a.createReviewHandler))
+	handle(http.MethodPost, "/review/bulk", a.idempotent(a.bulkReviewHandler))
+	handle(http.MethodGet, "/review/stream", a.reviewStreamHandler)
+	handle(http.MethodGet, "/review/export", a.exportReviewHandler)
+	handle(http.MethodGet, "/review/:rid", a.displayReviewHandler)
+	handle(http.MethodPatch, "/review/:rid", a.updateReviewHandler)
+	handle(http.MethodDelete, "/review/:rid", a.deleteReviewHandler)
+
+	handle(http.MethodGet, "/product-review/:pid", a.listProductReviewHandler)
+	handle(http.MethodGet, "/product/:pid/review/stream", a.productReviewStreamHandler)
+	handle(http.MethodGet, "/product/:pid/review/:rid", a.getProductReviewHandler)
+	handle(http.MethodPatch, "/helpful-count/:rid", a.HelpfulCountHandler)
 
-	router.HandlerFunc(http.MethodGet, "/product-review/:rid", a.listProductReviewHandler)
-	router.HandlerFunc(http.MethodGet, "/product/:pid/review/:rid", a.getProductReviewHandler)
-	router.HandlerFunc(http.MethodPatch, "/helpful-count/:rid", a.HelpfulCountHandler)
+	// Webhook part
+	a.webhookRoutes(handle)
+}
+
+// v2Routes registers the v2 API with handle. Its resources are always
+// plural nouns, and whatever belongs to a product is nested under it.
+func (a *applicationDependencies) v2Routes(handle func(method string, path string, handler http.HandlerFunc)) {
+	handle(http.MethodGet, "/healthcheck", a.healthcheckHandler)
+
+	// Products
+	handle(http.MethodGet, "/products", a.listProductHandler)
+	handle(http.MethodPost, "/products", a.idempotent(a.createProductHandler))
+	handle(http.MethodPost, "/products/bulk", a.idempotent(a.bulkProductHandler))
+	handle(http.MethodPost, "/products/import", a.importProductHandler)
+	handle(http.MethodGet, "/imports/:iid", a.displayImportHandler)
+	handle(http.MethodGet, "/products/export", a.exportProductHandler)
+	handle(http.MethodGet, "/products/:pid", a.displayProductHandler)
+	handle(http.MethodPatch, "/products/:pid", a.updateProductHandler)
+	handle(http.MethodDelete, "/products/:pid", a.deleteProductHandler)
+	handle(http.MethodGet, "/products/:pid/translations", a.listProductTranslationHandler)
+	handle(http.MethodGet, "/products/:pid/translations/:locale", a.displayProductTranslationHandler)
+	handle(http.MethodPut, "/products/:pid/translations/:locale", a.putProductTranslationHandler)
+	handle(http.MethodDelete, "/products/:pid/translations/:locale", a.deleteProductTranslationHandler)
+	handle(http.MethodGet, "/products/:pid/reviews", a.listProductReviewHandler)
+	handle(http.MethodGet, "/products/:pid/reviews/stream", a.productReviewStreamHandler)
+	handle(http.MethodGet, "/products/:pid/reviews/:rid", a.getProductReviewHandler)
+
+	// Reviews
+	handle(http.MethodGet, "/reviews", a.listReviewHandler)
+	handle(http.MethodPost, "/reviews", a.idempotent(a.createReviewHandler))
+	handle(http.MethodPost, "/reviews/bulk", a.idempotent(a.bulkReviewHandler))
+	handle(http.MethodGet, "/reviews/stream", a.reviewStreamHandler)
+	handle(http.MethodGet, "/reviews/export", a.exportReviewHandler)
+	handle(http.MethodGet, "/reviews/:rid", a.displayReviewHandler)
+	handle(http.MethodPatch, "/reviews/:rid", a.updateReviewHandler)
+	handle(http.MethodDelete, "/reviews/:rid", a.deleteReviewHandler)
+	handle(http.MethodPatch, "/reviews/:rid/helpful", a.HelpfulCountHandler)
 
-	return a.recoverPanic(a.rateLimit(router))
+	// Webhooks
+	a.webhookRoutes(handle)
+}
+
+// webhookRoutes registers the webhook endpoints, which are named the same
+// way in every version.
+func (a *applicationDependencies) webhookRoutes(handle func(method string, path string, handler http.HandlerFunc)) {
+	handle(http.MethodGet, "/webhooks", a.listWebhookHandler)
+	// Not idempotent: the response holds the signing secret, which mustn't
+	// be stored for replays.
+	handle(http.MethodPost, "/webhooks", a.createWebhookHandler)
+	handle(http.MethodGet, "/webhooks/:wid", a.displayWebhookHandler)
+	handle(http.MethodPatch, "/webhooks/:wid", a.updateWebhookHandler)
+	handle(http.MethodDelete, "/webhooks/:wid", a.deleteWebhookHandler)
+	handle(http.MethodGet, "/webhooks/:wid/deliveries", a.listWebhookDeliveryHandler)
+	handle(http.MethodPost, "/webhooks/:wid/deliveries/:did/retry", a.retryWebhookDeliveryHandler)
+}
 
+// withStaticSegments sends a request whose parameter is one of the static
+// names to that route's handler instead of the fallback. Each handler sets
+// its own route, so the request is labelled /review/stream rather than
+// /review/:rid.
+func withStaticSegments(param string, fallback http.HandlerFunc, static map[string]http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler, found := static[httprouter.ParamsFromContext(r.Context()).ByName(param)]
+		if found {
+			handler(w, r)
+			return
+		}
+		fallback(w, r)
+	}
 }
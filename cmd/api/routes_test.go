@@ -0,0 +1,60 @@
+// Filename: cmd/api/routes_test.go
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// TestAddRoutes checks routes sharing a position with a parameter are
+// served, and labelled, as routes of their own.
+func TestAddRoutes(t *testing.T) {
+	var served string
+	handle := func(method, path string) route {
+		return route{method, path, withRoute(path, func(w http.ResponseWriter, r *http.Request) { served = method + " " + path })}
+	}
+	routes := []route{
+		handle(http.MethodGet, "/reviews/stream"),
+		handle(http.MethodGet, "/reviews/:rid"),
+		handle(http.MethodPatch, "/reviews/:rid"),
+		handle(http.MethodPost, "/reviews/bulk"),
+		handle(http.MethodGet, "/products/:pid/reviews/stream"),
+		handle(http.MethodGet, "/products/:pid/reviews/:rid"),
+	}
+	router := httprouter.New()
+	registered := addRoutes(router, routes)
+
+	want := make([][2]string, len(routes))
+	for i, rt := range routes {
+		want[i] = [2]string{rt.method, rt.path}
+	}
+	if !reflect.DeepEqual(registered, want) {
+		t.Errorf("registered %v, want %v", registered, want)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		route  string
+	}{
+		{http.MethodGet, "/reviews/stream", "/reviews/stream"},
+		{http.MethodGet, "/reviews/7", "/reviews/:rid"},
+		{http.MethodGet, "/reviews/streams", "/reviews/:rid"},
+		{http.MethodPatch, "/reviews/stream", "/reviews/:rid"},
+		{http.MethodPost, "/reviews/bulk", "/reviews/bulk"},
+		{http.MethodGet, "/products/3/reviews/stream", "/products/:pid/reviews/stream"},
+		{http.MethodGet, "/products/3/reviews/7", "/products/:pid/reviews/:rid"},
+	}
+	for _, tt := range tests {
+		served = ""
+		r, matched := routeOf(httptest.NewRequest(tt.method, tt.path, nil))
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if want := tt.method + " " + tt.route; served != want || matched.pattern != tt.route {
+			t.Errorf("%s %s served by %q as %s, want %q as %s", tt.method, tt.path, served, matched.pattern, want, tt.route)
+		}
+	}
+}
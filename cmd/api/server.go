@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -17,15 +18,46 @@ func (a *applicationDependencies) serve() error {
 	apiServer := &http.Server{
 		Addr:         fmt.Sprintf(":%d", a.config.port),
 		Handler:      a.routes(),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  a.config.http.idleTimeout,
+		ReadTimeout:  a.config.http.readTimeout,
+		WriteTimeout: a.config.http.writeTimeout,
 		ErrorLog:     slog.NewLogLogger(a.logger.Handler(), slog.LevelError),
 	}
 
 	a.logger.Info("starting server", "address", apiServer.Addr,
 		"environment", a.config.environment)
 
+	// Background workers run until the server starts shutting down
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	a.shutdown = workerCtx
+	var workers sync.WaitGroup
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		a.runWebhookWorker(workerCtx)
+	}()
+
+	err := a.scheduleJobs(context.Background())
+	if err != nil {
+		a.logger.Error("scheduling recurring jobs failed", "error", err.Error())
+	}
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		a.jobs.Run(workerCtx)
+	}()
+
+	if a.config.db.statsInterval > 0 {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			a.logPoolStats(workerCtx, a.config.db.statsInterval)
+		}()
+	}
+
 	// Create a channel to track errors during shutdown
 	shutdownError := make(chan error)
 
@@ -37,14 +69,29 @@ func (a *applicationDependencies) serve() error {
 
 		a.logger.Info("shutting down server", "signal", s.String())
 
+		// Fail the readiness probe, and give load balancers time to notice
+		// before new connections are refused
+		a.shuttingDown.Store(true)
+		if a.config.http.shutdownDelay > 0 {
+			a.logger.Info("waiting for load balancers to drain", "delay", a.config.http.shutdownDelay.String())
+			time.Sleep(a.config.http.shutdownDelay)
+		}
+
+		// Close the event streams first, Shutdown waits for them otherwise
+		a.events.close()
+
+		// Stop the background workers from picking up new work; they drain
+		// while the server finishes its requests
+		stopWorkers()
+
 		// Create a context with timeout for shutdown
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), a.config.http.shutdownTimeout)
 		defer cancel()
 		shutdownError <- apiServer.Shutdown(ctx)
 	}()
 
 	// Start the server
-	err := apiServer.ListenAndServe()
+	err = apiServer.ListenAndServe()
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
@@ -55,6 +102,11 @@ func (a *applicationDependencies) serve() error {
 		return err
 	}
 
+	// Wait for the background workers to finish their in-flight work
+	a.logger.Info("waiting for background workers")
+	workers.Wait()
+	a.wg.Wait()
+
 	a.logger.Info("stopped server", "address", apiServer.Addr)
 
 	return nil
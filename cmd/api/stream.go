@@ -0,0 +1,104 @@
+// Filename: cmd/api/stream.go
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (a *applicationDependencies) reviewStreamHandler(w http.ResponseWriter, r *http.Request) {
+	a.streamReviewEvents(w, r, 0)
+}
+
+func (a *applicationDependencies) productReviewStreamHandler(w http.ResponseWriter, r *http.Request) {
+	pid, err := a.readIDParam(r, "pid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	exists, err := a.productModel.ProductExists(r.Context(), pid)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if !exists {
+		a.productNotFoundResponse(w, r, pid)
+		return
+	}
+
+	a.streamReviewEvents(w, r, pid)
+}
+
+// streamReviewEvents writes review events to the client as Server-Sent
+// Events until the client goes away or the server shuts down.
+func (a *applicationDependencies) streamReviewEvents(w http.ResponseWriter, r *http.Request, productID int64) {
+	var lastEventID uint64
+	if value := r.Header.Get("Last-Event-ID"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			a.badRequestResponse(w, r, newRequestError("last_event_id"))
+			return
+		}
+		lastEventID = id
+	}
+
+	// Streams outlive the server's WriteTimeout, so lift the deadline for
+	// this response.
+	rc := http.NewResponseController(w)
+	err := rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	s, backlog, ok := a.events.subscribe(productID, lastEventID)
+	if !ok {
+		a.serviceUnavailableResponse(w, r)
+		return
+	}
+	defer a.events.unsubscribe(s)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Tell the client how long to wait before reconnecting.
+	fmt.Fprint(w, "retry: 3000\n\n")
+	for _, event := range backlog {
+		writeServerSentEvent(w, event)
+	}
+	err = rc.Flush()
+	if err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case event, open := <-s.events:
+			if !open {
+				return
+			}
+			writeServerSentEvent(w, event)
+		}
+		err = rc.Flush()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func writeServerSentEvent(w http.ResponseWriter, event brokerEvent) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+}
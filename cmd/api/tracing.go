@@ -0,0 +1,78 @@
+// Filename: cmd/api/tracing.go
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/mtechguy/test2/internal/requestid"
+	"github.com/mtechguy/test2/internal/tracing"
+)
+
+// newTracer sets up the exporter chosen with -trace-exporter. The tracer is
+// nil when tracing is off. close flushes and releases the exporter.
+func newTracer(setting serverConfig) (*tracing.Tracer, func(), error) {
+	var w io.Writer
+	closeWriter := func() error { return nil }
+	switch setting.trace.exporter {
+	case "stdout":
+		w = os.Stdout
+	case "file":
+		f, err := os.OpenFile(setting.trace.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, err
+		}
+		w, closeWriter = f, f.Close
+	default:
+		return nil, func() {}, nil
+	}
+
+	exporter := tracing.NewWriterExporter(w)
+	return tracing.NewTracer(exporter), func() {
+		_ = exporter.Close()
+		_ = closeWriter()
+	}, nil
+}
+
+// trace starts the server span of every request, continuing the trace of
+// the client's traceparent header when it sent one. The spans of the model
+// methods and SQL statements run for the request are its descendants. The
+// probes and metrics scrapes aren't traced, they would bury the requests
+// worth looking at.
+func (a *applicationDependencies) trace(next http.Handler) http.Handler {
+	if a.tracer == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unlimitedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, span := a.tracer.StartRoot(r.Context(), r.Method, tracing.KindServer, tracing.Extract(r.Header),
+			tracing.String("http.request.method", r.Method),
+			tracing.String("url.path", r.URL.Path),
+			tracing.String("client.address", a.callerID(r)),
+			tracing.String("user_agent.original", r.UserAgent()),
+			tracing.String("request_id", requestid.FromContext(r.Context())),
+		)
+		defer span.End()
+
+		r, route := routeOf(r.WithContext(ctx))
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		// Named after the route rather than the path, so the spans of the
+		// same endpoint group together.
+		span.SetName(r.Method + " " + route.pattern)
+		span.SetAttributes(
+			tracing.String("http.route", route.pattern),
+			tracing.Int("http.response.status_code", recorder.status),
+			tracing.Int64("http.response.body.size", recorder.bytes),
+		)
+		if recorder.status >= 500 {
+			span.SetStatus(tracing.StatusError, http.StatusText(recorder.status))
+		}
+	})
+}
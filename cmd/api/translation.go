@@ -0,0 +1,231 @@
+// Filename: cmd/api/translation.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/mtechguy/test2/internal/data"
+	"github.com/mtechguy/test2/internal/i18n"
+	"github.com/mtechguy/test2/internal/validator"
+)
+
+// contentLocales returns the translations a product read should look for,
+// best first: the locale given with ?locale=, otherwise the languages of
+// the Accept-Language header. Products are written in the default
+// language, so the header's tags after it are dropped; a client that
+// prefers English over Spanish gets the original text, not the es
+// translation.
+func (a *applicationDependencies) contentLocales(r *http.Request, v *validator.Validator) []string {
+	if locale := r.URL.Query().Get("locale"); locale != "" {
+		locale = data.NormalizeLocale(locale)
+		v.Check(data.ValidLocale(locale), "locale", "locale")
+		return data.LocalePreferences(locale)
+	}
+
+	var tags []string
+	for _, tag := range i18n.Preferences(r.Header.Get("Accept-Language")) {
+		tag = data.NormalizeLocale(tag)
+		if !data.ValidLocale(tag) {
+			continue
+		}
+		tags = append(tags, tag)
+		if language, _, _ := strings.Cut(tag, "-"); language == i18n.DefaultLanguage {
+			break
+		}
+	}
+	return data.LocalePreferences(tags...)
+}
+
+// readLocaleParam returns the :locale parameter written the way
+// translations are stored, or an error if it isn't a usable locale.
+func (a *applicationDependencies) readLocaleParam(r *http.Request) (string, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	locale := data.NormalizeLocale(params.ByName("locale"))
+	if !data.ValidLocale(locale) {
+		return "", newRequestError("locale_param")
+	}
+	return locale, nil
+}
+
+func (a *applicationDependencies) listProductTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "pid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	exists, err := a.productModel.ProductExists(r.Context(), id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if !exists {
+		a.productNotFoundResponse(w, r, id)
+		return
+	}
+
+	translations, err := a.translationModel.GetAllTranslations(r.Context(), id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"translations": translations,
+	}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) displayProductTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "pid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+	locale, err := a.readLocaleParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	translation, err := a.translationModel.GetTranslation(r.Context(), id, locale)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.translationNotFoundResponse(w, r, id, locale)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"translation": translation,
+	}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// putProductTranslationHandler adds the translation for the locale in the
+// path, or replaces it if the product already has one.
+func (a *applicationDependencies) putProductTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "pid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+	locale, err := a.readLocaleParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Category    string `json:"category"`
+	}
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	translation := &data.ProductTranslation{
+		ProductID:   id,
+		Locale:      locale,
+		Name:        input.Name,
+		Description: input.Description,
+		Category:    input.Category,
+	}
+
+	v := validator.New()
+	data.ValidateProductTranslation(v, translation)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	exists, err := a.productModel.ProductExists(r.Context(), id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if !exists {
+		a.productNotFoundResponse(w, r, id)
+		return
+	}
+
+	created, err := a.translationModel.UpsertTranslation(r.Context(), translation)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	headers := make(http.Header)
+	if created {
+		status = http.StatusCreated
+		headers.Set("Location", versionedLocation(r,
+			fmt.Sprintf("/product/%d/translations/%s", id, locale),
+			fmt.Sprintf("/products/%d/translations/%s", id, locale)))
+	}
+
+	data := envelope{
+		"translation": translation,
+	}
+	err = a.writeResponse(w, r, status, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) deleteProductTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "pid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+	locale, err := a.readLocaleParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.translationModel.DeleteTranslation(r.Context(), id, locale)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.translationNotFoundResponse(w, r, id, locale)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "Translation successfully deleted",
+	}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// setContentLanguage marks a product response as depending on the client's
+// language, naming the language when a translation was used.
+func setContentLanguage(w http.ResponseWriter, locale string) {
+	w.Header().Add("Vary", "Accept-Language")
+	if locale != "" {
+		w.Header().Set("Content-Language", locale)
+	}
+}
@@ -0,0 +1,103 @@
+// Filename: cmd/api/versions.go
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The unprefixed routes were deprecated when /v1 was introduced and are
+// removed at legacySunset.
+var (
+	legacyDeprecatedAt = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+	legacySunset       = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+)
+
+type contextKey string
+
+const apiVersionContextKey = contextKey("apiVersion")
+
+// withVersion records the API version a route belongs to, for handlers whose
+// response differs between versions.
+func withVersion(version int, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), apiVersionContextKey, version)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// apiVersion returns the API version r was made to. The unprefixed routes
+// are v1.
+func apiVersion(r *http.Request) int {
+	version, ok := r.Context().Value(apiVersionContextKey).(int)
+	if !ok {
+		return 1
+	}
+	return version
+}
+
+// deprecated adds the Deprecation (RFC 9745) and Sunset (RFC 8594) headers
+// to the responses of a legacy route, with a link to the same route under
+// /v1.
+func (a *applicationDependencies) deprecated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "@"+strconv.FormatInt(legacyDeprecatedAt.Unix(), 10))
+		w.Header().Set("Sunset", legacySunset.Format(http.TimeFormat))
+		w.Header().Add("Link", "</v1"+r.URL.EscapedPath()+`>; rel="successor-version"`)
+		next(w, r)
+	}
+}
+
+// v2EnvelopeKeys renames the envelope keys v1 responses use. In v2 a single
+// resource is under its singular name and a list under its plural name, all
+// in lower case, and pagination is under "metadata".
+var v2EnvelopeKeys = map[string]string{
+	"Product":   "product",
+	"Review":    "review",
+	"Reviews":   "reviews",
+	"@metadata": "metadata",
+}
+
+// versionedEnvelope returns data with the envelope keys of the API version
+// of r.
+func versionedEnvelope(r *http.Request, data envelope) envelope {
+	if apiVersion(r) < 2 {
+		return data
+	}
+
+	renamed := make(envelope, len(data))
+	for key, value := range data {
+		if v2Key, found := v2EnvelopeKeys[key]; found {
+			key = v2Key
+		}
+		renamed[key] = value
+	}
+	return renamed
+}
+
+// routePrefix returns the prefix of the route r was made to: /v1 or /v2,
+// or nothing for the unprefixed legacy routes.
+func routePrefix(r *http.Request) string {
+	version, ok := r.Context().Value(apiVersionContextKey).(int)
+	if !ok {
+		return ""
+	}
+	return "/v" + strconv.Itoa(version)
+}
+
+// location returns the Location header for a new resource whose path is
+// the same in every version, under the prefix of the route that created it.
+func location(r *http.Request, path string) string {
+	return routePrefix(r) + path
+}
+
+// versionedLocation is location for a resource whose path was renamed in
+// v2, v1Path being its path on the v1 and legacy routes.
+func versionedLocation(r *http.Request, v1Path string, v2Path string) string {
+	if apiVersion(r) < 2 {
+		return routePrefix(r) + v1Path
+	}
+	return routePrefix(r) + v2Path
+}
@@ -0,0 +1,49 @@
+// Filename: cmd/api/versions_test.go
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestLocation checks the Location headers point at routes of the same
+// version as the one the resource was created through.
+func TestLocation(t *testing.T) {
+	router, _ := newTestApplication(t).router()
+
+	tests := []struct {
+		name      string
+		wrap      func(http.HandlerFunc) http.HandlerFunc
+		want      string
+		versioned string
+	}{
+		{name: "legacy", wrap: func(next http.HandlerFunc) http.HandlerFunc { return next },
+			want: "/imports/7", versioned: "/product/7"},
+		{name: "v1", wrap: func(next http.HandlerFunc) http.HandlerFunc { return withVersion(1, next) },
+			want: "/v1/imports/7", versioned: "/v1/product/7"},
+		{name: "v2", wrap: func(next http.HandlerFunc) http.HandlerFunc { return withVersion(2, next) },
+			want: "/v2/imports/7", versioned: "/v2/products/7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got, versioned string
+			tt.wrap(func(w http.ResponseWriter, r *http.Request) {
+				got = location(r, "/imports/7")
+				versioned = versionedLocation(r, "/product/7", "/products/7")
+			})(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+
+			if got != tt.want {
+				t.Errorf("location = %q, want %q", got, tt.want)
+			}
+			if versioned != tt.versioned {
+				t.Errorf("versionedLocation = %q, want %q", versioned, tt.versioned)
+			}
+			for _, path := range []string{got, versioned} {
+				if handler, _, _ := router.Lookup(http.MethodGet, path); handler == nil {
+					t.Errorf("no route for GET %s", path)
+				}
+			}
+		})
+	}
+}
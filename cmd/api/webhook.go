@@ -0,0 +1,328 @@
+// Filename: cmd/api/webhook.go
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mtechguy/test2/internal/data"
+	"github.com/mtechguy/test2/internal/validator"
+)
+
+// generateWebhookSecret is used when a subscription is created without a
+// secret of its own.
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (a *applicationDependencies) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingWebhookData struct {
+		URL    string   `json:"url"`
+		Secret string   `json:"secret"`
+		Events []string `json:"events"`
+		Active *bool    `json:"active"`
+	}
+	err := a.readJSON(w, r, &incomingWebhookData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	webhook := &data.Webhook{
+		URL:    incomingWebhookData.URL,
+		Secret: incomingWebhookData.Secret,
+		Events: incomingWebhookData.Events,
+		Active: true,
+	}
+	if incomingWebhookData.Active != nil {
+		webhook.Active = *incomingWebhookData.Active
+	}
+	if webhook.Secret == "" {
+		webhook.Secret, err = generateWebhookSecret()
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	v := validator.New()
+	data.ValidateWebhook(v, webhook)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.webhookModel.InsertWebhook(r.Context(), webhook)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", location(r, fmt.Sprintf("/webhooks/%d", webhook.WebhookID)))
+
+	// The secret is only shown once, so the subscriber can store it.
+	data := envelope{
+		"webhook": webhook,
+	}
+	err = a.writeResponse(w, r, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) displayWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "wid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	webhook, err := a.webhookModel.GetWebhook(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	webhook.Secret = ""
+
+	data := envelope{
+		"webhook": webhook,
+	}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "wid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	webhook, err := a.webhookModel.GetWebhook(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			a.notFoundResponse(w, r)
+		} else {
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var incomingWebhookData struct {
+		URL    *string  `json:"url"`
+		Secret *string  `json:"secret"`
+		Events []string `json:"events"`
+		Active *bool    `json:"active"`
+	}
+
+	err = a.readJSON(w, r, &incomingWebhookData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if incomingWebhookData.URL != nil {
+		webhook.URL = *incomingWebhookData.URL
+	}
+	if incomingWebhookData.Secret != nil {
+		webhook.Secret = *incomingWebhookData.Secret
+	}
+	if incomingWebhookData.Events != nil {
+		webhook.Events = incomingWebhookData.Events
+	}
+	if incomingWebhookData.Active != nil {
+		webhook.Active = *incomingWebhookData.Active
+	}
+
+	v := validator.New()
+	data.ValidateWebhook(v, webhook)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.webhookModel.UpdateWebhook(r.Context(), webhook)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	webhook.Secret = ""
+
+	data := envelope{
+		"webhook": webhook,
+	}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "wid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.webhookModel.DeleteWebhook(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "Webhook successfully deleted",
+	}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) listWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var queryParametersData struct {
+		data.Filters
+	}
+
+	queryParameters := r.URL.Query()
+
+	v := validator.New()
+	queryParametersData.Filters.Page = a.getSingleIntegerParameter(queryParameters, "page", 1, v)
+	queryParametersData.Filters.PageSize = a.getSingleIntegerParameter(queryParameters, "page_size", 10, v)
+	queryParametersData.Filters.Sort = a.getSingleQueryParameter(queryParameters, "sort", "webhook_id")
+	queryParametersData.Filters.SortSafeList = []string{"webhook_id", "url", "-webhook_id", "-url"}
+
+	data.ValidateFilters(v, queryParametersData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	webhooks, metadata, err := a.webhookModel.GetAllWebhooks(r.Context(), queryParametersData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"webhooks":  webhooks,
+		"@metadata": metadata,
+	}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) listWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "wid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = a.webhookModel.GetWebhook(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var queryParametersData struct {
+		Status string
+		data.Filters
+	}
+
+	queryParameters := r.URL.Query()
+	queryParametersData.Status = a.getSingleQueryParameter(queryParameters, "status", "")
+
+	v := validator.New()
+	queryParametersData.Filters.Page = a.getSingleIntegerParameter(queryParameters, "page", 1, v)
+	queryParametersData.Filters.PageSize = a.getSingleIntegerParameter(queryParameters, "page_size", 20, v)
+	queryParametersData.Filters.Sort = a.getSingleQueryParameter(queryParameters, "sort", "-delivery_id")
+	queryParametersData.Filters.SortSafeList = []string{"delivery_id", "created_at", "-delivery_id", "-created_at"}
+
+	data.ValidateFilters(v, queryParametersData.Filters)
+	if queryParametersData.Status != "" {
+		v.Check(validator.PermittedValue(queryParametersData.Status, data.DeliveryPending, data.DeliveryDelivered, data.DeliveryDead),
+			"status", "one_of", "values", strings.Join([]string{data.DeliveryPending, data.DeliveryDelivered, data.DeliveryDead}, ", "))
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	deliveries, metadata, err := a.webhookModel.GetAllDeliveries(r.Context(), id, queryParametersData.Status, queryParametersData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"deliveries": deliveries,
+		"@metadata":  metadata,
+	}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) retryWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	wid, err := a.readIDParam(r, "wid")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	did, err := a.readIDParam(r, "did")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	delivery, err := a.webhookModel.RetryDelivery(r.Context(), wid, did)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"delivery": delivery,
+	}
+	err = a.writeResponse(w, r, http.StatusAccepted, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,158 @@
+// Filename: cmd/api/webhook_worker.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mtechguy/test2/internal/data"
+	"github.com/mtechguy/test2/internal/tracing"
+)
+
+// signWebhookPayload returns the value sent in the X-Webhook-Signature
+// header. Receivers recompute the HMAC-SHA256 of "<timestamp>.<body>" with
+// their secret and compare it to the header.
+func signWebhookPayload(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff returns how long to wait before the next attempt, doubling
+// from 30 seconds and capped at an hour.
+func webhookBackoff(attempts int) time.Duration {
+	backoff := 30 * time.Second
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= time.Hour {
+			return time.Hour
+		}
+	}
+	return backoff
+}
+
+// runWebhookWorker polls for due deliveries until ctx is cancelled.
+func (a *applicationDependencies) runWebhookWorker(ctx context.Context) {
+	client := &http.Client{Timeout: a.config.webhook.timeout}
+
+	ticker := time.NewTicker(a.config.webhook.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		deliveries, webhooks, err := a.webhookModel.ClaimDueDeliveries(ctx, 20, 2*a.config.webhook.timeout)
+		if err != nil {
+			a.logger.Error("claiming webhook deliveries failed", "error", err.Error())
+			continue
+		}
+
+		for _, delivery := range deliveries {
+			if ctx.Err() != nil {
+				return
+			}
+			// A delivery that has started is allowed to finish during
+			// shutdown, the client timeout bounds it
+			a.deliverWebhook(context.WithoutCancel(ctx), client, webhooks[delivery.WebhookID], delivery)
+		}
+	}
+}
+
+// deliverWebhook makes a single attempt at sending the delivery and records
+// the outcome. Each attempt is the root of its own trace, propagated to the
+// receiver in the traceparent header.
+func (a *applicationDependencies) deliverWebhook(ctx context.Context, client *http.Client, webhook *data.Webhook, delivery *data.WebhookDelivery) {
+	if a.tracer != nil {
+		var span *tracing.Span
+		ctx, span = a.tracer.StartRoot(ctx, "webhook delivery", tracing.KindClient, tracing.SpanContext{},
+			tracing.String("webhook.event", delivery.Event),
+			tracing.Int64("webhook.id", webhook.WebhookID),
+			tracing.Int64("webhook.delivery_id", delivery.DeliveryID),
+			tracing.Int("webhook.attempt", delivery.Attempts+1),
+		)
+		defer span.End()
+	}
+
+	statusCode, err := a.sendWebhook(ctx, client, webhook, delivery)
+	if statusCode != 0 {
+		tracing.FromContext(ctx).SetAttributes(tracing.Int("http.response.status_code", statusCode))
+	}
+	if err == nil {
+		err = a.webhookModel.MarkDelivered(ctx, delivery.DeliveryID, statusCode)
+		if err != nil {
+			a.logger.Error("recording webhook delivery failed", "delivery_id", delivery.DeliveryID, "error", err.Error())
+		}
+		return
+	}
+
+	tracing.FromContext(ctx).SetError(err)
+
+	attempts := delivery.Attempts + 1
+	var nextAttempt *time.Time
+	if attempts < a.config.webhook.maxAttempts && webhook.Active {
+		next := time.Now().Add(webhookBackoff(attempts))
+		nextAttempt = &next
+	}
+
+	a.logger.Warn("webhook delivery failed", "delivery_id", delivery.DeliveryID,
+		"webhook_id", webhook.WebhookID, "attempt", attempts, "dead", nextAttempt == nil, "error", err.Error())
+
+	err = a.webhookModel.MarkFailed(ctx, delivery.DeliveryID, statusCode, err.Error(), nextAttempt)
+	if err != nil {
+		a.logger.Error("recording webhook delivery failed", "delivery_id", delivery.DeliveryID, "error", err.Error())
+	}
+}
+
+func (a *applicationDependencies) sendWebhook(ctx context.Context, client *http.Client, webhook *data.Webhook, delivery *data.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(envelope{
+		"delivery_id": delivery.DeliveryID,
+		"event":       delivery.Event,
+		"created_at":  delivery.CreatedAt,
+		"data":        delivery.Payload,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "product-review-webhooks/"+appVersion)
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(delivery.DeliveryID, 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", signWebhookPayload(webhook.Secret, timestamp, body))
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,259 @@
+// Filename: cmd/api/webhook_worker_test.go
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mtechguy/test2/internal/data"
+)
+
+const testWebhookSecret = "0123456789abcdef0123456789abcdef"
+
+// receivedWebhook is a delivery as a receiver saw it.
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookReceiver is a receiver answering every delivery with the next of
+// statuses, the last one once they run out. It checks the signature the way
+// receivers are told to.
+type webhookReceiver struct {
+	t        *testing.T
+	statuses []int
+
+	mu       sync.Mutex
+	received []receivedWebhook
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		rcv.t.Error(err)
+	}
+
+	mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+	mac.Write([]byte(r.Header.Get("X-Webhook-Timestamp") + "."))
+	mac.Write(body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := r.Header.Get("X-Webhook-Signature"); !hmac.Equal([]byte(got), []byte(want)) {
+		rcv.t.Errorf("X-Webhook-Signature = %q, want %q", got, want)
+	}
+
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	rcv.received = append(rcv.received, receivedWebhook{r.Header.Clone(), body})
+	w.WriteHeader(rcv.statuses[min(len(rcv.received), len(rcv.statuses))-1])
+}
+
+func (rcv *webhookReceiver) count() int {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return len(rcv.received)
+}
+
+func TestSendWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "accepted", status: http.StatusNoContent},
+		{name: "receiver error", status: http.StatusInternalServerError, wantErr: true},
+		{name: "redirect", status: http.StatusNotModified, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := &webhookReceiver{t: t, statuses: []int{tt.status}}
+			server := httptest.NewServer(receiver)
+			defer server.Close()
+
+			webhook := &data.Webhook{WebhookID: 3, URL: server.URL, Secret: testWebhookSecret}
+			delivery := &data.WebhookDelivery{DeliveryID: 9, WebhookID: 3, Event: data.EventReviewCreated,
+				Payload: json.RawMessage(`{"review_id":4}`), CreatedAt: time.Now()}
+
+			a := newTestApplication(t)
+			status, err := a.sendWebhook(testContext(t), server.Client(), webhook, delivery)
+			if status != tt.status {
+				t.Errorf("status = %d, want %d", status, tt.status)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, want error %t", err, tt.wantErr)
+			}
+
+			if receiver.count() != 1 {
+				t.Fatalf("received %d deliveries, want 1", receiver.count())
+			}
+			got := receiver.received[0]
+			for name, want := range map[string]string{
+				"Content-Type":       "application/json",
+				"X-Webhook-Event":    data.EventReviewCreated,
+				"X-Webhook-Delivery": "9",
+			} {
+				if got.header.Get(name) != want {
+					t.Errorf("%s = %q, want %q", name, got.header.Get(name), want)
+				}
+			}
+			timestamp, err := strconv.ParseInt(got.header.Get("X-Webhook-Timestamp"), 10, 64)
+			if err != nil || time.Since(time.Unix(timestamp, 0)) > time.Minute {
+				t.Errorf("X-Webhook-Timestamp = %q, want the current Unix time", got.header.Get("X-Webhook-Timestamp"))
+			}
+
+			var body struct {
+				DeliveryID int64           `json:"delivery_id"`
+				Event      string          `json:"event"`
+				Data       json.RawMessage `json:"data"`
+			}
+			if err := json.Unmarshal(got.body, &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.DeliveryID != 9 || body.Event != data.EventReviewCreated || string(body.Data) != `{"review_id":4}` {
+				t.Errorf("body = %s", got.body)
+			}
+		})
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{50, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := webhookBackoff(tt.attempts); got != tt.want {
+			t.Errorf("webhookBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// TestWebhookDeliveryWithDatabase follows a delivery through the worker
+// against a receiver that keeps failing: it is held while its webhook is
+// inactive, then retried with backoff until -webhook-max-attempts, then
+// dead-lettered.
+func TestWebhookDeliveryWithDatabase(t *testing.T) {
+	a := newTestDatabaseApplication(t)
+	a.config.webhook.maxAttempts = 3
+	a.config.webhook.timeout = 5 * time.Second
+	ctx := testContext(t)
+
+	receiver := &webhookReceiver{t: t, statuses: []int{http.StatusServiceUnavailable, http.StatusInternalServerError}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	webhook := &data.Webhook{URL: server.URL, Secret: testWebhookSecret, Events: []string{data.EventProductDeleted}, Active: true}
+	if err := a.webhookModel.InsertWebhook(ctx, webhook); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.webhookModel.DeleteWebhook(ctx, webhook.WebhookID) })
+
+	if err := a.webhookModel.EnqueueDeliveries(ctx, data.EventProductDeleted, []byte(`{"product_id":1}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// claim returns the delivery of the test's webhook if it is due.
+	claim := func() (*data.WebhookDelivery, *data.Webhook) {
+		t.Helper()
+		deliveries, webhooks, err := a.webhookModel.ClaimDueDeliveries(ctx, 100, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, delivery := range deliveries {
+			if delivery.WebhookID == webhook.WebhookID {
+				return delivery, webhooks[delivery.WebhookID]
+			}
+		}
+		return nil, nil
+	}
+	stored := func() *data.WebhookDelivery {
+		t.Helper()
+		deliveries, _, err := a.webhookModel.GetAllDeliveries(ctx, webhook.WebhookID, "",
+			data.Filters{Page: 1, PageSize: 10, Sort: "delivery_id", SortSafeList: []string{"delivery_id"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) != 1 {
+			t.Fatalf("got %d deliveries, want 1", len(deliveries))
+		}
+		return deliveries[0]
+	}
+
+	// A deactivated webhook's deliveries wait for it to be reactivated.
+	webhook.Active = false
+	if err := a.webhookModel.UpdateWebhook(ctx, webhook); err != nil {
+		t.Fatal(err)
+	}
+	if delivery, _ := claim(); delivery != nil {
+		t.Fatal("claimed a delivery of an inactive webhook")
+	}
+	webhook.Active = true
+	if err := a.webhookModel.UpdateWebhook(ctx, webhook); err != nil {
+		t.Fatal(err)
+	}
+
+	client := server.Client()
+	for attempt := 1; attempt <= a.config.webhook.maxAttempts; attempt++ {
+		delivery, claimed := claim()
+		if delivery == nil {
+			t.Fatalf("attempt %d: the delivery isn't due", attempt)
+		}
+		start := time.Now()
+		a.deliverWebhook(ctx, client, claimed, delivery)
+
+		got := stored()
+		if got.Attempts != attempt {
+			t.Errorf("attempt %d: attempts = %d", attempt, got.Attempts)
+		}
+		if got.LastStatusCode == nil || *got.LastStatusCode != receiver.statuses[min(attempt, 2)-1] {
+			t.Errorf("attempt %d: last_status_code = %v", attempt, got.LastStatusCode)
+		}
+
+		if attempt < a.config.webhook.maxAttempts {
+			if got.Status != data.DeliveryPending {
+				t.Fatalf("attempt %d: status = %s, want %s", attempt, got.Status, data.DeliveryPending)
+			}
+			backoff := got.NextAttemptAt.Sub(start)
+			if want := webhookBackoff(attempt); backoff < want-time.Second || backoff > want+time.Second {
+				t.Errorf("attempt %d: next attempt in %s, want %s", attempt, backoff, want)
+			}
+			if delivery, _ := claim(); delivery != nil {
+				t.Fatalf("attempt %d: the delivery was due again before its backoff ran out", attempt)
+			}
+
+			// Skip the wait.
+			_, err := a.db.ExecContext(ctx, `UPDATE webhook_deliveries SET next_attempt_at = NOW() WHERE delivery_id = $1`, got.DeliveryID)
+			if err != nil {
+				t.Fatal(err)
+			}
+		} else if got.Status != data.DeliveryDead {
+			t.Fatalf("status = %s after %d attempts, want %s", got.Status, attempt, data.DeliveryDead)
+		}
+	}
+
+	_, err := a.db.ExecContext(ctx, `UPDATE webhook_deliveries SET next_attempt_at = NOW() WHERE webhook_id = $1`, webhook.WebhookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery, _ := claim(); delivery != nil {
+		t.Error("a dead delivery was claimed")
+	}
+	if receiver.count() != a.config.webhook.maxAttempts {
+		t.Errorf("receiver got %d deliveries, want %d", receiver.count(), a.config.webhook.maxAttempts)
+	}
+}
@@ -0,0 +1,408 @@
+// Filename: cmd/prctl/backend.go
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mtechguy/test2/client"
+	"github.com/mtechguy/test2/internal/data"
+	"github.com/mtechguy/test2/internal/i18n"
+	"github.com/mtechguy/test2/internal/jobs"
+	"github.com/mtechguy/test2/internal/validator"
+)
+
+// backend is what the commands act on: the HTTP API, or the database
+// directly through internal/data.
+type backend interface {
+	ListProducts(ctx context.Context, filter client.ProductFilter) ([]*data.Product, data.Metadata, error)
+	// AllProducts fetches every product matching filter, whatever its page.
+	AllProducts(ctx context.Context, filter client.ProductFilter) ([]*data.Product, error)
+	GetProduct(ctx context.Context, id int64) (*data.Product, error)
+	CreateProduct(ctx context.Context, input client.ProductInput) (*data.Product, error)
+	UpdateProduct(ctx context.Context, id int64, update client.ProductUpdate) (*data.Product, error)
+	DeleteProduct(ctx context.Context, id int64) error
+
+	ListReviews(ctx context.Context, filter client.ReviewFilter) ([]*data.Review, data.Metadata, error)
+	// AllReviews fetches every review matching filter, whatever its page.
+	AllReviews(ctx context.Context, filter client.ReviewFilter) ([]*data.Review, error)
+	ListProductReviews(ctx context.Context, productID int64) ([]*data.Review, error)
+	GetReview(ctx context.Context, id int64) (*data.Review, error)
+	CreateReview(ctx context.Context, input client.ReviewInput) (*data.Review, error)
+	UpdateReview(ctx context.Context, id int64, update client.ReviewUpdate) (*data.Review, error)
+	DeleteReview(ctx context.Context, id int64) error
+
+	// RecomputeRating recalculates the average rating of a product, or
+	// queues a job for the API to do it when async is set.
+	RecomputeRating(ctx context.Context, productID int64, async bool) error
+}
+
+var errNeedsDatabase = errors.New("this command needs direct database access, run it with -db-dsn")
+
+// apiBackend talks to the HTTP API.
+type apiBackend struct {
+	*client.Client
+}
+
+func (b apiBackend) AllProducts(ctx context.Context, filter client.ProductFilter) ([]*data.Product, error) {
+	return allPages(filter.PageSize, func(page int, pageSize int) ([]*data.Product, data.Metadata, error) {
+		filter.Page, filter.PageSize = page, pageSize
+		return b.ListProducts(ctx, filter)
+	})
+}
+
+func (b apiBackend) AllReviews(ctx context.Context, filter client.ReviewFilter) ([]*data.Review, error) {
+	return allPages(filter.PageSize, func(page int, pageSize int) ([]*data.Review, data.Metadata, error) {
+		filter.Page, filter.PageSize = page, pageSize
+		return b.ListReviews(ctx, filter)
+	})
+}
+
+func (b apiBackend) RecomputeRating(ctx context.Context, productID int64, async bool) error {
+	return errNeedsDatabase
+}
+
+// dbBackend works on the database directly. It applies the same validation
+// as the API, but no webhooks or events are sent for its changes.
+type dbBackend struct {
+	products data.ProductModel
+	reviews  data.ReviewModel
+	jobs     data.JobModel
+}
+
+// validationError turns the errors of v into a single error, with the
+// messages in the default language.
+func validationError(v *validator.Validator) error {
+	var messages []string
+	for field, fieldErrors := range v.Errors {
+		for _, e := range fieldErrors {
+			messages = append(messages, field+" "+i18n.Translate(i18n.DefaultLanguage, e.Code, e.Params))
+		}
+	}
+	sort.Strings(messages)
+	return fmt.Errorf("validation failed: %s", strings.Join(messages, "; "))
+}
+
+// productFilters turns filter into the filters of the product list,
+// checked as the API checks them.
+func productFilters(filter client.ProductFilter) (data.Filters, error) {
+	filters := data.Filters{
+		Page:         filter.Page,
+		PageSize:     filter.PageSize,
+		Sort:         filter.Sort,
+		SortSafeList: []string{"product_id", "name", "-product_id", "-name"},
+	}
+	if filter.Locale != "" {
+		filters.Locales = data.LocalePreferences(data.NormalizeLocale(filter.Locale))
+	}
+	defaultFilters(&filters, "product_id")
+
+	v := validator.New()
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		return data.Filters{}, validationError(v)
+	}
+	return filters, nil
+}
+
+func (b dbBackend) ListProducts(ctx context.Context, filter client.ProductFilter) ([]*data.Product, data.Metadata, error) {
+	filters, err := productFilters(filter)
+	if err != nil {
+		return nil, data.Metadata{}, err
+	}
+	return b.products.GetAllProducts(ctx, filter.Name, filter.Category, filters)
+}
+
+// AllProducts walks the products in ID order, each page starting after the
+// last ID of the one before, so the last pages are as quick as the first
+// and the page limit of the lists doesn't cut it short. The products are
+// then sorted as asked.
+func (b dbBackend) AllProducts(ctx context.Context, filter client.ProductFilter) ([]*data.Product, error) {
+	filter.PageSize = cmp.Or(filter.PageSize, allPageSize)
+	filters, err := productFilters(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	sortBy := filters.Sort
+	filters.Page, filters.Sort = 1, "product_id"
+	products, err := keysetPages(filters.PageSize, func(after int64) ([]*data.Product, error) {
+		filters.After = after
+		products, _, err := b.products.GetAllProducts(ctx, filter.Name, filter.Category, filters)
+		return products, err
+	}, func(product *data.Product) int64 { return product.ProductID })
+	if err != nil {
+		return nil, err
+	}
+
+	switch sortBy {
+	case "-product_id":
+		slices.Reverse(products)
+	case "name", "-name":
+		sortByText(products, sortBy == "-name", func(product *data.Product) string { return product.Name })
+	}
+	return products, nil
+}
+
+func (b dbBackend) GetProduct(ctx context.Context, id int64) (*data.Product, error) {
+	return b.products.GetProduct(ctx, id)
+}
+
+func (b dbBackend) CreateProduct(ctx context.Context, input client.ProductInput) (*data.Product, error) {
+	product := &data.Product{
+		Name:        input.Name,
+		Description: input.Description,
+		Category:    input.Category,
+		ImageURL:    input.ImageURL,
+		Price:       input.Price,
+	}
+
+	v := validator.New()
+	data.ValidateProduct(v, product)
+	if !v.IsEmpty() {
+		return nil, validationError(v)
+	}
+
+	err := b.products.InsertProduct(ctx, product)
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+func (b dbBackend) UpdateProduct(ctx context.Context, id int64, update client.ProductUpdate) (*data.Product, error) {
+	product, err := b.products.GetProduct(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Name != nil {
+		product.Name = *update.Name
+	}
+	if update.Description != nil {
+		product.Description = *update.Description
+	}
+	if update.Category != nil {
+		product.Category = *update.Category
+	}
+	if update.ImageURL != nil {
+		product.ImageURL = *update.ImageURL
+	}
+	if update.Price != nil {
+		product.Price = *update.Price
+	}
+
+	v := validator.New()
+	data.ValidateProduct(v, product)
+	if !v.IsEmpty() {
+		return nil, validationError(v)
+	}
+
+	err = b.products.UpdateProduct(ctx, product)
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+func (b dbBackend) DeleteProduct(ctx context.Context, id int64) error {
+	return b.products.DeleteProduct(ctx, id)
+}
+
+// reviewFilters turns filter into the filters of the review list, checked
+// as the API checks them.
+func reviewFilters(filter client.ReviewFilter) (data.Filters, error) {
+	filters := data.Filters{
+		Page:         filter.Page,
+		PageSize:     filter.PageSize,
+		Sort:         filter.Sort,
+		SortSafeList: []string{"review_id", "author", "-review_id", "-author"},
+	}
+	defaultFilters(&filters, "review_id")
+
+	v := validator.New()
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		return data.Filters{}, validationError(v)
+	}
+	return filters, nil
+}
+
+func (b dbBackend) ListReviews(ctx context.Context, filter client.ReviewFilter) ([]*data.Review, data.Metadata, error) {
+	filters, err := reviewFilters(filter)
+	if err != nil {
+		return nil, data.Metadata{}, err
+	}
+	return b.reviews.GetAllReviews(ctx, filter.Author, filters)
+}
+
+// AllReviews is the review counterpart of AllProducts.
+func (b dbBackend) AllReviews(ctx context.Context, filter client.ReviewFilter) ([]*data.Review, error) {
+	filter.PageSize = cmp.Or(filter.PageSize, allPageSize)
+	filters, err := reviewFilters(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	sortBy := filters.Sort
+	filters.Page, filters.Sort = 1, "review_id"
+	reviews, err := keysetPages(filters.PageSize, func(after int64) ([]*data.Review, error) {
+		filters.After = after
+		reviews, _, err := b.reviews.GetAllReviews(ctx, filter.Author, filters)
+		return reviews, err
+	}, func(review *data.Review) int64 { return review.ReviewID })
+	if err != nil {
+		return nil, err
+	}
+
+	switch sortBy {
+	case "-review_id":
+		slices.Reverse(reviews)
+	case "author", "-author":
+		sortByText(reviews, sortBy == "-author", func(review *data.Review) string { return review.Author })
+	}
+	return reviews, nil
+}
+
+func (b dbBackend) ListProductReviews(ctx context.Context, productID int64) ([]*data.Review, error) {
+	exists, err := b.products.ProductExists(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, data.ErrRecordNotFound
+	}
+
+	reviews, err := b.reviews.GetAllProductReviews(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*data.Review, len(reviews))
+	for i := range reviews {
+		list[i] = &reviews[i]
+	}
+	return list, nil
+}
+
+func (b dbBackend) GetReview(ctx context.Context, id int64) (*data.Review, error) {
+	return b.reviews.GetReview(ctx, id)
+}
+
+func (b dbBackend) CreateReview(ctx context.Context, input client.ReviewInput) (*data.Review, error) {
+	review := &data.Review{
+		ProductID:  input.ProductID,
+		Author:     input.Author,
+		Rating:     input.Rating,
+		ReviewText: input.ReviewText,
+	}
+
+	v := validator.New()
+	data.ValidateReview(v, review)
+	if !v.IsEmpty() {
+		return nil, validationError(v)
+	}
+
+	exists, err := b.products.ProductExists(ctx, review.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("product %d: %w", review.ProductID, data.ErrRecordNotFound)
+	}
+
+	err = b.reviews.InsertReview(ctx, review)
+	if err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+func (b dbBackend) UpdateReview(ctx context.Context, id int64, update client.ReviewUpdate) (*data.Review, error) {
+	review, err := b.reviews.GetReview(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Author != nil {
+		review.Author = *update.Author
+	}
+	if update.Rating != nil {
+		review.Rating = *update.Rating
+	}
+	if update.ReviewText != nil {
+		review.ReviewText = *update.ReviewText
+	}
+
+	v := validator.New()
+	data.ValidateReview(v, review)
+	if !v.IsEmpty() {
+		return nil, validationError(v)
+	}
+
+	err = b.reviews.UpdateReview(ctx, review)
+	if err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+func (b dbBackend) DeleteReview(ctx context.Context, id int64) error {
+	return b.reviews.DeleteReview(ctx, id)
+}
+
+func (b dbBackend) RecomputeRating(ctx context.Context, productID int64, async bool) error {
+	if !async {
+		return b.products.RecomputeAverageRating(ctx, productID)
+	}
+
+	_, err := jobs.EnqueueRecomputeRating(ctx, b.jobs, productID)
+	return err
+}
+
+// keysetPages fetches every record of a list in ID order. fetch returns
+// the page of records after an ID, id gives the ID of a record.
+func keysetPages[T any](pageSize int, fetch func(after int64) ([]T, error), id func(T) int64) ([]T, error) {
+	var all []T
+	var after int64
+	for {
+		records, err := fetch(after)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, records...)
+		if len(records) < pageSize {
+			return all, nil
+		}
+		after = id(records[len(records)-1])
+	}
+}
+
+// sortByText sorts records in ID order by the text key gives them, keeping
+// the ID order among equal keys as the lists do.
+func sortByText[T any](records []T, descending bool, key func(T) string) {
+	slices.SortStableFunc(records, func(a, b T) int {
+		if descending {
+			return strings.Compare(key(b), key(a))
+		}
+		return strings.Compare(key(a), key(b))
+	})
+}
+
+// defaultFilters fills in what the API defaults when a parameter is
+// missing.
+func defaultFilters(filters *data.Filters, sort string) {
+	if filters.Page == 0 {
+		filters.Page = 1
+	}
+	if filters.PageSize == 0 {
+		filters.PageSize = 10
+	}
+	if filters.Sort == "" {
+		filters.Sort = sort
+	}
+}
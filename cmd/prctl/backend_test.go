@@ -0,0 +1,74 @@
+// Filename: cmd/prctl/backend_test.go
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestKeysetPages(t *testing.T) {
+	tests := []struct {
+		name     string
+		records  int
+		pageSize int
+		want     []int64 // the IDs the pages start after
+	}{
+		{name: "empty", records: 0, pageSize: 3, want: []int64{0}},
+		{name: "partial last page", records: 7, pageSize: 3, want: []int64{0, 3, 6}},
+		{name: "full last page", records: 6, pageSize: 3, want: []int64{0, 3, 6}},
+		// Far more records than the 500 pages the lists allow.
+		{name: "past the page limit", records: 1003, pageSize: 2, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var afters []int64
+			fetch := func(after int64) ([]int64, error) {
+				afters = append(afters, after)
+				var page []int64
+				for id := after + 1; id <= int64(tt.records) && len(page) < tt.pageSize; id++ {
+					page = append(page, id)
+				}
+				return page, nil
+			}
+
+			ids, err := keysetPages(tt.pageSize, fetch, func(id int64) int64 { return id })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ids) != tt.records || (tt.records > 0 && ids[len(ids)-1] != int64(tt.records)) {
+				t.Errorf("got %d records, want %d", len(ids), tt.records)
+			}
+			if tt.want != nil && !slices.Equal(afters, tt.want) {
+				t.Errorf("pages started after %v, want %v", afters, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortByText(t *testing.T) {
+	type record struct {
+		id   int
+		name string
+	}
+	records := []record{{1, "b"}, {2, "a"}, {3, "b"}, {4, "c"}}
+	ids := func(records []record) []int {
+		var ids []int
+		for _, r := range records {
+			ids = append(ids, r.id)
+		}
+		return ids
+	}
+
+	ascending := slices.Clone(records)
+	sortByText(ascending, false, func(r record) string { return r.name })
+	if got, want := ids(ascending), []int{2, 1, 3, 4}; !slices.Equal(got, want) {
+		t.Errorf("ascending = %v, want %v", got, want)
+	}
+
+	// Equal names stay in ID order, as in the lists.
+	descending := slices.Clone(records)
+	sortByText(descending, true, func(r record) string { return r.name })
+	if got, want := ids(descending), []int{4, 1, 3, 2}; !slices.Equal(got, want) {
+		t.Errorf("descending = %v, want %v", got, want)
+	}
+}
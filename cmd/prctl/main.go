@@ -0,0 +1,209 @@
+// Filename: cmd/prctl/main.go
+
+// Command prctl manages the products and reviews of the product review API
+// from the command line. It talks to the HTTP API by default, or straight
+// to the database through internal/data when given -db-dsn.
+//
+//	prctl products list -category kitchen
+//	prctl -o json reviews get 12
+//	prctl -db-dsn "$PRODUCT_REVIEW_DB_DSN" ratings recompute -all
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/mtechguy/test2/client"
+	"github.com/mtechguy/test2/internal/data"
+)
+
+// errUsage means the command line was wrong. The usage has already been
+// printed, so main only sets the exit status.
+var errUsage = errors.New("usage")
+
+type config struct {
+	api    string
+	dsn    string
+	output string
+}
+
+// cli holds what every command needs.
+type cli struct {
+	backend backend
+	out     printer
+	stdout  io.Writer
+	stderr  io.Writer
+}
+
+// command is a subcommand, e.g. the list in prctl products list.
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(ctx context.Context, c *cli, args []string) error
+}
+
+// resources maps the first argument to the commands acting on it.
+var resources = map[string][]command{}
+
+// resourceOrder is the order resources are listed in the usage.
+var resourceOrder = []string{"products", "reviews", "ratings"}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	var setting config
+
+	flags := flag.NewFlagSet("prctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&setting.api, "api", envOr("PRCTL_API", "http://localhost:4000"), "API base URL")
+	flags.StringVar(&setting.dsn, "db-dsn", os.Getenv("PRODUCT_REVIEW_DB_DSN"), "PostgreSQL DSN; when set, the database is used instead of the API")
+	flags.StringVar(&setting.output, "o", "table", "Output format (table|json)")
+	flags.Usage = func() { usage(flags) }
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+
+	out, ok := printers[setting.output]
+	if !ok {
+		fmt.Fprintf(stderr, "prctl: unknown output format %q\n", setting.output)
+		return 2
+	}
+
+	cmd, cmdArgs, ok := lookup(flags.Args())
+	if !ok {
+		usage(flags)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	c := &cli{out: out, stdout: stdout, stderr: stderr}
+	if setting.dsn != "" {
+		db, err := openDB(setting.dsn)
+		if err != nil {
+			fmt.Fprintf(stderr, "prctl: database connection failed: %v\n", err)
+			return 1
+		}
+		defer db.Close()
+
+		c.backend = dbBackend{
+			products: data.ProductModel{DB: db},
+			reviews:  data.ReviewModel{DB: db},
+			jobs:     data.JobModel{DB: db},
+		}
+	} else {
+		c.backend = apiBackend{client.New(setting.api)}
+	}
+
+	err = cmd.run(ctx, c, cmdArgs)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	default:
+		fmt.Fprintf(stderr, "prctl: %v\n", describeError(err))
+		return 1
+	}
+}
+
+// lookup finds the command named by the first two arguments.
+func lookup(args []string) (command, []string, bool) {
+	if len(args) < 2 {
+		return command{}, nil, false
+	}
+	for _, cmd := range resources[args[0]] {
+		if cmd.name == args[1] {
+			return cmd, args[2:], true
+		}
+	}
+	return command{}, nil, false
+}
+
+func usage(flags *flag.FlagSet) {
+	w := flags.Output()
+	fmt.Fprintln(w, "Usage: prctl [flags] <resource> <command> [command flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Flags:")
+	flags.PrintDefaults()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, resource := range resourceOrder {
+		for _, cmd := range resources[resource] {
+			fmt.Fprintf(w, "  %s %s %s\n    \t%s\n", resource, cmd.name, cmd.usage, cmd.summary)
+		}
+	}
+}
+
+// newFlagSet returns the flag set of a command, printing its usage on
+// errors.
+func newFlagSet(c *cli, resource string, name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(resource+" "+name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		cmd, _, _ := lookup([]string{resource, name})
+		fmt.Fprintf(c.stderr, "Usage: prctl %s %s %s\n", resource, name, cmd.usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags parses the flags of a command, turning every failure into
+// errUsage.
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	err := flags.Parse(args)
+	if err != nil {
+		return errUsage
+	}
+	return nil
+}
+
+// describeError makes the errors of both backends read the same.
+func describeError(err error) error {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound), errors.Is(err, client.ErrNotFound):
+		return errors.New("not found")
+	case errors.Is(err, client.ErrConflict):
+		return errors.New("the record was changed at the same time, try again")
+	}
+	return err
+}
+
+func envOr(key string, fallback string) string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	return value
+}
+
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,136 @@
+// Filename: cmd/prctl/output.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mtechguy/test2/internal/data"
+)
+
+// printer writes the results of the commands in one output format.
+type printer interface {
+	Product(w io.Writer, product *data.Product) error
+	Products(w io.Writer, products []*data.Product, metadata *data.Metadata) error
+	Review(w io.Writer, review *data.Review) error
+	Reviews(w io.Writer, reviews []*data.Review, metadata *data.Metadata) error
+	// Message reports the outcome of a command that has no record to show.
+	Message(w io.Writer, fields map[string]any, format string, args ...any) error
+}
+
+var printers = map[string]printer{
+	"table": tablePrinter{},
+	"json":  jsonPrinter{},
+}
+
+// tablePrinter lines records up in columns, one per line.
+type tablePrinter struct{}
+
+func (t tablePrinter) Product(w io.Writer, product *data.Product) error {
+	return t.Products(w, []*data.Product{product}, nil)
+}
+
+func (tablePrinter) Products(w io.Writer, products []*data.Product, metadata *data.Metadata) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tCATEGORY\tPRICE\tRATING\tVERSION")
+	for _, p := range products {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%.2f\t%d\n",
+			p.ProductID, truncate(p.Name, 40), truncate(p.Category, 20), p.Price, p.AverageRating, p.Version)
+	}
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+	return printPage(w, metadata)
+}
+
+func (t tablePrinter) Review(w io.Writer, review *data.Review) error {
+	return t.Reviews(w, []*data.Review{review}, nil)
+}
+
+func (tablePrinter) Reviews(w io.Writer, reviews []*data.Review, metadata *data.Metadata) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tPRODUCT\tAUTHOR\tRATING\tHELPFUL\tTEXT")
+	for _, r := range reviews {
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%d\t%d\t%s\n",
+			r.ReviewID, r.ProductID, r.Author, r.Rating, r.HelpfulCount, truncate(r.ReviewText, 50))
+	}
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+	return printPage(w, metadata)
+}
+
+func (tablePrinter) Message(w io.Writer, fields map[string]any, format string, args ...any) error {
+	_, err := fmt.Fprintf(w, format+"\n", args...)
+	return err
+}
+
+// printPage tells which page of a list was shown.
+func printPage(w io.Writer, metadata *data.Metadata) error {
+	if metadata == nil || metadata.TotalRecords == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "\npage %d of %d, %d records\n", metadata.CurrentPage, metadata.LastPage, metadata.TotalRecords)
+	return err
+}
+
+// truncate shortens s to at most n runes, on one line.
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// jsonPrinter writes the same envelopes as the v2 API, so its output can be
+// fed to tools written against the API.
+type jsonPrinter struct{}
+
+func (jsonPrinter) Product(w io.Writer, product *data.Product) error {
+	return encodeJSON(w, map[string]any{"product": product})
+}
+
+func (jsonPrinter) Products(w io.Writer, products []*data.Product, metadata *data.Metadata) error {
+	if products == nil {
+		products = []*data.Product{}
+	}
+	return encodeJSON(w, listEnvelope("products", products, metadata))
+}
+
+func (jsonPrinter) Review(w io.Writer, review *data.Review) error {
+	return encodeJSON(w, map[string]any{"review": review})
+}
+
+func (jsonPrinter) Reviews(w io.Writer, reviews []*data.Review, metadata *data.Metadata) error {
+	if reviews == nil {
+		reviews = []*data.Review{}
+	}
+	return encodeJSON(w, listEnvelope("reviews", reviews, metadata))
+}
+
+func (jsonPrinter) Message(w io.Writer, fields map[string]any, format string, args ...any) error {
+	return encodeJSON(w, fields)
+}
+
+// listEnvelope puts a list under its key, with the metadata of the page
+// when there is one.
+func listEnvelope(key string, records any, metadata *data.Metadata) map[string]any {
+	envelope := map[string]any{key: records}
+	if metadata != nil {
+		envelope["metadata"] = metadata
+	}
+	return envelope
+}
+
+func encodeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(v)
+}
@@ -0,0 +1,212 @@
+// Filename: cmd/prctl/products.go
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/mtechguy/test2/client"
+	"github.com/mtechguy/test2/internal/data"
+)
+
+func init() {
+	resources["products"] = []command{
+		{"list", "[-name N] [-category C] [-locale L] [-page P] [-page-size S] [-sort F] [-all]", "List products", listProducts},
+		{"get", "ID", "Show a product", getProduct},
+		{"create", "-name N -description D -category C -image-url U [-price P]", "Create a product", createProduct},
+		{"update", "[-name N] [-description D] [-category C] [-image-url U] [-price P] ID", "Change the given fields of a product", updateProduct},
+		{"delete", "ID...", "Delete products and their reviews", deleteProducts},
+	}
+}
+
+func listProducts(ctx context.Context, c *cli, args []string) error {
+	var filter client.ProductFilter
+	var all bool
+
+	flags := newFlagSet(c, "products", "list")
+	flags.StringVar(&filter.Name, "name", "", "Full-text search on the name")
+	flags.StringVar(&filter.Category, "category", "", "Full-text search on the category")
+	flags.StringVar(&filter.Locale, "locale", "", "Translation to show, e.g. es")
+	pageFlags(flags, &filter.Page, &filter.PageSize, &filter.Sort, &all)
+	err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if all {
+		products, err := c.backend.AllProducts(ctx, filter)
+		if err != nil {
+			return err
+		}
+		return c.out.Products(c.stdout, products, nil)
+	}
+
+	products, metadata, err := c.backend.ListProducts(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return c.out.Products(c.stdout, products, &metadata)
+}
+
+func getProduct(ctx context.Context, c *cli, args []string) error {
+	flags := newFlagSet(c, "products", "get")
+	ids, err := parseIDs(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	product, err := c.backend.GetProduct(ctx, ids[0])
+	if err != nil {
+		return recordError("product", ids[0], err)
+	}
+	return c.out.Product(c.stdout, product)
+}
+
+func createProduct(ctx context.Context, c *cli, args []string) error {
+	var input client.ProductInput
+
+	flags := newFlagSet(c, "products", "create")
+	flags.StringVar(&input.Name, "name", "", "Name")
+	flags.StringVar(&input.Description, "description", "", "Description")
+	flags.StringVar(&input.Category, "category", "", "Category")
+	flags.StringVar(&input.ImageURL, "image-url", "", "Image URL")
+	flags.StringVar(&input.Price, "price", "", "Price")
+	_, err := parseIDs(flags, args, 0)
+	if err != nil {
+		return err
+	}
+
+	product, err := c.backend.CreateProduct(ctx, input)
+	if err != nil {
+		return err
+	}
+	return c.out.Product(c.stdout, product)
+}
+
+func updateProduct(ctx context.Context, c *cli, args []string) error {
+	var input client.ProductInput
+
+	flags := newFlagSet(c, "products", "update")
+	flags.StringVar(&input.Name, "name", "", "New name")
+	flags.StringVar(&input.Description, "description", "", "New description")
+	flags.StringVar(&input.Category, "category", "", "New category")
+	flags.StringVar(&input.ImageURL, "image-url", "", "New image URL")
+	flags.StringVar(&input.Price, "price", "", "New price")
+	ids, err := parseIDs(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	// Only the flags given on the command line are changed
+	var update client.ProductUpdate
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name":
+			update.Name = &input.Name
+		case "description":
+			update.Description = &input.Description
+		case "category":
+			update.Category = &input.Category
+		case "image-url":
+			update.ImageURL = &input.ImageURL
+		case "price":
+			update.Price = &input.Price
+		}
+	})
+	if update == (client.ProductUpdate{}) {
+		flags.Usage()
+		return errUsage
+	}
+
+	product, err := c.backend.UpdateProduct(ctx, ids[0], update)
+	if err != nil {
+		return recordError("product", ids[0], err)
+	}
+	return c.out.Product(c.stdout, product)
+}
+
+func deleteProducts(ctx context.Context, c *cli, args []string) error {
+	flags := newFlagSet(c, "products", "delete")
+	ids, err := parseIDs(flags, args, -1)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err := c.backend.DeleteProduct(ctx, id)
+		if err != nil {
+			return recordError("product", id, err)
+		}
+		err = c.out.Message(c.stdout, map[string]any{"product_id": id, "deleted": true}, "deleted product %d", id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pageFlags adds the pagination and sort flags shared by the lists.
+func pageFlags(flags *flag.FlagSet, page *int, pageSize *int, sort *string, all *bool) {
+	flags.IntVar(page, "page", 0, "Page to show (default 1)")
+	flags.IntVar(pageSize, "page-size", 0, "Records per page (default 10)")
+	flags.StringVar(sort, "sort", "", "Sort field, prefixed with - for descending order")
+	flags.BoolVar(all, "all", false, "Show every page")
+}
+
+// allPageSize is the page size used to fetch every page of a list, the
+// largest the API accepts, unless another one was asked for.
+const allPageSize = 100
+
+// allPages fetches every page of a list by page number.
+func allPages[T any](pageSize int, fetch func(page int, pageSize int) ([]T, data.Metadata, error)) ([]T, error) {
+	pageSize = cmp.Or(pageSize, allPageSize)
+
+	var all []T
+	for page := 1; ; page++ {
+		records, metadata, err := fetch(page, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, records...)
+		if len(records) == 0 || page >= metadata.LastPage {
+			return all, nil
+		}
+	}
+}
+
+// parseIDs parses the flags of a command followed by record IDs. want is
+// the number of IDs expected, or -1 for one or more.
+func parseIDs(flags *flag.FlagSet, args []string, want int) ([]int64, error) {
+	err := parseFlags(flags, args)
+	if err != nil {
+		return nil, err
+	}
+
+	rest := flags.Args()
+	if (want < 0 && len(rest) == 0) || (want >= 0 && len(rest) != want) {
+		flags.Usage()
+		return nil, errUsage
+	}
+
+	ids := make([]int64, len(rest))
+	for i, arg := range rest {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("invalid ID %q", arg)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// recordError names the record a not found error is about.
+func recordError(kind string, id int64, err error) error {
+	if errors.Is(err, data.ErrRecordNotFound) || errors.Is(err, client.ErrNotFound) {
+		return fmt.Errorf("%s %d not found", kind, id)
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+// Filename: cmd/prctl/ratings.go
+package main
+
+import (
+	"context"
+
+	"github.com/mtechguy/test2/client"
+)
+
+func init() {
+	resources["ratings"] = []command{
+		{"recompute", "[-async] -all | ID...", "Recalculate the average rating of products (needs -db-dsn)", recomputeRatings},
+	}
+}
+
+func recomputeRatings(ctx context.Context, c *cli, args []string) error {
+	var all, async bool
+
+	flags := newFlagSet(c, "ratings", "recompute")
+	flags.BoolVar(&all, "all", false, "Recompute every product")
+	flags.BoolVar(&async, "async", false, "Queue jobs for the API's workers instead of recomputing now")
+	err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if all == (flags.NArg() > 0) {
+		flags.Usage()
+		return errUsage
+	}
+	if _, ok := c.backend.(apiBackend); ok {
+		return errNeedsDatabase
+	}
+
+	var ids []int64
+	if all {
+		products, err := c.backend.AllProducts(ctx, client.ProductFilter{})
+		if err != nil {
+			return err
+		}
+		for _, product := range products {
+			ids = append(ids, product.ProductID)
+		}
+	} else {
+		ids, err = parseIDs(flags, flags.Args(), -1)
+		if err != nil {
+			return err
+		}
+	}
+
+	verb := "recomputed"
+	if async {
+		verb = "queued"
+	}
+	for _, id := range ids {
+		err := c.backend.RecomputeRating(ctx, id, async)
+		if err != nil {
+			return recordError("product", id, err)
+		}
+		err = c.out.Message(c.stdout, map[string]any{"product_id": id, "status": verb}, "%s rating of product %d", verb, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
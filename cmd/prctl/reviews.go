@@ -0,0 +1,231 @@
+// Filename: cmd/prctl/reviews.go
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/mtechguy/test2/client"
+)
+
+// redactedText replaces the text of a redacted review.
+const redactedText = "[removed by a moderator]"
+
+func init() {
+	resources["reviews"] = []command{
+		{"list", "[-author A] [-product ID] [-page P] [-page-size S] [-sort F] [-all]", "List reviews", listReviews},
+		{"get", "ID", "Show a review", getReview},
+		{"create", "-product ID -author A -rating R -text T", "Create a review", createReview},
+		{"update", "[-author A] [-rating R] [-text T] ID", "Change the given fields of a review", updateReview},
+		{"delete", "ID...", "Delete reviews", deleteReviews},
+		{"moderate", "-action redact|remove [-author A] [ID...]", "Redact or remove reviews, by ID or by author", moderateReviews},
+	}
+}
+
+func listReviews(ctx context.Context, c *cli, args []string) error {
+	var filter client.ReviewFilter
+	var productID int64
+	var all bool
+
+	flags := newFlagSet(c, "reviews", "list")
+	flags.StringVar(&filter.Author, "author", "", "Full-text search on the author")
+	flags.Int64Var(&productID, "product", 0, "Only the reviews of this product, which are never paginated")
+	pageFlags(flags, &filter.Page, &filter.PageSize, &filter.Sort, &all)
+	err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if productID != 0 {
+		reviews, err := c.backend.ListProductReviews(ctx, productID)
+		if err != nil {
+			return recordError("product", productID, err)
+		}
+		return c.out.Reviews(c.stdout, reviews, nil)
+	}
+
+	if all {
+		reviews, err := c.backend.AllReviews(ctx, filter)
+		if err != nil {
+			return err
+		}
+		return c.out.Reviews(c.stdout, reviews, nil)
+	}
+
+	reviews, metadata, err := c.backend.ListReviews(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return c.out.Reviews(c.stdout, reviews, &metadata)
+}
+
+func getReview(ctx context.Context, c *cli, args []string) error {
+	flags := newFlagSet(c, "reviews", "get")
+	ids, err := parseIDs(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	review, err := c.backend.GetReview(ctx, ids[0])
+	if err != nil {
+		return recordError("review", ids[0], err)
+	}
+	return c.out.Review(c.stdout, review)
+}
+
+func createReview(ctx context.Context, c *cli, args []string) error {
+	var input client.ReviewInput
+
+	flags := newFlagSet(c, "reviews", "create")
+	flags.Int64Var(&input.ProductID, "product", 0, "ID of the product reviewed")
+	flags.StringVar(&input.Author, "author", "", "Author")
+	flags.Int64Var(&input.Rating, "rating", 0, "Rating from 1 to 5")
+	flags.StringVar(&input.ReviewText, "text", "", "Text of the review")
+	_, err := parseIDs(flags, args, 0)
+	if err != nil {
+		return err
+	}
+
+	review, err := c.backend.CreateReview(ctx, input)
+	if err != nil {
+		return recordError("product", input.ProductID, err)
+	}
+	return c.out.Review(c.stdout, review)
+}
+
+func updateReview(ctx context.Context, c *cli, args []string) error {
+	var input client.ReviewInput
+
+	flags := newFlagSet(c, "reviews", "update")
+	flags.StringVar(&input.Author, "author", "", "New author")
+	flags.Int64Var(&input.Rating, "rating", 0, "New rating from 1 to 5")
+	flags.StringVar(&input.ReviewText, "text", "", "New text")
+	ids, err := parseIDs(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	// Only the flags given on the command line are changed
+	var update client.ReviewUpdate
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "author":
+			update.Author = &input.Author
+		case "rating":
+			update.Rating = &input.Rating
+		case "text":
+			update.ReviewText = &input.ReviewText
+		}
+	})
+	if update == (client.ReviewUpdate{}) {
+		flags.Usage()
+		return errUsage
+	}
+
+	review, err := c.backend.UpdateReview(ctx, ids[0], update)
+	if err != nil {
+		return recordError("review", ids[0], err)
+	}
+	return c.out.Review(c.stdout, review)
+}
+
+func deleteReviews(ctx context.Context, c *cli, args []string) error {
+	flags := newFlagSet(c, "reviews", "delete")
+	ids, err := parseIDs(flags, args, -1)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err := c.backend.DeleteReview(ctx, id)
+		if err != nil {
+			return recordError("review", id, err)
+		}
+		err = c.out.Message(c.stdout, map[string]any{"review_id": id, "deleted": true}, "deleted review %d", id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moderateReviews redacts or removes reviews, given by ID or as everything
+// written by an author. Redacting keeps the review and its rating but
+// replaces its text; removing deletes it.
+func moderateReviews(ctx context.Context, c *cli, args []string) error {
+	var action, author string
+
+	flags := newFlagSet(c, "reviews", "moderate")
+	flags.StringVar(&action, "action", "", "What to do with the reviews (redact|remove)")
+	flags.StringVar(&author, "author", "", "Moderate every review written by this author")
+	err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if (action != "redact" && action != "remove") || (author == "") == (flags.NArg() == 0) {
+		flags.Usage()
+		return errUsage
+	}
+
+	var ids []int64
+	if author != "" {
+		ids, err = authorReviews(ctx, c.backend, author)
+		if err != nil {
+			return err
+		}
+	} else {
+		ids, err = parseIDs(flags, flags.Args(), -1)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, id := range ids {
+		switch action {
+		case "redact":
+			text := redactedText
+			_, err = c.backend.UpdateReview(ctx, id, client.ReviewUpdate{ReviewText: &text})
+		case "remove":
+			err = c.backend.DeleteReview(ctx, id)
+		}
+		if err != nil {
+			return recordError("review", id, err)
+		}
+
+		err = c.out.Message(c.stdout, map[string]any{"review_id": id, "action": action}, "%s review %d", pastTense(action), id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// authorReviews finds the IDs of the reviews written by author. The author
+// filter of the lists is a full-text search, so the matches are narrowed
+// down to the exact name.
+func authorReviews(ctx context.Context, b backend, author string) ([]int64, error) {
+	reviews, err := b.AllReviews(ctx, client.ReviewFilter{Author: author})
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	for _, review := range reviews {
+		if strings.EqualFold(review.Author, author) {
+			ids = append(ids, review.ReviewID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no reviews by %q", author)
+	}
+	return ids, nil
+}
+
+func pastTense(action string) string {
+	if action == "redact" {
+		return "redacted"
+	}
+	return "removed"
+}
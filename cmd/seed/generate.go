@@ -0,0 +1,160 @@
+// Filename: cmd/seed/generate.go
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/mtechguy/test2/internal/data"
+)
+
+// catalogue is what products are made of, by category. Names are built as
+// adjective, material and item, e.g. Compact Bamboo Cutting Board.
+var catalogue = []struct {
+	category  string
+	items     []string
+	materials []string
+}{
+	{"Kitchen", []string{"Cutting Board", "Chef Knife", "Frying Pan", "Saucepan", "Mixing Bowl", "Kettle", "Spatula", "Colander"}, []string{"Bamboo", "Stainless Steel", "Cast Iron", "Ceramic", "Silicone", "Copper"}},
+	{"Electronics", []string{"Headphones", "Bluetooth Speaker", "Power Bank", "Webcam", "Keyboard", "Mouse", "USB Hub", "Smart Plug"}, []string{"Aluminium", "Plastic", "Matte Black", "Carbon Fibre", "Rubberised"}},
+	{"Outdoor", []string{"Tent", "Sleeping Bag", "Backpack", "Camping Stove", "Headlamp", "Water Bottle", "Hammock", "Trekking Poles"}, []string{"Nylon", "Ripstop", "Titanium", "Waterproof", "Insulated"}},
+	{"Home", []string{"Throw Blanket", "Desk Lamp", "Wall Clock", "Storage Basket", "Cushion", "Picture Frame", "Candle", "Doormat"}, []string{"Wool", "Linen", "Oak", "Rattan", "Velvet", "Glass"}},
+	{"Sports", []string{"Yoga Mat", "Dumbbell Set", "Jump Rope", "Football", "Tennis Racket", "Cycling Gloves", "Foam Roller"}, []string{"Cork", "Neoprene", "Leather", "Graphite", "Mesh"}},
+	{"Beauty", []string{"Hair Dryer", "Face Serum", "Makeup Brush Set", "Shaving Kit", "Hand Cream", "Nail Clipper"}, []string{"Argan", "Charcoal", "Vegan", "Travel", "Organic"}},
+	{"Toys", []string{"Building Blocks", "Puzzle", "Plush Bear", "Kite", "Board Game", "Remote Control Car"}, []string{"Wooden", "Felt", "Recycled", "Glow-in-the-Dark"}},
+	{"Books", []string{"Cookbook", "Travel Guide", "Notebook", "Sketchbook", "Planner", "Field Guide"}, []string{"Hardcover", "Paperback", "Spiral-Bound", "Illustrated"}},
+	{"Garden", []string{"Watering Can", "Pruning Shears", "Planter", "Garden Hose", "Bird Feeder", "Trowel"}, []string{"Galvanised", "Terracotta", "Steel", "Cedar", "Recycled Plastic"}},
+	{"Pet Supplies", []string{"Dog Bed", "Cat Tree", "Leash", "Food Bowl", "Chew Toy", "Grooming Brush"}, []string{"Orthopaedic", "Nylon", "Stainless Steel", "Natural Rubber", "Plush"}},
+}
+
+var adjectives = []string{
+	"Compact", "Deluxe", "Classic", "Everyday", "Premium", "Lightweight", "Heavy-Duty", "Modern",
+	"Portable", "Essential", "Pro", "Eco", "Ultra", "Vintage", "Smart", "Foldable",
+}
+
+var features = []string{
+	"built to last", "easy to clean", "great for small spaces", "designed for everyday use",
+	"backed by a two-year warranty", "made from responsibly sourced materials", "perfect as a gift",
+	"tested by professionals", "comfortable to hold", "available in several colours",
+}
+
+var firstNames = []string{
+	"Aaliyah", "Ana", "Arjun", "Ben", "Carlos", "Chen", "Chloe", "Daniel", "Dmitri", "Elena",
+	"Fatima", "Grace", "Hana", "Ibrahim", "Isla", "Jamal", "Jose", "Kai", "Keisha", "Liam",
+	"Lucia", "Maya", "Mohammed", "Nia", "Noah", "Olivia", "Priya", "Rafael", "Sara", "Tariq",
+	"Thomas", "Valentina", "Wei", "Yara", "Zoe",
+}
+
+var lastNames = []string{
+	"Adams", "Baptiste", "Castillo", "Dubois", "Edwards", "Fernandez", "Garcia", "Hughes", "Ito",
+	"Johnson", "Khan", "Lopez", "Martin", "Nguyen", "Okafor", "Patel", "Quinn", "Reyes", "Smith",
+	"Tanaka", "Usman", "Vargas", "Williams", "Young", "Zhang",
+}
+
+// opinions holds sentences for each rating, from 1 to 5 stars.
+var opinions = [5][]string{
+	{"Broke within a week.", "Very disappointed with the quality.", "Not as described at all.", "Would not buy again.", "Returned it the next day."},
+	{"Works, but feels cheap.", "Expected more for the price.", "Stopped working properly after a month.", "The instructions were useless."},
+	{"Does the job.", "Average quality, average price.", "Some good points and some bad ones.", "Fine for occasional use."},
+	{"Good value for money.", "Works well, minor issues only.", "Would recommend it to a friend.", "Solid and well made."},
+	{"Absolutely love it!", "Exceeded my expectations.", "Best purchase I've made this year.", "Excellent quality, fast delivery.", "Five stars, no complaints."},
+}
+
+var details = []string{
+	"I use it every day.", "Bought it as a gift.", "Arrived well packaged.", "Took a while to arrive.",
+	"The colour is slightly different from the photos.", "Setup took five minutes.",
+	"My family uses it too.", "Customer service was helpful.", "It is smaller than I expected.",
+}
+
+// generator produces the seed data. Every value comes from one random
+// source, so a given seed always produces the same rows in the same order.
+type generator struct {
+	rng *rand.Rand
+}
+
+func newGenerator(seed uint64) *generator {
+	return &generator{rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+func pick[T any](g *generator, values []T) T {
+	return values[g.rng.IntN(len(values))]
+}
+
+// product generates the n-th product. Its quality is the mean rating its
+// reviews will be drawn around.
+func (g *generator) product(n int) (*data.Product, float64) {
+	entry := catalogue[g.rng.IntN(len(catalogue))]
+	item := pick(g, entry.items)
+	material := pick(g, entry.materials)
+	name := fmt.Sprintf("%s %s %s", pick(g, adjectives), material, item)
+
+	noun := strings.ToLower(material + " " + item)
+	first := g.rng.IntN(len(features))
+	second := (first + 1 + g.rng.IntN(len(features)-1)) % len(features)
+	description := fmt.Sprintf("%s %s, %s and %s.", article(noun), noun, features[first], features[second])
+
+	// Prices are log-normally distributed, most of them under 100, and end
+	// in .99
+	price := math.Exp(min(g.rng.NormFloat64()*0.8+3.4, 7.5))
+	cents := int(math.Ceil(price))*100 - 1
+
+	product := &data.Product{
+		Name:        name,
+		Description: description,
+		Category:    entry.category,
+		ImageURL:    fmt.Sprintf("https://images.example.com/products/%06d.jpg", n),
+		Price:       fmt.Sprintf("%d.%02d", cents/100, cents%100),
+	}
+
+	quality := 1 + 4*betaish(g.rng)
+	return product, quality
+}
+
+// reviewCount draws how many reviews a product gets, averaging mean. Most
+// products have a few reviews and some have many.
+func (g *generator) reviewCount(mean float64) int {
+	if mean <= 0 {
+		return 0
+	}
+	return int(g.rng.ExpFloat64() * mean)
+}
+
+// review generates a review of productID for a product of the given quality.
+func (g *generator) review(productID int64, quality float64) *data.Review {
+	rating := int64(quality + g.rng.NormFloat64() + 0.5)
+	rating = max(1, min(5, rating))
+
+	text := pick(g, opinions[rating-1])
+	if g.rng.IntN(2) == 0 {
+		text += " " + pick(g, details)
+	}
+
+	author := fmt.Sprintf("%s %c.", pick(g, firstNames), pick(g, lastNames)[0])
+	if g.rng.IntN(4) == 0 {
+		author = fmt.Sprintf("%s %s", pick(g, firstNames), pick(g, lastNames))
+	}
+
+	return &data.Review{
+		ProductID:    productID,
+		Author:       author,
+		Rating:       rating,
+		ReviewText:   text,
+		HelpfulCount: int32(g.rng.ExpFloat64() * 2),
+	}
+}
+
+// betaish returns a value in [0, 1) leaning towards the top, like the
+// ratings of real shops where most products are rated well.
+func betaish(rng *rand.Rand) float64 {
+	return 1 - rng.Float64()*rng.Float64()
+}
+
+// article returns the indefinite article to put before word.
+func article(word string) string {
+	if strings.ContainsRune("aeiou", rune(word[0])) {
+		return "An"
+	}
+	return "A"
+}
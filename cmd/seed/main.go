@@ -0,0 +1,180 @@
+// Filename: cmd/seed/main.go
+
+// Command seed fills a development database with generated products and
+// reviews. The data only depends on -seed and the volume flags, so everyone
+// running the same command against an empty database gets the same rows.
+//
+//	go run ./cmd/seed -db-dsn "$PRODUCT_REVIEW_DB_DSN" -products 5000 -reviews 20
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/mtechguy/test2/internal/data"
+)
+
+type seedConfig struct {
+	dsn       string
+	seed      uint64
+	products  int
+	reviews   float64 // average number of reviews per product
+	batchSize int
+	reset     bool
+}
+
+func main() {
+	var setting seedConfig
+
+	flag.StringVar(&setting.dsn, "db-dsn", os.Getenv("PRODUCT_REVIEW_DB_DSN"), "PostgreSQL DSN")
+	flag.Uint64Var(&setting.seed, "seed", 1, "Random seed; the same seed generates the same data")
+	flag.IntVar(&setting.products, "products", 2000, "Number of products to generate")
+	flag.Float64Var(&setting.reviews, "reviews", 15, "Average number of reviews per product")
+	flag.IntVar(&setting.batchSize, "batch-size", 500, "Rows inserted per transaction")
+	flag.BoolVar(&setting.reset, "reset", false, "Delete every product and review first, and restart their IDs at 1")
+
+	flag.Parse()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	if setting.products < 0 || setting.reviews < 0 || setting.batchSize < 1 {
+		logger.Error("-products and -reviews must not be negative and -batch-size must be positive")
+		os.Exit(2)
+	}
+
+	db, err := openDB(setting.dsn)
+	if err != nil {
+		logger.Error("Database connection failed", "error", err.Error())
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	err = seed(db, setting, logger)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+func seed(db *sql.DB, setting seedConfig, logger *slog.Logger) error {
+	if setting.reset {
+		err := reset(db)
+		if err != nil {
+			return fmt.Errorf("resetting the database: %w", err)
+		}
+		logger.Info("Deleted existing products and reviews")
+	}
+
+	ctx := context.Background()
+	start := time.Now()
+	g := newGenerator(setting.seed)
+	productModel := data.ProductModel{DB: db}
+	reviewModel := data.ReviewModel{DB: db}
+
+	// All products are generated first, then the reviews, so the random
+	// stream and thus the data don't depend on the batch size
+	products := make([]*data.Product, setting.products)
+	qualities := make([]float64, setting.products)
+	for i := range products {
+		products[i], qualities[i] = g.product(i + 1)
+	}
+
+	for from := 0; from < len(products); from += setting.batchSize {
+		batch := products[from:min(from+setting.batchSize, len(products))]
+		ops := make([]data.ProductOperation, len(batch))
+		for i, product := range batch {
+			ops[i] = data.ProductOperation{Op: data.BulkCreate, Product: product}
+		}
+
+		results, err := productModel.BulkProducts(ctx, ops, true)
+		err = bulkError(results, err)
+		if err != nil {
+			return fmt.Errorf("inserting products: %w", err)
+		}
+		logger.Info("Inserted products", "count", from+len(batch), "total", len(products))
+	}
+
+	reviewCount := 0
+	batch := make([]data.ReviewOperation, 0, setting.batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		results, err := reviewModel.BulkReviews(ctx, batch, true)
+		err = bulkError(results, err)
+		if err != nil {
+			return fmt.Errorf("inserting reviews: %w", err)
+		}
+		reviewCount += len(batch)
+		batch = batch[:0]
+		logger.Info("Inserted reviews", "count", reviewCount)
+		return nil
+	}
+
+	for i, product := range products {
+		for range g.reviewCount(setting.reviews) {
+			batch = append(batch, data.ReviewOperation{Op: data.BulkCreate, Review: g.review(product.ProductID, qualities[i])})
+			if len(batch) == setting.batchSize {
+				err := flush()
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	err := flush()
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Seeding finished", "seed", setting.seed, "products", len(products), "reviews", reviewCount,
+		"duration", time.Since(start).Round(time.Millisecond).String())
+	return nil
+}
+
+// bulkError returns the first failure of a bulk insert.
+func bulkError(results []error, err error) error {
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		if result != nil && !errors.Is(result, data.ErrRolledBack) {
+			return result
+		}
+	}
+	return nil
+}
+
+// reset empties the tables the seed fills. Translations go with their
+// products and reviews with theirs.
+func reset(db *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `TRUNCATE products, reviews RESTART IDENTITY CASCADE`)
+	return err
+}
+
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,130 @@
+// Filename: internal/config/config.go
+
+// Package config layers the settings of a command on top of its flags.
+// Every flag can also be set in a config file and through an environment
+// variable; a value given on the command line beats the environment, which
+// beats the file, which beats the flag's default.
+//
+// The file is a subset of TOML: tables and key = value pairs whose values
+// are strings, numbers or booleans. A key names the flag made of its table
+// and its own name joined with dashes, so
+//
+//	[db]
+//	max_open_conns = 25
+//
+// sets -db-max-open-conns, as does the PREFIX_DB_MAX_OPEN_CONNS variable.
+//
+// YAML files are not supported. Reading them would need a third-party
+// parser, and a flat list of flags gains nothing from YAML's extra syntax.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Options tell Load where to look for settings.
+type Options struct {
+	EnvPrefix string // prefix of the environment variables, e.g. PRODUCT_REVIEW_
+	FileFlag  string // name of the flag holding the path of the config file
+}
+
+// Load parses args into flags, then fills in every flag that wasn't given
+// on the command line from the environment or the config file.
+func Load(flags *flag.FlagSet, args []string, opts Options) error {
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	explicit := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	// The path of the file can itself come from the environment
+	if opts.FileFlag != "" && !explicit[opts.FileFlag] {
+		value, ok := os.LookupEnv(EnvName(opts.EnvPrefix, opts.FileFlag))
+		if ok {
+			err := flags.Set(opts.FileFlag, value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if opts.FileFlag != "" {
+		path := flags.Lookup(opts.FileFlag).Value.String()
+		if path != "" {
+			err := loadFile(flags, path, opts.FileFlag, explicit)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var envErr error
+	flags.VisitAll(func(f *flag.Flag) {
+		name := EnvName(opts.EnvPrefix, f.Name)
+		value, ok := os.LookupEnv(name)
+		if !ok || explicit[f.Name] || f.Name == opts.FileFlag || envErr != nil {
+			return
+		}
+		err := f.Value.Set(value)
+		if err != nil {
+			envErr = fmt.Errorf("%s: invalid value %q: %w", name, value, err)
+		}
+	})
+	return envErr
+}
+
+// EnvName is the environment variable for a flag, e.g. PRODUCT_REVIEW_DB_DSN
+// for db-dsn.
+func EnvName(prefix string, flagName string) string {
+	return prefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+func loadFile(flags *flag.FlagSet, path string, fileFlag string, explicit map[string]bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	settings, err := parseTOML(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	for _, s := range settings {
+		target := flags.Lookup(s.name)
+		if target == nil || s.name == fileFlag {
+			return fmt.Errorf("%s:%d: unknown setting %q", path, s.line, s.key)
+		}
+		if explicit[s.name] {
+			continue
+		}
+		err := target.Value.Set(s.value)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s: invalid value %q: %w", path, s.line, s.key, s.value, err)
+		}
+	}
+	return nil
+}
+
+// ReadSecret reads a secret kept in a file, such as a Docker or Kubernetes
+// secret, without the trailing newline most editors add.
+func ReadSecret(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimRight(string(b), "\r\n")
+	if secret == "" {
+		return "", errors.New(path + " is empty")
+	}
+	return secret, nil
+}
@@ -0,0 +1,30 @@
+// Filename: internal/config/redact.go
+package config
+
+import (
+	"net/url"
+	"regexp"
+)
+
+// redacted replaces secrets in logged values.
+const redacted = "xxxxx"
+
+var passwordRX = regexp.MustCompile(`(?i)(\bpassword\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// RedactDSN hides the password in a PostgreSQL connection string, given
+// either as a URL or as key=value pairs, so it can be logged.
+func RedactDSN(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err == nil && u.Scheme != "" && u.Host != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		query := u.Query()
+		if query.Has("password") {
+			query.Set("password", redacted)
+			u.RawQuery = query.Encode()
+		}
+		return u.String()
+	}
+	return passwordRX.ReplaceAllString(dsn, "${1}"+redacted)
+}
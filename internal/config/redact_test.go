@@ -0,0 +1,78 @@
+// Filename: internal/config/redact_test.go
+package config
+
+import "testing"
+
+func TestRedactDSN(t *testing.T) {
+	tests := []struct {
+		name string
+		dsn  string
+		want string
+	}{
+		// URLs
+		{
+			name: "url with password",
+			dsn:  "postgres://reviews:s3cret@db:5432/reviews?sslmode=disable",
+			want: "postgres://reviews:xxxxx@db:5432/reviews?sslmode=disable",
+		},
+		{
+			name: "url without password",
+			dsn:  "postgres://reviews@db/reviews",
+			want: "postgres://reviews@db/reviews",
+		},
+		{
+			name: "url with escaped password",
+			dsn:  "postgres://reviews:p%40ss%2Fword@db/reviews",
+			want: "postgres://reviews:xxxxx@db/reviews",
+		},
+		{
+			name: "url with password parameter",
+			dsn:  "postgresql://db/reviews?password=s3cret&user=reviews",
+			want: "postgresql://db/reviews?password=xxxxx&user=reviews",
+		},
+		{
+			name: "url without secrets",
+			dsn:  "postgres://db/reviews?sslmode=require",
+			want: "postgres://db/reviews?sslmode=require",
+		},
+
+		// key=value pairs
+		{
+			name: "key value",
+			dsn:  "host=db user=reviews password=s3cret dbname=reviews",
+			want: "host=db user=reviews password=xxxxx dbname=reviews",
+		},
+		{
+			name: "key value with spaces around equals",
+			dsn:  "host=db password = s3cret dbname=reviews",
+			want: "host=db password = xxxxx dbname=reviews",
+		},
+		{
+			name: "key value with quoted password",
+			dsn:  `host=db password='it\'s a secret' dbname=reviews`,
+			want: "host=db password=xxxxx dbname=reviews",
+		},
+		{
+			name: "key value in upper case",
+			dsn:  "host=db PASSWORD=s3cret",
+			want: "host=db PASSWORD=xxxxx",
+		},
+		{
+			name: "key value without password",
+			dsn:  "host=db user=reviews dbname=reviews",
+			want: "host=db user=reviews dbname=reviews",
+		},
+		{
+			name: "empty",
+			dsn:  "",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactDSN(tt.dsn); got != tt.want {
+				t.Errorf("RedactDSN(%q) = %q, want %q", tt.dsn, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+// Filename: internal/config/toml.go
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// setting is one key = value line of a config file.
+type setting struct {
+	key   string // as written, with its table, e.g. db.max_open_conns
+	name  string // the flag it sets, e.g. db-max-open-conns
+	value string
+	line  int
+}
+
+var (
+	keyRX   = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+	tableRX = regexp.MustCompile(`^\[\s*([A-Za-z0-9_.-]+)\s*\]$`)
+)
+
+// parseTOML reads the subset of TOML described in the package comment.
+// Arrays, inline tables and multi-line strings are rejected rather than
+// misread.
+func parseTOML(r io.Reader) ([]setting, error) {
+	var settings []setting
+	var table string
+	seen := map[string]int{}
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if match := tableRX.FindStringSubmatch(line); match != nil {
+			table = match[1]
+			continue
+		}
+
+		key, raw, found := strings.Cut(line, "=")
+		key, raw = strings.TrimSpace(key), strings.TrimSpace(raw)
+		if !found || !keyRX.MatchString(key) {
+			return nil, fmt.Errorf("line %d: expected key = value or [table]", n)
+		}
+
+		value, err := parseValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", n, key, err)
+		}
+
+		if table != "" {
+			key = table + "." + key
+		}
+		if first, ok := seen[key]; ok {
+			return nil, fmt.Errorf("line %d: %s is already set on line %d", n, key, first)
+		}
+		seen[key] = n
+
+		settings = append(settings, setting{
+			key:   key,
+			name:  strings.NewReplacer(".", "-", "_", "-").Replace(key),
+			value: value,
+			line:  n,
+		})
+	}
+	return settings, scanner.Err()
+}
+
+// parseValue returns the text of a string, number or boolean value.
+func parseValue(raw string) (string, error) {
+	switch {
+	case raw == "":
+		return "", errors.New("missing value")
+	case strings.HasPrefix(raw, `"""`), strings.HasPrefix(raw, "'''"):
+		return "", errors.New("multi-line strings are not supported")
+	case strings.HasPrefix(raw, `"`):
+		value, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", errors.New("invalid string")
+		}
+		return value, nil
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") || strings.Contains(raw[1:len(raw)-1], "'") {
+			return "", errors.New("invalid string")
+		}
+		return raw[1 : len(raw)-1], nil
+	case strings.HasPrefix(raw, "["), strings.HasPrefix(raw, "{"):
+		return "", errors.New("arrays and inline tables are not supported")
+	}
+
+	if raw == "true" || raw == "false" {
+		return raw, nil
+	}
+
+	// Numbers may use underscores as separators, e.g. 1_000
+	number := strings.ReplaceAll(raw, "_", "")
+	if _, err := strconv.ParseFloat(number, 64); err != nil {
+		return "", fmt.Errorf("invalid value %s, strings must be quoted", raw)
+	}
+	return number, nil
+}
+
+// stripComment removes a # comment, leaving any # inside a string alone.
+func stripComment(line string) string {
+	var quote rune
+	escaped := false
+	for i, c := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && c == '\\':
+			escaped = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,118 @@
+// Filename: internal/config/toml_test.go
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []setting
+		wantErr string // part of the error, empty when the input parses
+	}{
+		{
+			name:  "number",
+			input: "port = 4000",
+			want:  []setting{{key: "port", name: "port", value: "4000", line: 1}},
+		},
+		{
+			name:  "number with separators",
+			input: "limit = 1_000",
+			want:  []setting{{key: "limit", name: "limit", value: "1000", line: 1}},
+		},
+		{
+			name:  "float and boolean",
+			input: "rps = 2.5\nenabled = true",
+			want: []setting{
+				{key: "rps", name: "rps", value: "2.5", line: 1},
+				{key: "enabled", name: "enabled", value: "true", line: 2},
+			},
+		},
+		{
+			name:  "basic string with escapes",
+			input: `env = "dev\t\"local\""`,
+			want:  []setting{{key: "env", name: "env", value: "dev\t\"local\"", line: 1}},
+		},
+		{
+			name:  "literal string keeps backslashes",
+			input: `path = 'C:\config\api.toml'`,
+			want:  []setting{{key: "path", name: "path", value: `C:\config\api.toml`, line: 1}},
+		},
+		{
+			name:  "empty string",
+			input: `env = ""`,
+			want:  []setting{{key: "env", name: "env", value: "", line: 1}},
+		},
+		{
+			name:  "comments and blank lines",
+			input: "# the port\n\nport = 4000 # trailing\n   # indented",
+			want:  []setting{{key: "port", name: "port", value: "4000", line: 3}},
+		},
+		{
+			name:  "hash inside strings",
+			input: `dsn = "postgres://u:p#1@db/app" # comment` + "\n" + `tag = 'a#b'`,
+			want: []setting{
+				{key: "dsn", name: "dsn", value: "postgres://u:p#1@db/app", line: 1},
+				{key: "tag", name: "tag", value: "a#b", line: 2},
+			},
+		},
+		{
+			name:  "escaped quote before hash",
+			input: `env = "a\"#b"`,
+			want:  []setting{{key: "env", name: "env", value: `a"#b`, line: 1}},
+		},
+		{
+			name:  "tables",
+			input: "port = 4000\n[db]\nmax_open_conns = 25\n[ limiter.burst ]\nsize = 4",
+			want: []setting{
+				{key: "port", name: "port", value: "4000", line: 1},
+				{key: "db.max_open_conns", name: "db-max-open-conns", value: "25", line: 3},
+				{key: "limiter.burst.size", name: "limiter-burst-size", value: "4", line: 5},
+			},
+		},
+		{
+			name:  "dotted key",
+			input: "db.max_idle_time = \"15m\"",
+			want:  []setting{{key: "db.max_idle_time", name: "db-max-idle-time", value: "15m", line: 1}},
+		},
+		{
+			name:  "empty input",
+			input: "",
+		},
+		{name: "unquoted string", input: "env = development", wantErr: "line 1: env: invalid value development, strings must be quoted"},
+		{name: "missing value", input: "port =", wantErr: "line 1: port: missing value"},
+		{name: "missing equals", input: "port 4000", wantErr: "line 1: expected key = value or [table]"},
+		{name: "bad key", input: "my port = 4000", wantErr: "line 1: expected key = value or [table]"},
+		{name: "unterminated string", input: `env = "dev`, wantErr: "line 1: env: invalid string"},
+		{name: "unterminated literal string", input: `env = 'dev`, wantErr: "line 1: env: invalid string"},
+		{name: "text after string", input: `env = "dev" "prod"`, wantErr: "line 1: env: invalid string"},
+		{name: "multi-line string", input: `env = """dev"""`, wantErr: "multi-line strings are not supported"},
+		{name: "array", input: "hosts = [1, 2]", wantErr: "arrays and inline tables are not supported"},
+		{name: "inline table", input: "db = { dsn = 'x' }", wantErr: "arrays and inline tables are not supported"},
+		{name: "unclosed table", input: "[db", wantErr: "line 1: expected key = value or [table]"},
+		{name: "duplicate key", input: "port = 1\nport = 2", wantErr: "line 2: port is already set on line 1"},
+		{name: "duplicate key across tables", input: "db.dsn = 'a'\n[db]\ndsn = 'b'", wantErr: "line 3: db.dsn is already set on line 1"},
+		{name: "error on a later line", input: "port = 4000\n\nenv = dev", wantErr: "line 3:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTOML(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
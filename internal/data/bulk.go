@@ -0,0 +1,139 @@
+// Filename: internal/data/bulk.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mtechguy/test2/internal/tracing"
+)
+
+// querier is implemented by both *sql.DB and *sql.Tx, so the same statement
+// can run on its own or as part of a transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// ErrRolledBack is reported for operations that succeeded but were undone
+// because a later operation in the same transaction failed.
+var ErrRolledBack = errors.New("rolled back because another operation failed")
+
+// Bulk operation kinds.
+const (
+	BulkCreate = "create"
+	BulkUpdate = "update"
+	BulkDelete = "delete"
+)
+
+// ProductOperation is one step of a bulk request. Product is set for
+// creates and updates, ID for deletes.
+type ProductOperation struct {
+	Op      string
+	ID      int64
+	Product *Product
+}
+
+// ReviewOperation is one step of a bulk request. Review is set for creates
+// and updates, ID for deletes.
+type ReviewOperation struct {
+	Op     string
+	ID     int64
+	Review *Review
+}
+
+// BulkTimeout is how long a batch of n operations may run. It grows with
+// the number of operations so large imports are not cut short, while a
+// single statement still gets the usual 3 seconds.
+func BulkTimeout(n int) time.Duration {
+	return 3*time.Second + time.Duration(n)*50*time.Millisecond
+}
+
+// runBulk executes n operations through apply. When atomic is true they run
+// in a single transaction and the first failure rolls everything back,
+// otherwise each one stands on its own. The returned slice holds the outcome
+// of each operation (nil on success); the error is only set when the
+// transaction itself could not be started or committed.
+func runBulk(ctx context.Context, db *sql.DB, n int, atomic bool, apply func(ctx context.Context, q querier, i int) error) ([]error, error) {
+	ctx, cancel := context.WithTimeout(ctx, BulkTimeout(n))
+	defer cancel()
+
+	results := make([]error, n)
+
+	if !atomic {
+		for i := 0; i < n; i++ {
+			results[i] = apply(ctx, db, i)
+		}
+		return results, nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for i := 0; i < n; i++ {
+		err = apply(ctx, tx, i)
+		if err != nil {
+			for j := 0; j < n; j++ {
+				results[j] = ErrRolledBack
+			}
+			results[i] = err
+			return results, nil
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// BulkProducts applies the operations either in one transaction (atomic) or
+// one by one.
+func (p ProductModel) BulkProducts(ctx context.Context, ops []ProductOperation, atomic bool) ([]error, error) {
+	ctx, span := tracing.Start(ctx, "ProductModel.BulkProducts")
+	defer span.End()
+
+	return runBulk(ctx, p.DB, len(ops), atomic, func(ctx context.Context, q querier, i int) error {
+		op := ops[i]
+		switch op.Op {
+		case BulkCreate:
+			return insertProduct(ctx, q, op.Product)
+		case BulkUpdate:
+			return updateProduct(ctx, q, op.Product)
+		case BulkDelete:
+			return deleteProduct(ctx, q, op.ID)
+		default:
+			return fmt.Errorf("unknown operation %q", op.Op)
+		}
+	})
+}
+
+// BulkReviews applies the operations either in one transaction (atomic) or
+// one by one.
+func (c ReviewModel) BulkReviews(ctx context.Context, ops []ReviewOperation, atomic bool) ([]error, error) {
+	ctx, span := tracing.Start(ctx, "ReviewModel.BulkReviews")
+	defer span.End()
+
+	return runBulk(ctx, c.DB, len(ops), atomic, func(ctx context.Context, q querier, i int) error {
+		op := ops[i]
+		switch op.Op {
+		case BulkCreate:
+			return insertReview(ctx, q, op.Review)
+		case BulkUpdate:
+			return updateReview(ctx, q, op.Review)
+		case BulkDelete:
+			return deleteReview(ctx, q, op.ID)
+		default:
+			return fmt.Errorf("unknown operation %q", op.Op)
+		}
+	})
+}
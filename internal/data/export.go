@@ -0,0 +1,147 @@
+// Filename: internal/data/export.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/mtechguy/test2/internal/tracing"
+)
+
+// exportBatchSize is how many rows are fetched from the cursor at a time.
+const exportBatchSize = 500
+
+// streamCursor runs query behind a server-side cursor and hands the rows to
+// scan in batches, so an export of any size only holds one batch in memory.
+// The cursor lives in a read-only transaction that is closed on return.
+func streamCursor(ctx context.Context, db *sql.DB, query string, args []any, scan func(rows *sql.Rows) error) error {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DECLARE export_cursor NO SCROLL CURSOR FOR "+query, args...)
+	if err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM export_cursor", exportBatchSize)
+	for {
+		rows, err := tx.QueryContext(ctx, fetch)
+		if err != nil {
+			return err
+		}
+
+		n := 0
+		for rows.Next() {
+			n++
+			err = scan(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		if n < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+// ExportProducts streams every product matching the same filters as
+// GetAllProducts, ignoring pagination, translated and searched the same
+// way. fn is called once per batch; the slice is reused between calls.
+func (p ProductModel) ExportProducts(ctx context.Context, name string, category string, filters Filters, fn func([]*Product) error) error {
+	ctx, span := tracing.Start(ctx, "ProductModel.ExportProducts")
+	defer span.End()
+
+	var product Product
+	columns, targets := productColumns(&product, nil)
+
+	query := fmt.Sprintf(`
+		SELECT %[1]s
+		FROM products p %[2]s
+		CROSS JOIN LATERAL (SELECT %[3]s AS config) ts
+		WHERE (to_tsvector(ts.config, COALESCE(t.t_name, p.name)) @@ plainto_tsquery(ts.config, $1) OR $1 = '')
+		AND (to_tsvector(ts.config, COALESCE(t.t_category, p.category)) @@ plainto_tsquery(ts.config, $2) OR $2 = '')
+		ORDER BY %[4]s %[5]s, product_id ASC`, columns, translationJoin(3), textSearchConfig, filters.sortColumn(), filters.sortDirection())
+
+	batch := make([]*Product, 0, exportBatchSize)
+	err := streamCursor(ctx, p.DB, query, []any{name, category, pq.Array(filters.Locales)}, func(rows *sql.Rows) error {
+		product = Product{}
+		err := rows.Scan(targets...)
+		if err != nil {
+			return err
+		}
+
+		row := product
+		batch = append(batch, &row)
+		if len(batch) == exportBatchSize {
+			err = fn(batch)
+			batch = batch[:0]
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
+
+// ExportReviews streams every review matching the same filters as
+// GetAllReviews, ignoring pagination. fn is called once per batch; the
+// slice is reused between calls.
+func (c ReviewModel) ExportReviews(ctx context.Context, author string, filters Filters, fn func([]*Review) error) error {
+	ctx, span := tracing.Start(ctx, "ReviewModel.ExportReviews")
+	defer span.End()
+
+	query := fmt.Sprintf(`
+		SELECT review_id, product_id, author, rating, review_text, helpful_count, created_at, version
+		FROM reviews
+		WHERE (to_tsvector('simple', author) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		ORDER BY %s %s, review_id ASC`, filters.sortColumn(), filters.sortDirection())
+
+	batch := make([]*Review, 0, exportBatchSize)
+	err := streamCursor(ctx, c.DB, query, []any{author}, func(rows *sql.Rows) error {
+		var review Review
+		err := rows.Scan(
+			&review.ReviewID,
+			&review.ProductID,
+			&review.Author,
+			&review.Rating,
+			&review.ReviewText,
+			&review.HelpfulCount,
+			&review.CreatedAt,
+			&review.Version,
+		)
+		if err != nil {
+			return err
+		}
+
+		batch = append(batch, &review)
+		if len(batch) == exportBatchSize {
+			err = fn(batch)
+			batch = batch[:0]
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
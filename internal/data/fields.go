@@ -0,0 +1,108 @@
+// Filename: internal/data/fields.go
+package data
+
+import (
+	"strings"
+
+	"github.com/mtechguy/test2/internal/validator"
+)
+
+// ProductFieldSafeList and ReviewFieldSafeList are the fields a client may
+// ask for with ?fields=.
+var (
+	ProductFieldSafeList = []string{"product_id", "name", "description", "category", "image_url", "price",
+		"average_rating", "version"}
+	ReviewFieldSafeList = []string{"review_id", "product_id", "author", "rating", "review_text",
+		"helpful_count", "version"}
+)
+
+// ValidateFields checks that every requested field is in the safe list.
+func ValidateFields(v *validator.Validator, fields []string, safeList []string) {
+	for _, field := range fields {
+		v.Check(validator.PermittedValue(field, safeList...), "fields",
+			"unknown_field", "field", field, "values", strings.Join(safeList, ", "))
+	}
+}
+
+// productColumns returns the columns to select for the requested fields,
+// along with where to scan each of them. No fields means every column.
+// The query must alias products as p and join the best translation as t,
+// see translationJoin; translated text replaces the product's own, and the
+// locale of the translation used is always selected into product.Locale.
+func productColumns(product *Product, fields []string) (string, []any) {
+	if len(fields) == 0 {
+		fields = append(ProductFieldSafeList[:len(ProductFieldSafeList):len(ProductFieldSafeList)], "created_at")
+	}
+
+	columns := make([]string, len(fields), len(fields)+1)
+	targets := make([]any, len(fields), len(fields)+1)
+	for i, field := range fields {
+		switch field {
+		case "product_id":
+			targets[i] = &product.ProductID
+		case "name":
+			targets[i] = &product.Name
+		case "description":
+			targets[i] = &product.Description
+		case "category":
+			targets[i] = &product.Category
+		case "image_url":
+			targets[i] = &product.ImageURL
+		case "price":
+			targets[i] = &product.Price
+		case "average_rating":
+			targets[i] = &product.AverageRating
+		case "created_at":
+			targets[i] = &product.CreatedAt
+		case "version":
+			targets[i] = &product.Version
+		default:
+			// the handler validates fields against the safe list, so
+			// this is never user input reaching the query
+			panic("unsafe field parameter: " + field)
+		}
+
+		switch field {
+		case "name", "description", "category":
+			columns[i] = "COALESCE(t.t_" + field + ", p." + field + ") AS " + field
+		default:
+			columns[i] = "p." + field
+		}
+	}
+
+	columns = append(columns, "COALESCE(t.t_locale, '')")
+	targets = append(targets, &product.Locale)
+	return strings.Join(columns, ", "), targets
+}
+
+// reviewColumns is productColumns for reviews.
+func reviewColumns(review *Review, fields []string) (string, []any) {
+	if len(fields) == 0 {
+		fields = append(ReviewFieldSafeList[:len(ReviewFieldSafeList):len(ReviewFieldSafeList)], "created_at")
+	}
+
+	targets := make([]any, len(fields))
+	for i, field := range fields {
+		switch field {
+		case "review_id":
+			targets[i] = &review.ReviewID
+		case "product_id":
+			targets[i] = &review.ProductID
+		case "author":
+			targets[i] = &review.Author
+		case "rating":
+			targets[i] = &review.Rating
+		case "review_text":
+			targets[i] = &review.ReviewText
+		case "helpful_count":
+			targets[i] = &review.HelpfulCount
+		case "created_at":
+			targets[i] = &review.CreatedAt
+		case "version":
+			targets[i] = &review.Version
+		default:
+			panic("unsafe field parameter: " + field)
+		}
+	}
+	return strings.Join(fields, ", "), targets
+}
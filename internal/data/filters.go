@@ -13,7 +13,9 @@ type Filters struct {
 	PageSize     int // How many records per page.
 	Sort         string
 	SortSafeList []string // allowed sort fields
-
+	Fields       []string // columns to return, all of them when empty
+	Locales      []string // translations to read, best first
+	After        int64    // only records with a greater ID, for keyset paging
 }
 
 type Metadata struct {
@@ -26,12 +28,12 @@ type Metadata struct {
 
 // ValidateFilters checks the validity of pagination parameters.
 func ValidateFilters(v *validator.Validator, f Filters) {
-	v.Check(f.Page > 0, "page", "must be greater than zero")
-	v.Check(f.Page <= 500, "page", "must be a maximum of 500")
-	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
-	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
+	v.Check(f.Page > 0, "page", "positive")
+	v.Check(f.Page <= 500, "page", "max_value", "max", 500)
+	v.Check(f.PageSize > 0, "page_size", "positive")
+	v.Check(f.PageSize <= 100, "page_size", "max_value", "max", 100)
 	v.Check(validator.PermittedValue(f.Sort, f.SortSafeList...), "sort",
-		"invalid sort value")
+		"one_of", "values", strings.Join(f.SortSafeList, ", "))
 
 }
 
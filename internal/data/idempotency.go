@@ -0,0 +1,201 @@
+// Filename: internal/data/idempotency.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/mtechguy/test2/internal/tracing"
+)
+
+// Idempotency record states.
+const (
+	IdempotencyInProgress = "in_progress"
+	IdempotencyCompleted  = "completed"
+)
+
+// IdempotencyRecord is the stored outcome of a request sent with an
+// Idempotency-Key header.
+type IdempotencyRecord struct {
+	Caller          string
+	Key             string
+	RequestHash     string
+	Status          string
+	ResponseStatus  int
+	ResponseHeaders http.Header
+	ResponseBody    []byte
+	CreatedAt       time.Time
+	ExpiresAt       time.Time
+}
+
+type IdempotencyModel struct {
+	DB *sql.DB
+}
+
+// ReserveKey claims the key for a new request. When the key is free (or its
+// previous record has expired) a fresh in-progress record is stored and
+// created is true. Otherwise the existing record is returned so the caller
+// can replay or reject the request.
+func (m IdempotencyModel) ReserveKey(ctx context.Context, caller string, key string, requestHash string, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	ctx, span := tracing.Start(ctx, "IdempotencyModel.ReserveKey")
+	defer span.End()
+
+	query := `
+		INSERT INTO idempotency_keys (caller, idempotency_key, request_hash, expires_at)
+		VALUES ($1, $2, $3, NOW() + make_interval(secs => $4))
+		ON CONFLICT (caller, idempotency_key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, status = 'in_progress', response_status = NULL,
+			response_headers = NULL, response_body = NULL, created_at = NOW(), expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= NOW()
+		RETURNING created_at, expires_at
+	`
+
+	record := &IdempotencyRecord{
+		Caller:      caller,
+		Key:         key,
+		RequestHash: requestHash,
+		Status:      IdempotencyInProgress,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// The record that kept the key can expire, or be released, before it
+	// is read. The key is free again then, so it is reserved once more.
+	for attempt := 0; ; attempt++ {
+		err := m.DB.QueryRowContext(ctx, query, caller, key, requestHash, ttl.Seconds()).Scan(
+			&record.CreatedAt,
+			&record.ExpiresAt,
+		)
+		if err == nil {
+			return record, true, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, false, err
+		}
+
+		existing, err := m.GetKey(ctx, caller, key)
+		if errors.Is(err, ErrRecordNotFound) && attempt == 0 {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return existing, false, nil
+	}
+}
+
+func (m IdempotencyModel) GetKey(ctx context.Context, caller string, key string) (*IdempotencyRecord, error) {
+	ctx, span := tracing.Start(ctx, "IdempotencyModel.GetKey")
+	defer span.End()
+
+	query := `
+		SELECT request_hash, status, COALESCE(response_status, 0), response_headers, response_body, created_at, expires_at
+		FROM idempotency_keys
+		WHERE caller = $1 AND idempotency_key = $2 AND expires_at > NOW()
+	`
+
+	record := IdempotencyRecord{Caller: caller, Key: key}
+	var headers []byte
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, caller, key).Scan(
+		&record.RequestHash,
+		&record.Status,
+		&record.ResponseStatus,
+		&headers,
+		&record.ResponseBody,
+		&record.CreatedAt,
+		&record.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	if headers != nil {
+		err = json.Unmarshal(headers, &record.ResponseHeaders)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &record, nil
+}
+
+// CompleteKey stores the response that replays of the key will receive.
+func (m IdempotencyModel) CompleteKey(ctx context.Context, record *IdempotencyRecord) error {
+	ctx, span := tracing.Start(ctx, "IdempotencyModel.CompleteKey")
+	defer span.End()
+
+	query := `
+		UPDATE idempotency_keys
+		SET status = 'completed', response_status = $1, response_headers = $2, response_body = $3
+		WHERE caller = $4 AND idempotency_key = $5
+	`
+
+	headers, err := json.Marshal(record.ResponseHeaders)
+	if err != nil {
+		return err
+	}
+
+	args := []any{record.ResponseStatus, string(headers), record.ResponseBody, record.Caller, record.Key}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	record.Status = IdempotencyCompleted
+	return nil
+}
+
+// ReleaseKey forgets a key, so the next request with it runs again. It is
+// used when the request failed in a way that is worth retrying.
+func (m IdempotencyModel) ReleaseKey(ctx context.Context, caller string, key string) error {
+	ctx, span := tracing.Start(ctx, "IdempotencyModel.ReleaseKey")
+	defer span.End()
+
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE caller = $1 AND idempotency_key = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, caller, key)
+	return err
+}
+
+// DeleteExpiredKeys removes the records whose window has passed.
+func (m IdempotencyModel) DeleteExpiredKeys(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "IdempotencyModel.DeleteExpiredKeys")
+	defer span.End()
+
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE expires_at <= NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
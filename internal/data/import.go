@@ -0,0 +1,185 @@
+// Filename: internal/data/import.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/mtechguy/test2/internal/tracing"
+	"github.com/mtechguy/test2/internal/validator"
+)
+
+// Import states.
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// ImportRowError lists what was wrong with one row of an import.
+type ImportRowError struct {
+	Row    int                          `json:"row"`
+	Errors map[string][]validator.Error `json:"errors"`
+}
+
+// Import tracks the progress of a catalog upload.
+type Import struct {
+	ImportID      int64            `json:"import_id"`
+	Format        string           `json:"format"`
+	DryRun        bool             `json:"dry_run"`
+	Status        string           `json:"status"`
+	TotalRows     int              `json:"total_rows"`
+	ProcessedRows int              `json:"processed_rows"`
+	CreatedCount  int              `json:"created_count"`
+	UpdatedCount  int              `json:"updated_count"`
+	FailedCount   int              `json:"failed_count"`
+	Errors        []ImportRowError `json:"errors"`
+	Message       *string          `json:"message,omitempty"`
+	CreatedAt     time.Time        `json:"created_at"`
+	FinishedAt    *time.Time       `json:"finished_at,omitempty"`
+}
+
+type ImportModel struct {
+	DB *sql.DB
+}
+
+func (m ImportModel) InsertImport(ctx context.Context, imp *Import) error {
+	ctx, span := tracing.Start(ctx, "ImportModel.InsertImport")
+	defer span.End()
+
+	query := `
+		INSERT INTO imports (format, dry_run, status)
+		VALUES ($1, $2, $3)
+		RETURNING import_id, created_at
+	`
+
+	if imp.Status == "" {
+		imp.Status = ImportPending
+	}
+	if imp.Errors == nil {
+		imp.Errors = []ImportRowError{}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, imp.Format, imp.DryRun, imp.Status).Scan(
+		&imp.ImportID,
+		&imp.CreatedAt,
+	)
+}
+
+func (m ImportModel) GetImport(ctx context.Context, id int64) (*Import, error) {
+	ctx, span := tracing.Start(ctx, "ImportModel.GetImport")
+	defer span.End()
+
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT import_id, format, dry_run, status, total_rows, processed_rows, created_count,
+			updated_count, failed_count, errors, message, created_at, finished_at
+		FROM imports
+		WHERE import_id = $1
+	`
+
+	var imp Import
+	var rowErrors []byte
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&imp.ImportID,
+		&imp.Format,
+		&imp.DryRun,
+		&imp.Status,
+		&imp.TotalRows,
+		&imp.ProcessedRows,
+		&imp.CreatedCount,
+		&imp.UpdatedCount,
+		&imp.FailedCount,
+		&rowErrors,
+		&imp.Message,
+		&imp.CreatedAt,
+		&imp.FinishedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(rowErrors, &imp.Errors)
+	if err != nil {
+		return nil, err
+	}
+
+	return &imp, nil
+}
+
+// UpdateImport saves the progress counters, row errors and status. When
+// the status is final the finish time is recorded too.
+func (m ImportModel) UpdateImport(ctx context.Context, imp *Import) error {
+	ctx, span := tracing.Start(ctx, "ImportModel.UpdateImport")
+	defer span.End()
+
+	query := `
+		UPDATE imports
+		SET status = $1, total_rows = $2, processed_rows = $3, created_count = $4, updated_count = $5,
+			failed_count = $6, errors = $7, message = $8,
+			finished_at = CASE WHEN $1 IN ('completed', 'failed') THEN NOW() ELSE NULL END
+		WHERE import_id = $9
+	`
+
+	rowErrors, err := json.Marshal(imp.Errors)
+	if err != nil {
+		return err
+	}
+
+	args := []any{imp.Status, imp.TotalRows, imp.ProcessedRows, imp.CreatedCount, imp.UpdatedCount,
+		imp.FailedCount, string(rowErrors), imp.Message, imp.ImportID}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// UpsertProductByExternalRef creates the product, or updates the product
+// that already has the same external reference. It reports whether a new
+// product was created.
+func (p ProductModel) UpsertProductByExternalRef(ctx context.Context, externalRef string, product *Product) (bool, error) {
+	ctx, span := tracing.Start(ctx, "ProductModel.UpsertProductByExternalRef")
+	defer span.End()
+
+	query := `
+		INSERT INTO products (external_ref, name, description, category, image_url, price)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (external_ref) DO UPDATE
+		SET name = EXCLUDED.name, description = EXCLUDED.description, category = EXCLUDED.category,
+			image_url = EXCLUDED.image_url, price = EXCLUDED.price, version = products.version + 1
+		RETURNING product_id, average_rating, created_at, version, (xmax = 0) AS inserted
+	`
+	args := []any{externalRef, product.Name, product.Description, product.Category, product.ImageURL, product.Price}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var inserted bool
+	err := p.DB.QueryRowContext(ctx, query, args...).Scan(
+		&product.ProductID,
+		&product.AverageRating,
+		&product.CreatedAt,
+		&product.Version,
+		&inserted,
+	)
+	return inserted, err
+}
@@ -0,0 +1,212 @@
+// Filename: internal/data/job.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mtechguy/test2/internal/tracing"
+)
+
+// ErrDuplicateJob is returned when a job with the same unique key is
+// already waiting. A job with the same key that is running doesn't count:
+// it may have read what the new job is about before it changed.
+var ErrDuplicateJob = errors.New("duplicate job")
+
+// Job states.
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+type Job struct {
+	JobID       int64           `json:"job_id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	UniqueKey   *string         `json:"unique_key,omitempty"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   *string         `json:"last_error,omitempty"`
+	CompletedAt *time.Time      `json:"completed_at,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+type JobModel struct {
+	DB *sql.DB
+}
+
+// EnqueueJob adds a job to the queue. A zero RunAt runs the job as soon as a
+// worker is free, and a zero MaxAttempts defaults to 5.
+func (j JobModel) EnqueueJob(ctx context.Context, job *Job) error {
+	ctx, span := tracing.Start(ctx, "JobModel.EnqueueJob")
+	defer span.End()
+
+	query := `
+		INSERT INTO jobs (kind, payload, unique_key, max_attempts, run_at)
+		VALUES ($1, $2, $3, $4, COALESCE($5, NOW()))
+		ON CONFLICT (unique_key) WHERE unique_key IS NOT NULL AND status = 'pending'
+		DO NOTHING
+		RETURNING job_id, status, run_at, created_at
+	`
+
+	if job.Payload == nil {
+		job.Payload = json.RawMessage("{}")
+	}
+	if job.MaxAttempts == 0 {
+		job.MaxAttempts = 5
+	}
+	var runAt *time.Time
+	if !job.RunAt.IsZero() {
+		runAt = &job.RunAt
+	}
+
+	args := []any{job.Kind, string(job.Payload), job.UniqueKey, job.MaxAttempts, runAt}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := j.DB.QueryRowContext(ctx, query, args...).Scan(
+		&job.JobID,
+		&job.Status,
+		&job.RunAt,
+		&job.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrDuplicateJob
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ClaimJob locks the oldest due job for one of the given kinds and marks it
+// running. It returns ErrRecordNotFound when there is nothing to do.
+func (j JobModel) ClaimJob(ctx context.Context, kinds []string) (*Job, error) {
+	ctx, span := tracing.Start(ctx, "JobModel.ClaimJob")
+	defer span.End()
+
+	query := `
+		UPDATE jobs
+		SET status = 'running', locked_at = NOW(), attempts = attempts + 1
+		WHERE job_id = (
+			SELECT job_id
+			FROM jobs
+			WHERE status = 'pending' AND run_at <= NOW() AND kind = ANY($1)
+			ORDER BY run_at, job_id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING job_id, kind, payload, unique_key, status, attempts, max_attempts, run_at, created_at
+	`
+
+	var job Job
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := j.DB.QueryRowContext(ctx, query, pq.Array(kinds)).Scan(
+		&job.JobID,
+		&job.Kind,
+		&job.Payload,
+		&job.UniqueKey,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (j JobModel) CompleteJob(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "JobModel.CompleteJob")
+	defer span.End()
+
+	query := `
+		UPDATE jobs
+		SET status = 'completed', completed_at = NOW(), locked_at = NULL, last_error = NULL
+		WHERE job_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := j.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// jobSuperseded is true for a job when a newer one with the same unique key
+// is waiting or running. Retrying it would be redundant, and putting it
+// back to pending would clash with the waiting one.
+const jobSuperseded = `
+	EXISTS (
+		SELECT 1
+		FROM jobs newer
+		WHERE newer.unique_key = jobs.unique_key AND newer.job_id > jobs.job_id
+			AND newer.status IN ('pending', 'running')
+	)`
+
+// FailJob records a failed run. The job goes back to pending with the next
+// run time, or to failed once it has used up its attempts or a newer job
+// with the same unique key will do the work instead.
+func (j JobModel) FailJob(ctx context.Context, job *Job, reason string, nextRun time.Time) error {
+	ctx, span := tracing.Start(ctx, "JobModel.FailJob")
+	defer span.End()
+
+	query := `
+		UPDATE jobs
+		SET status = CASE WHEN attempts >= max_attempts OR` + jobSuperseded + ` THEN 'failed' ELSE 'pending' END,
+			run_at = $1, locked_at = NULL, last_error = $2
+		WHERE job_id = $3
+		RETURNING status
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return j.DB.QueryRowContext(ctx, query, nextRun, reason, job.JobID).Scan(&job.Status)
+}
+
+// RescueStaleJobs puts running jobs whose worker disappeared (the process
+// crashed or was killed) back in the queue. Jobs that have used up their
+// attempts fail instead, so a job that kills its worker isn't run forever,
+// and so do jobs superseded by a newer one with the same unique key.
+func (j JobModel) RescueStaleJobs(ctx context.Context, olderThan time.Duration) (int64, error) {
+	ctx, span := tracing.Start(ctx, "JobModel.RescueStaleJobs")
+	defer span.End()
+
+	query := `
+		UPDATE jobs
+		SET status = CASE WHEN attempts >= max_attempts OR` + jobSuperseded + ` THEN 'failed' ELSE 'pending' END,
+			locked_at = NULL,
+			last_error = CASE WHEN attempts >= max_attempts OR` + jobSuperseded + `
+				THEN 'the worker running the job disappeared' ELSE last_error END
+		WHERE status = 'running' AND locked_at < NOW() - make_interval(secs => $1)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := j.DB.ExecContext(ctx, query, olderThan.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,42 @@
+// Filename: internal/data/migration.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/mtechguy/test2/internal/tracing"
+)
+
+// SchemaVersion is the migration this code is written against, the number
+// of the newest file in migrations/. Bump it with every new migration.
+const SchemaVersion = 7
+
+// MigrationModel reads the state golang-migrate records in the
+// schema_migrations table.
+type MigrationModel struct {
+	DB *sql.DB
+}
+
+// Version returns the version of the last migration applied, and whether
+// it failed halfway (dirty). A database that was never migrated is at
+// version 0.
+func (m MigrationModel) Version(ctx context.Context) (int64, bool, error) {
+	ctx, span := tracing.Start(ctx, "MigrationModel.Version")
+	defer span.End()
+
+	query := `
+		SELECT version, dirty
+		FROM schema_migrations
+		LIMIT 1
+	`
+
+	var version int64
+	var dirty bool
+	err := m.DB.QueryRowContext(ctx, query).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
@@ -8,40 +8,45 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/lib/pq"
+	"github.com/mtechguy/test2/internal/tracing"
 	"github.com/mtechguy/test2/internal/validator"
 )
 
 type Product struct {
 	ProductID     int64     `json:"product_id"`
-	Name          string    `json:"name"`
-	Description   string    `json:"description"`
-	Category      string    `json:"category"`
-	ImageURL      string    `json:"image_url"`
-	Price         string    `json:"price"`
+	Name          string    `json:"name" validate:"required,maxlen=100"`
+	Description   string    `json:"description" validate:"required,maxlen=500"`
+	Category      string    `json:"category" validate:"required"`
+	ImageURL      string    `json:"image_url" validate:"required,maxlen=255"`
+	Price         string    `json:"price" validate:"maxlen=10"`
 	AverageRating float32   `json:"average_rating"`
 	CreatedAt     time.Time `json:"-"`
 	Version       int32     `json:"version"`
+	Locale        string    `json:"locale,omitempty"` // locale of the translation read, if any
 }
 
 type ProductModel struct {
 	DB *sql.DB
 }
 
-// Validation function for Product struct
+// Validation function for Product struct. The rules are the validate tags
+// on Product.
 func ValidateProduct(v *validator.Validator, product *Product) {
-	v.Check(product.Name != "", "name", "must be provided")
-	v.Check(len(product.Name) <= 100, "name", "must not be more than 100 characters long")
-	v.Check(product.Description != "", "description", "must be provided")
-	v.Check(len(product.Description) <= 500, "description", "must not be more than 500 characters long")
-	v.Check(product.Category != "", "category", "must be provided")
-	v.Check(product.ImageURL != "", "image_url", "must be provided")
-	v.Check(len(product.ImageURL) <= 255, "image_url", "must not be more than 255 characters long")
-	v.Check(len(product.Price) <= 10, "price", "must not be more than 10 characters long")
-	v.Check(product.Description != "", "description", "must be provided")
-	// v.Check(product.AverageRating >= 0 && product.AverageRating <= 5, "average_rating", "must be between 0 and 5")
+	v.Struct(product)
 }
 
-func (p ProductModel) InsertProduct(product *Product) error {
+func (p ProductModel) InsertProduct(ctx context.Context, product *Product) error {
+	ctx, span := tracing.Start(ctx, "ProductModel.InsertProduct")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return insertProduct(ctx, p.DB, product)
+}
+
+func insertProduct(ctx context.Context, q querier, product *Product) error {
 	query := `
 		INSERT INTO products (name, description, category, image_url, price)
 		VALUES ($1, $2, $3, $4, $5)
@@ -49,42 +54,45 @@ func (p ProductModel) InsertProduct(product *Product) error {
 	`
 	args := []any{product.Name, product.Description, product.Category, product.ImageURL, product.Price}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	return p.DB.QueryRowContext(ctx, query, args...).Scan(
+	return q.QueryRowContext(ctx, query, args...).Scan(
 		&product.ProductID,
 		&product.CreatedAt,
 		&product.Version,
 	)
 }
 
-func (p ProductModel) GetProduct(id int64) (*Product, error) {
+// GetProduct fetches a product. When fields are given only those columns
+// are selected and the rest of the product is left zero.
+func (p ProductModel) GetProduct(ctx context.Context, id int64, fields ...string) (*Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductModel.GetProduct")
+	defer span.End()
+
+	return p.GetLocalizedProduct(ctx, id, nil, fields...)
+}
+
+// GetLocalizedProduct is GetProduct with the name, description and category
+// taken from the first of locales the product has a translation for.
+func (p ProductModel) GetLocalizedProduct(ctx context.Context, id int64, locales []string, fields ...string) (*Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductModel.GetLocalizedProduct")
+	defer span.End()
+
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `
-		SELECT product_id, name, description, category, image_url, price, average_rating, created_at, version
-		FROM products
-		WHERE product_id = $1
-	`
-
 	var product Product
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	columns, targets := productColumns(&product, fields)
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM products p %s
+		WHERE p.product_id = $1
+	`, columns, translationJoin(2))
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	err := p.DB.QueryRowContext(ctx, query, id).Scan(
-		&product.ProductID,
-		&product.Name,
-		&product.Description,
-		&product.Category,
-		&product.ImageURL,
-		&product.Price,
-		&product.AverageRating,
-		&product.CreatedAt,
-		&product.Version,
-	)
+	err := p.DB.QueryRowContext(ctx, query, id, pq.Array(locales)).Scan(targets...)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -96,7 +104,17 @@ func (p ProductModel) GetProduct(id int64) (*Product, error) {
 	return &product, nil
 }
 
-func (p ProductModel) UpdateProduct(product *Product) error {
+func (p ProductModel) UpdateProduct(ctx context.Context, product *Product) error {
+	ctx, span := tracing.Start(ctx, "ProductModel.UpdateProduct")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return updateProduct(ctx, p.DB, product)
+}
+
+func updateProduct(ctx context.Context, q querier, product *Product) error {
 	query := `
 		UPDATE products
 		SET name = $1, description = $2, category = $3, image_url = $4, price = $5, average_rating = $6, version = version + 1
@@ -107,13 +125,24 @@ func (p ProductModel) UpdateProduct(product *Product) error {
 	// Removed `product.UpdatedAt` from the args slice
 	args := []any{product.Name, product.Description, product.Category, product.ImageURL, product.Price, product.AverageRating, product.ProductID}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	err := q.QueryRowContext(ctx, query, args...).Scan(&product.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRecordNotFound
+	}
+	return err
+}
+
+func (p ProductModel) DeleteProduct(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "ProductModel.DeleteProduct")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	return p.DB.QueryRowContext(ctx, query, args...).Scan(&product.Version)
+	return deleteProduct(ctx, p.DB, id)
 }
 
-func (p ProductModel) DeleteProduct(id int64) error {
+func deleteProduct(ctx context.Context, q querier, id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
@@ -123,10 +152,7 @@ func (p ProductModel) DeleteProduct(id int64) error {
 		WHERE product_id = $1
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	result, err := p.DB.ExecContext(ctx, query, id)
+	result, err := q.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -143,19 +169,30 @@ func (p ProductModel) DeleteProduct(id int64) error {
 	return nil
 }
 
-func (p ProductModel) GetAllProducts(name string, category string, filters Filters) ([]*Product, Metadata, error) {
+func (p ProductModel) GetAllProducts(ctx context.Context, name string, category string, filters Filters) ([]*Product, Metadata, error) {
+	ctx, span := tracing.Start(ctx, "ProductModel.GetAllProducts")
+	defer span.End()
+
+	var product Product
+	columns, targets := productColumns(&product, filters.Fields)
+
+	// Search the translated text when there is one, stemmed for the
+	// language of the translation. Rows without one keep the original
+	// text and the 'simple' configuration.
 	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), product_id, name, description, category, image_url, price, average_rating, created_at, version
-		FROM products
-		WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '') 
-		AND (to_tsvector('simple', category) @@ plainto_tsquery('simple', $2) OR $2 = '') 
-		ORDER BY %s %s, product_id ASC 
-		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		SELECT COUNT(*) OVER(), %[1]s
+		FROM products p %[2]s
+		CROSS JOIN LATERAL (SELECT %[3]s AS config) ts
+		WHERE (to_tsvector(ts.config, COALESCE(t.t_name, p.name)) @@ plainto_tsquery(ts.config, $1) OR $1 = '')
+		AND (to_tsvector(ts.config, COALESCE(t.t_category, p.category)) @@ plainto_tsquery(ts.config, $2) OR $2 = '')
+		AND p.product_id > $6
+		ORDER BY %[4]s %[5]s, product_id ASC
+		LIMIT $3 OFFSET $4`, columns, translationJoin(5), textSearchConfig, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	rows, err := p.DB.QueryContext(ctx, query, name, category, filters.limit(), filters.offset())
+	rows, err := p.DB.QueryContext(ctx, query, name, category, filters.limit(), filters.offset(), pq.Array(filters.Locales), filters.After)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -165,23 +202,13 @@ func (p ProductModel) GetAllProducts(name string, category string, filters Filte
 	products := []*Product{}
 
 	for rows.Next() {
-		var product Product
-		err := rows.Scan(
-			&totalRecords,
-			&product.ProductID,
-			&product.Name,
-			&product.Description,
-			&product.Category,
-			&product.ImageURL,
-			&product.Price,
-			&product.AverageRating,
-			&product.CreatedAt,
-			&product.Version,
-		)
+		product = Product{}
+		err := rows.Scan(append([]any{&totalRecords}, targets...)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
-		products = append(products, &product)
+		row := product
+		products = append(products, &row)
 	}
 
 	err = rows.Err()
@@ -192,3 +219,44 @@ func (p ProductModel) GetAllProducts(name string, category string, filters Filte
 	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
 	return products, metadata, nil
 }
+
+// RecomputeAverageRating recalculates the stored average rating of a product
+// from its reviews. The trigger on reviews normally keeps it up to date, this
+// is for repairing products whose rating drifted.
+func (p ProductModel) RecomputeAverageRating(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "ProductModel.RecomputeAverageRating")
+	defer span.End()
+
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE products
+		SET average_rating = COALESCE((
+			SELECT ROUND(CAST(AVG(rating) AS NUMERIC), 2)
+			FROM reviews
+			WHERE reviews.product_id = products.product_id
+		), 0)
+		WHERE product_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := p.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
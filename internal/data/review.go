@@ -8,18 +8,19 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/mtechguy/test2/internal/tracing"
 	"github.com/mtechguy/test2/internal/validator"
 )
 
 // Review struct
 type Review struct {
-	ReviewID     int64     `json:"review_id"`  // bigserial primary key
-	ProductID    int64     `json:"product_id"` // foreign key referencing products
-	Author       string    `json:"author"`
-	Rating       int64     `json:"rating"`        // integer with a constraint (1-5)
-	ReviewText   string    `json:"review_text"`   // non-null text field
-	HelpfulCount int32     `json:"helpful_count"` // nullable integer, default 0
-	CreatedAt    time.Time `json:"-"`             // timestamp with timezone, default now()
+	ReviewID     int64     `json:"review_id"`                   // bigserial primary key
+	ProductID    int64     `json:"product_id" validate:"min=1"` // foreign key referencing products
+	Author       string    `json:"author" validate:"required,maxlen=25"`
+	Rating       int64     `json:"rating" validate:"min=1,max=5"`   // integer with a constraint (1-5)
+	ReviewText   string    `json:"review_text" validate:"required"` // non-null text field
+	HelpfulCount int32     `json:"helpful_count"`                   // nullable integer, default 0
+	CreatedAt    time.Time `json:"-"`                               // timestamp with timezone, default now()
 	Version      int       `json:"version"`
 }
 
@@ -27,16 +28,22 @@ type ReviewModel struct {
 	DB *sql.DB
 }
 
+// ValidateReview checks a review against the validate tags on Review.
 func ValidateReview(v *validator.Validator, review *Review) {
-	v.Check(review.Author != "", "author", "must be provided")
-	v.Check(review.ReviewText != "", "review_text", "must be provided")
+	v.Struct(review)
+}
+
+func (c ReviewModel) InsertReview(ctx context.Context, review *Review) error {
+	ctx, span := tracing.Start(ctx, "ReviewModel.InsertReview")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
 
-	v.Check(len(review.Author) <= 25, "author", "must not be more than 25 bytes long")
-	v.Check(review.ProductID > 0, "product_id", "must be a positive integer")
-	v.Check(review.Rating >= 1 && review.Rating <= 5, "rating", "must be between 1 and 5")
+	return insertReview(ctx, c.DB, review)
 }
 
-func (c ReviewModel) InsertReview(review *Review) error {
+func insertReview(ctx context.Context, q querier, review *Review) error {
 	query := `
 		INSERT INTO reviews (product_id, author, rating, review_text, helpful_count)
 		VALUES ($1, $2, $3, $4, COALESCE($5, 0))
@@ -44,38 +51,33 @@ func (c ReviewModel) InsertReview(review *Review) error {
 	`
 	args := []any{review.ProductID, review.Author, review.Rating, review.ReviewText, review.HelpfulCount}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	return c.DB.QueryRowContext(ctx, query, args...).Scan(
+	return q.QueryRowContext(ctx, query, args...).Scan(
 		&review.ReviewID,
 		&review.CreatedAt,
 		&review.Version)
 }
-func (c ReviewModel) GetReview(id int64) (*Review, error) {
+
+// GetReview fetches a review, selecting only the given fields if any.
+func (c ReviewModel) GetReview(ctx context.Context, id int64, fields ...string) (*Review, error) {
+	ctx, span := tracing.Start(ctx, "ReviewModel.GetReview")
+	defer span.End()
+
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
-	query := `
-		SELECT review_id, product_id, author, rating, review_text, helpful_count, created_at, version
+	var review Review
+	columns, targets := reviewColumns(&review, fields)
+
+	query := fmt.Sprintf(`
+		SELECT %s
 		FROM reviews
 		WHERE review_id = $1
-	`
-	var review Review
+	`, columns)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	err := c.DB.QueryRowContext(ctx, query, id).Scan(
-		&review.ReviewID,
-		&review.ProductID,
-		&review.Author,
-		&review.Rating,
-		&review.ReviewText,
-		&review.HelpfulCount,
-		&review.CreatedAt,
-		&review.Version,
-	)
+	err := c.DB.QueryRowContext(ctx, query, id).Scan(targets...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrRecordNotFound
@@ -85,7 +87,17 @@ func (c ReviewModel) GetReview(id int64) (*Review, error) {
 	return &review, nil
 }
 
-func (c ReviewModel) UpdateReview(review *Review) error {
+func (c ReviewModel) UpdateReview(ctx context.Context, review *Review) error {
+	ctx, span := tracing.Start(ctx, "ReviewModel.UpdateReview")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return updateReview(ctx, c.DB, review)
+}
+
+func updateReview(ctx context.Context, q querier, review *Review) error {
 	query := `
 		UPDATE reviews
 		SET author = $1, rating = $2, review_text = $3, version = version + 1
@@ -95,13 +107,24 @@ func (c ReviewModel) UpdateReview(review *Review) error {
 
 	args := []any{review.Author, review.Rating, review.ReviewText, review.ReviewID}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	err := q.QueryRowContext(ctx, query, args...).Scan(&review.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRecordNotFound
+	}
+	return err
+}
+
+func (c ReviewModel) DeleteReview(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "ReviewModel.DeleteReview")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	return c.DB.QueryRowContext(ctx, query, args...).Scan(&review.Version)
+	return deleteReview(ctx, c.DB, id)
 }
 
-func (c ReviewModel) DeleteReview(id int64) error {
+func deleteReview(ctx context.Context, q querier, id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
@@ -110,10 +133,7 @@ func (c ReviewModel) DeleteReview(id int64) error {
 		WHERE review_id = $1
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	result, err := c.DB.ExecContext(ctx, query, id)
+	result, err := q.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -129,21 +149,28 @@ func (c ReviewModel) DeleteReview(id int64) error {
 	return nil
 }
 
-func (c ReviewModel) GetAllReviews(author string, filters Filters) ([]*Review, Metadata, error) {
+func (c ReviewModel) GetAllReviews(ctx context.Context, author string, filters Filters) ([]*Review, Metadata, error) {
+	ctx, span := tracing.Start(ctx, "ReviewModel.GetAllReviews")
+	defer span.End()
+
 	// Construct the SQL query with placeholders for parameters
+	var review Review
+	columns, targets := reviewColumns(&review, filters.Fields)
+
 	query := fmt.Sprintf(`
-	SELECT COUNT(*) OVER(), review_id, product_id, author, rating, review_text, helpful_count, created_at, version
+	SELECT COUNT(*) OVER(), %s
 	FROM reviews
 	WHERE (to_tsvector('simple', author) @@ plainto_tsquery('simple', $1) OR $1 = '') 
+	AND review_id > $4
 	ORDER BY %s %s, review_id ASC 
-	LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+	LIMIT $2 OFFSET $3`, columns, filters.sortColumn(), filters.sortDirection())
 
 	// Set a context with a 3-second timeout for query execution
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	// Execute the query with provided filters and parameters
-	rows, err := c.DB.QueryContext(ctx, query, author, filters.limit(), filters.offset())
+	rows, err := c.DB.QueryContext(ctx, query, author, filters.limit(), filters.offset(), filters.After)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -154,11 +181,12 @@ func (c ReviewModel) GetAllReviews(author string, filters Filters) ([]*Review, M
 
 	// Iterate over result rows and scan data into Review struct
 	for rows.Next() {
-		var review Review
-		if err := rows.Scan(&totalRecords, &review.ReviewID, &review.ProductID, &review.Author, &review.Rating, &review.ReviewText, &review.HelpfulCount, &review.CreatedAt, &review.Version); err != nil {
+		review = Review{}
+		if err := rows.Scan(append([]any{&totalRecords}, targets...)...); err != nil {
 			return nil, Metadata{}, err
 		}
-		reviews = append(reviews, &review)
+		row := review
+		reviews = append(reviews, &row)
 	}
 
 	// Check if any error occurred during row iteration
@@ -172,46 +200,61 @@ func (c ReviewModel) GetAllReviews(author string, filters Filters) ([]*Review, M
 	return reviews, metadata, nil
 }
 
-func (c ReviewModel) GetAllProductReviews(productID int64) ([]Review, error) {
+// GetAllProductReviews returns every review of a product, oldest first,
+// with only the given fields filled in. No fields means every column.
+func (c ReviewModel) GetAllProductReviews(ctx context.Context, productID int64, fields ...string) ([]Review, error) {
+	ctx, span := tracing.Start(ctx, "ReviewModel.GetAllProductReviews")
+	defer span.End()
+
+	return c.productReviews(ctx, productID, "review_id ASC", nil, fields)
+}
+
+// GetLatestProductReviews returns the limit most recent reviews of a
+// product, newest first.
+func (c ReviewModel) GetLatestProductReviews(ctx context.Context, productID int64, limit int, fields ...string) ([]Review, error) {
+	ctx, span := tracing.Start(ctx, "ReviewModel.GetLatestProductReviews")
+	defer span.End()
+
+	return c.productReviews(ctx, productID, "created_at DESC, review_id DESC", limit, fields)
+}
+
+// productReviews runs the query of the product review lists. order is one
+// of the fixed orders above; a nil limit is no limit.
+func (c ReviewModel) productReviews(ctx context.Context, productID int64, order string, limit any, fields []string) ([]Review, error) {
 	if productID < 1 {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `
-		SELECT review_id, author, rating, review_text, helpful_count, created_at, version
+	var review Review
+	columns, targets := reviewColumns(&review, fields)
+
+	query := fmt.Sprintf(`
+		SELECT %s
 		FROM reviews
 		WHERE product_id = $1
-	`
-
-	// Initialize a slice to hold all reviews for the product
-	var reviews []Review
+		ORDER BY %s
+		LIMIT $2`, columns, order)
 
 	// Set up the context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	// Query all rows that match the productID
-	rows, err := c.DB.QueryContext(ctx, query, productID)
+	rows, err := c.DB.QueryContext(ctx, query, productID, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	// Iterate through the rows and scan each row into a Review struct
+	var reviews []Review
 	for rows.Next() {
-		var review Review
-		err := rows.Scan(
-			&review.ReviewID,
-			&review.Author,
-			&review.Rating,
-			&review.ReviewText,
-			&review.HelpfulCount,
-			&review.CreatedAt,
-			&review.Version,
-		)
+		review = Review{}
+		err := rows.Scan(targets...)
 		if err != nil {
 			return nil, err
 		}
+		review.ProductID = productID
 		reviews = append(reviews, review)
 	}
 
@@ -223,21 +266,25 @@ func (c ReviewModel) GetAllProductReviews(productID int64) ([]Review, error) {
 	return reviews, nil
 }
 
-func (c *ReviewModel) UpdateHelpfulCount(id int64) (*Review, error) {
+func (c *ReviewModel) UpdateHelpfulCount(ctx context.Context, id int64) (*Review, error) {
+	ctx, span := tracing.Start(ctx, "ReviewModel.UpdateHelpfulCount")
+	defer span.End()
+
 	query := `
         UPDATE reviews
         SET helpful_count = helpful_count + 1
         WHERE review_id = $1
-        RETURNING review_id, author, rating, review_text, helpful_count, version
+        RETURNING review_id, product_id, author, rating, review_text, helpful_count, version
     `
 
 	var review Review
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	// Execute the query and scan the updated review fields
 	err := c.DB.QueryRowContext(ctx, query, id).Scan(
 		&review.ReviewID,
+		&review.ProductID,
 		&review.Author,
 		&review.Rating,
 		&review.ReviewText,
@@ -251,51 +298,53 @@ func (c *ReviewModel) UpdateHelpfulCount(id int64) (*Review, error) {
 	return &review, nil
 }
 
-func (m *ProductModel) ProductExists(productID int64) (bool, error) {
+func (m *ProductModel) ProductExists(ctx context.Context, productID int64) (bool, error) {
+	ctx, span := tracing.Start(ctx, "ProductModel.ProductExists")
+	defer span.End()
+
 	query := `SELECT EXISTS (SELECT 1 FROM products WHERE product_id = $1)`
 	var exists bool
-	err := m.DB.QueryRow(query, productID).Scan(&exists)
+	err := m.DB.QueryRowContext(ctx, query, productID).Scan(&exists)
 	if err != nil {
 		return false, err
 	}
 	return exists, nil
 }
-func (m *ReviewModel) Exists(id int64) (bool, error) {
+func (m *ReviewModel) Exists(ctx context.Context, id int64) (bool, error) {
+	ctx, span := tracing.Start(ctx, "ReviewModel.Exists")
+	defer span.End()
+
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM reviews WHERE review_id = $1)`
-	err := m.DB.QueryRow(query, id).Scan(&exists)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&exists)
 	if err != nil {
 		return false, err
 	}
 	return exists, nil
 }
 
-func (c ReviewModel) GetProductReview(rid int64, pid int64) (*Review, error) {
+func (c ReviewModel) GetProductReview(ctx context.Context, rid int64, pid int64, fields ...string) (*Review, error) {
+	ctx, span := tracing.Start(ctx, "ReviewModel.GetProductReview")
+	defer span.End()
+
 	//validate id
 	if pid < 1 || rid < 1 {
 		return nil, ErrRecordNotFound
 	}
 
+	var review Review
+	columns, targets := reviewColumns(&review, fields)
+
 	//query
-	query := `SELECT review_id, product_id, author, rating, review_text, helpful_count, created_at, version
+	query := fmt.Sprintf(`SELECT %s
 	FROM reviews
 	WHERE review_id = $1 AND product_id = $2
-	`
-	var review Review
+	`, columns)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	err := c.DB.QueryRowContext(ctx, query, rid, pid).Scan(
-		&review.ReviewID,
-		&review.ProductID,
-		&review.Author,
-		&review.Rating,
-		&review.ReviewText,
-		&review.HelpfulCount,
-		&review.CreatedAt,
-		&review.Version,
-	)
+	err := c.DB.QueryRowContext(ctx, query, rid, pid).Scan(targets...)
 
 	if err != nil {
 		switch {
@@ -307,3 +356,45 @@ func (c ReviewModel) GetProductReview(rid int64, pid int64) (*Review, error) {
 	}
 	return &review, nil
 }
+
+// RatingSummary describes how a product has been rated.
+type RatingSummary struct {
+	AverageRating float64        `json:"average_rating"`
+	ReviewCount   int            `json:"review_count"`
+	Distribution  map[string]int `json:"distribution"` // number of reviews per star rating
+}
+
+// GetRatingSummary counts a product's reviews by rating.
+func (c ReviewModel) GetRatingSummary(ctx context.Context, productID int64) (*RatingSummary, error) {
+	ctx, span := tracing.Start(ctx, "ReviewModel.GetRatingSummary")
+	defer span.End()
+
+	query := `
+		SELECT COALESCE(ROUND(CAST(AVG(rating) AS NUMERIC), 2), 0), COUNT(*),
+			COUNT(*) FILTER (WHERE rating = 1), COUNT(*) FILTER (WHERE rating = 2),
+			COUNT(*) FILTER (WHERE rating = 3), COUNT(*) FILTER (WHERE rating = 4),
+			COUNT(*) FILTER (WHERE rating = 5)
+		FROM reviews
+		WHERE product_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var summary RatingSummary
+	var stars [5]int
+	err := c.DB.QueryRowContext(ctx, query, productID).Scan(
+		&summary.AverageRating,
+		&summary.ReviewCount,
+		&stars[0], &stars[1], &stars[2], &stars[3], &stars[4],
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	summary.Distribution = make(map[string]int, len(stars))
+	for i, count := range stars {
+		summary.Distribution[fmt.Sprint(i+1)] = count
+	}
+	return &summary, nil
+}
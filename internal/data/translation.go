@@ -0,0 +1,267 @@
+// Filename: internal/data/translation.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mtechguy/test2/internal/tracing"
+	"github.com/mtechguy/test2/internal/validator"
+)
+
+// ProductTranslation is the name, description and category of a product in
+// another language.
+type ProductTranslation struct {
+	ProductID   int64     `json:"product_id"`
+	Locale      string    `json:"locale" validate:"required,pattern=locale"`
+	Name        string    `json:"name" validate:"required,maxlen=100"`
+	Description string    `json:"description" validate:"required,maxlen=500"`
+	Category    string    `json:"category" validate:"required"`
+	CreatedAt   time.Time `json:"-"`
+	Version     int32     `json:"version"`
+}
+
+type ProductTranslationModel struct {
+	DB *sql.DB
+}
+
+// localeRX matches the language tags translations are stored under: a
+// language, optionally followed by a region, e.g. es or es-MX.
+var localeRX = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+func init() {
+	validator.RegisterPattern("locale", localeRX, "locale")
+}
+
+// textSearchConfigs maps a language to the PostgreSQL text search
+// configuration that stems it. Other languages are searched with 'simple'.
+var textSearchConfigs = map[string]string{
+	"da": "danish",
+	"de": "german",
+	"en": "english",
+	"es": "spanish",
+	"fi": "finnish",
+	"fr": "french",
+	"hu": "hungarian",
+	"it": "italian",
+	"nb": "norwegian",
+	"nl": "dutch",
+	"no": "norwegian",
+	"pt": "portuguese",
+	"ro": "romanian",
+	"ru": "russian",
+	"sv": "swedish",
+	"tr": "turkish",
+}
+
+// NormalizeLocale writes a language tag the way translations are stored:
+// lower case language, upper case region.
+func NormalizeLocale(tag string) string {
+	language, region, found := strings.Cut(strings.TrimSpace(tag), "-")
+	if !found {
+		return strings.ToLower(language)
+	}
+	return strings.ToLower(language) + "-" + strings.ToUpper(region)
+}
+
+// ValidLocale reports whether tag is a language tag translations can be
+// stored under.
+func ValidLocale(tag string) bool {
+	return localeRX.MatchString(tag)
+}
+
+// LocalePreferences turns language tags, best first, into the list of
+// translations to look for: each regional tag is followed by its language
+// if that isn't asked for anyway, so es-MX still finds an es translation.
+func LocalePreferences(tags ...string) []string {
+	var locales []string
+	seen := make(map[string]bool)
+	add := func(locale string) {
+		if !seen[locale] {
+			seen[locale] = true
+			locales = append(locales, locale)
+		}
+	}
+
+	for i, tag := range tags {
+		add(tag)
+		language, _, found := strings.Cut(tag, "-")
+		if found && !containsLanguage(tags[i+1:], language) {
+			add(language)
+		}
+	}
+	return locales
+}
+
+func containsLanguage(tags []string, language string) bool {
+	for _, tag := range tags {
+		if tag == language {
+			return true
+		}
+	}
+	return false
+}
+
+// textSearchConfig is an SQL expression for the text search configuration
+// of a row joined by translationJoin: the one for the language of its
+// translation t, or 'simple' for the untranslated text. It is built from a
+// fixed list, so it is safe to put in a query.
+var textSearchConfig = func() string {
+	var b strings.Builder
+	b.WriteString("CASE split_part(lower(t.t_locale), '-', 1)")
+	for _, language := range slices.Sorted(maps.Keys(textSearchConfigs)) {
+		fmt.Fprintf(&b, " WHEN '%s' THEN '%s'::regconfig", language, textSearchConfigs[language])
+	}
+	b.WriteString(" ELSE 'simple'::regconfig END")
+	return b.String()
+}()
+
+// translationJoin joins the translation of product p that best matches the
+// locales, passed as query parameter $param, as t. Products without a
+// matching translation get a row of nulls.
+func translationJoin(param int) string {
+	return fmt.Sprintf(`
+		LEFT JOIN LATERAL (
+			SELECT pt.locale AS t_locale, pt.name AS t_name, pt.description AS t_description, pt.category AS t_category
+			FROM product_translations pt
+			WHERE pt.product_id = p.product_id AND pt.locale = ANY($%[1]d::text[])
+			ORDER BY array_position($%[1]d::text[], pt.locale)
+			LIMIT 1
+		) t ON true`, param)
+}
+
+func ValidateProductTranslation(v *validator.Validator, translation *ProductTranslation) {
+	v.Struct(translation)
+}
+
+// UpsertTranslation adds a translation or replaces the one the product
+// already has for that locale. created is true for a new translation.
+func (m ProductTranslationModel) UpsertTranslation(ctx context.Context, translation *ProductTranslation) (created bool, err error) {
+	ctx, span := tracing.Start(ctx, "ProductTranslationModel.UpsertTranslation")
+	defer span.End()
+
+	query := `
+		INSERT INTO product_translations (product_id, locale, name, description, category)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (product_id, locale) DO UPDATE
+		SET name = EXCLUDED.name, description = EXCLUDED.description, category = EXCLUDED.category,
+			version = product_translations.version + 1
+		RETURNING created_at, version, (xmax = 0)
+	`
+	args := []any{translation.ProductID, translation.Locale, translation.Name, translation.Description, translation.Category}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&translation.CreatedAt, &translation.Version, &created)
+	return created, err
+}
+
+func (m ProductTranslationModel) GetTranslation(ctx context.Context, productID int64, locale string) (*ProductTranslation, error) {
+	ctx, span := tracing.Start(ctx, "ProductTranslationModel.GetTranslation")
+	defer span.End()
+
+	query := `
+		SELECT product_id, locale, name, description, category, created_at, version
+		FROM product_translations
+		WHERE product_id = $1 AND locale = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var translation ProductTranslation
+	err := m.DB.QueryRowContext(ctx, query, productID, locale).Scan(
+		&translation.ProductID,
+		&translation.Locale,
+		&translation.Name,
+		&translation.Description,
+		&translation.Category,
+		&translation.CreatedAt,
+		&translation.Version,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &translation, nil
+}
+
+func (m ProductTranslationModel) GetAllTranslations(ctx context.Context, productID int64) ([]*ProductTranslation, error) {
+	ctx, span := tracing.Start(ctx, "ProductTranslationModel.GetAllTranslations")
+	defer span.End()
+
+	query := `
+		SELECT product_id, locale, name, description, category, created_at, version
+		FROM product_translations
+		WHERE product_id = $1
+		ORDER BY locale
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := []*ProductTranslation{}
+	for rows.Next() {
+		var translation ProductTranslation
+		err := rows.Scan(
+			&translation.ProductID,
+			&translation.Locale,
+			&translation.Name,
+			&translation.Description,
+			&translation.Category,
+			&translation.CreatedAt,
+			&translation.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		translations = append(translations, &translation)
+	}
+
+	return translations, rows.Err()
+}
+
+func (m ProductTranslationModel) DeleteTranslation(ctx context.Context, productID int64, locale string) error {
+	ctx, span := tracing.Start(ctx, "ProductTranslationModel.DeleteTranslation")
+	defer span.End()
+
+	query := `
+		DELETE FROM product_translations
+		WHERE product_id = $1 AND locale = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, productID, locale)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,471 @@
+// Filename: internal/data/webhook.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mtechguy/test2/internal/tracing"
+	"github.com/mtechguy/test2/internal/validator"
+)
+
+// Event types a webhook subscription can select.
+const (
+	EventProductCreated = "product.created"
+	EventProductUpdated = "product.updated"
+	EventProductDeleted = "product.deleted"
+	EventReviewCreated  = "review.created"
+	EventReviewUpdated  = "review.updated"
+	EventReviewDeleted  = "review.deleted"
+	EventReviewHelpful  = "review.helpful"
+)
+
+var WebhookEvents = []string{
+	EventProductCreated,
+	EventProductUpdated,
+	EventProductDeleted,
+	EventReviewCreated,
+	EventReviewUpdated,
+	EventReviewDeleted,
+	EventReviewHelpful,
+}
+
+// Delivery states. A delivery starts out pending, and ends up either
+// delivered or dead once it has run out of attempts.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+type Webhook struct {
+	WebhookID int64     `json:"webhook_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // only returned when the webhook is created
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	Version   int32     `json:"version"`
+}
+
+type WebhookDelivery struct {
+	DeliveryID     int64           `json:"delivery_id"`
+	WebhookID      int64           `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code"`
+	LastError      *string         `json:"last_error"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+type WebhookModel struct {
+	DB *sql.DB
+}
+
+func ValidateWebhook(v *validator.Validator, webhook *Webhook) {
+	v.Field("url", webhook.URL, validator.Required(), validator.MaxLength(2048), validator.URL())
+	v.Field("secret", webhook.Secret, validator.Required(), validator.MinLength(16))
+	v.Field("events", webhook.Events, validator.Required(), validator.OneOf(WebhookEvents...), validator.Unique())
+}
+
+func (w WebhookModel) InsertWebhook(ctx context.Context, webhook *Webhook) error {
+	ctx, span := tracing.Start(ctx, "WebhookModel.InsertWebhook")
+	defer span.End()
+
+	query := `
+		INSERT INTO webhooks (url, secret, events, active)
+		VALUES ($1, $2, $3, $4)
+		RETURNING webhook_id, created_at, version
+	`
+	args := []any{webhook.URL, webhook.Secret, pq.Array(webhook.Events), webhook.Active}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return w.DB.QueryRowContext(ctx, query, args...).Scan(
+		&webhook.WebhookID,
+		&webhook.CreatedAt,
+		&webhook.Version,
+	)
+}
+
+func (w WebhookModel) GetWebhook(ctx context.Context, id int64) (*Webhook, error) {
+	ctx, span := tracing.Start(ctx, "WebhookModel.GetWebhook")
+	defer span.End()
+
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT webhook_id, url, secret, events, active, created_at, version
+		FROM webhooks
+		WHERE webhook_id = $1
+	`
+
+	var webhook Webhook
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := w.DB.QueryRowContext(ctx, query, id).Scan(
+		&webhook.WebhookID,
+		&webhook.URL,
+		&webhook.Secret,
+		pq.Array(&webhook.Events),
+		&webhook.Active,
+		&webhook.CreatedAt,
+		&webhook.Version,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+func (w WebhookModel) UpdateWebhook(ctx context.Context, webhook *Webhook) error {
+	ctx, span := tracing.Start(ctx, "WebhookModel.UpdateWebhook")
+	defer span.End()
+
+	query := `
+		UPDATE webhooks
+		SET url = $1, secret = $2, events = $3, active = $4, version = version + 1
+		WHERE webhook_id = $5
+		RETURNING version
+	`
+	args := []any{webhook.URL, webhook.Secret, pq.Array(webhook.Events), webhook.Active, webhook.WebhookID}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return w.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.Version)
+}
+
+func (w WebhookModel) DeleteWebhook(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "WebhookModel.DeleteWebhook")
+	defer span.End()
+
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM webhooks
+		WHERE webhook_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := w.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (w WebhookModel) GetAllWebhooks(ctx context.Context, filters Filters) ([]*Webhook, Metadata, error) {
+	ctx, span := tracing.Start(ctx, "WebhookModel.GetAllWebhooks")
+	defer span.End()
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), webhook_id, url, events, active, created_at, version
+		FROM webhooks
+		ORDER BY %s %s, webhook_id ASC
+		LIMIT $1 OFFSET $2`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := w.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	webhooks := []*Webhook{}
+
+	for rows.Next() {
+		var webhook Webhook
+		err := rows.Scan(
+			&totalRecords,
+			&webhook.WebhookID,
+			&webhook.URL,
+			pq.Array(&webhook.Events),
+			&webhook.Active,
+			&webhook.CreatedAt,
+			&webhook.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return webhooks, metadata, nil
+}
+
+// EnqueueDeliveries records a pending delivery of the event for every active
+// webhook subscribed to it.
+func (w WebhookModel) EnqueueDeliveries(ctx context.Context, event string, payload []byte) error {
+	ctx, span := tracing.Start(ctx, "WebhookModel.EnqueueDeliveries")
+	defer span.End()
+
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT webhook_id, $1, $2
+		FROM webhooks
+		WHERE active AND $1 = ANY(events)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := w.DB.ExecContext(ctx, query, event, string(payload))
+	return err
+}
+
+// ClaimDueDeliveries returns up to limit pending deliveries whose next attempt
+// is due, together with the webhook each one belongs to. The rows are
+// pushed forward by lease so that a second worker does not pick up the same
+// delivery while the first one is still sending it. Deliveries of inactive
+// webhooks stay pending until the webhook is reactivated.
+func (w WebhookModel) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*WebhookDelivery, map[int64]*Webhook, error) {
+	ctx, span := tracing.Start(ctx, "WebhookModel.ClaimDueDeliveries")
+	defer span.End()
+
+	query := `
+		WITH due AS (
+			SELECT d.delivery_id
+			FROM webhook_deliveries d
+			JOIN webhooks h ON h.webhook_id = d.webhook_id
+			WHERE d.status = 'pending' AND d.next_attempt_at <= NOW() AND h.active
+			ORDER BY d.next_attempt_at, d.delivery_id
+			LIMIT $1
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + make_interval(secs => $2)
+		FROM due, webhooks h
+		WHERE d.delivery_id = due.delivery_id AND h.webhook_id = d.webhook_id
+		RETURNING d.delivery_id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.created_at,
+			h.url, h.secret, h.events, h.active, h.version
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := w.DB.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	webhooks := make(map[int64]*Webhook)
+
+	for rows.Next() {
+		var delivery WebhookDelivery
+		var webhook Webhook
+		err := rows.Scan(
+			&delivery.DeliveryID,
+			&delivery.WebhookID,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.CreatedAt,
+			&webhook.URL,
+			&webhook.Secret,
+			pq.Array(&webhook.Events),
+			&webhook.Active,
+			&webhook.Version,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		webhook.WebhookID = delivery.WebhookID
+		deliveries = append(deliveries, &delivery)
+		webhooks[webhook.WebhookID] = &webhook
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return deliveries, webhooks, nil
+}
+
+// MarkDelivered records a successful attempt.
+func (w WebhookModel) MarkDelivered(ctx context.Context, id int64, statusCode int) error {
+	ctx, span := tracing.Start(ctx, "WebhookModel.MarkDelivered")
+	defer span.End()
+
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'delivered', attempts = attempts + 1, last_status_code = $1,
+			last_error = NULL, delivered_at = NOW()
+		WHERE delivery_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := w.DB.ExecContext(ctx, query, statusCode, id)
+	return err
+}
+
+// MarkFailed records a failed attempt. If nextAttempt is nil the delivery is
+// moved to the dead-letter state and will not be tried again.
+func (w WebhookModel) MarkFailed(ctx context.Context, id int64, statusCode int, reason string, nextAttempt *time.Time) error {
+	ctx, span := tracing.Start(ctx, "WebhookModel.MarkFailed")
+	defer span.End()
+
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = attempts + 1, last_status_code = NULLIF($2, 0),
+			last_error = $3, next_attempt_at = COALESCE($4, next_attempt_at)
+		WHERE delivery_id = $5
+	`
+
+	status := DeliveryPending
+	if nextAttempt == nil {
+		status = DeliveryDead
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := w.DB.ExecContext(ctx, query, status, statusCode, reason, nextAttempt, id)
+	return err
+}
+
+// RetryDelivery puts a dead or delivered delivery back in the queue with a
+// fresh set of attempts.
+func (w WebhookModel) RetryDelivery(ctx context.Context, webhookID int64, deliveryID int64) (*WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, "WebhookModel.RetryDelivery")
+	defer span.End()
+
+	if webhookID < 1 || deliveryID < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+		WHERE delivery_id = $1 AND webhook_id = $2
+		RETURNING delivery_id, webhook_id, event, payload, status, attempts, next_attempt_at,
+			last_status_code, last_error, delivered_at, created_at
+	`
+
+	var delivery WebhookDelivery
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := w.DB.QueryRowContext(ctx, query, deliveryID, webhookID).Scan(
+		&delivery.DeliveryID,
+		&delivery.WebhookID,
+		&delivery.Event,
+		&delivery.Payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.LastStatusCode,
+		&delivery.LastError,
+		&delivery.DeliveredAt,
+		&delivery.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+// GetAllDeliveries returns the delivery log of a webhook, optionally narrowed
+// down to a single status.
+func (w WebhookModel) GetAllDeliveries(ctx context.Context, webhookID int64, status string, filters Filters) ([]*WebhookDelivery, Metadata, error) {
+	ctx, span := tracing.Start(ctx, "WebhookModel.GetAllDeliveries")
+	defer span.End()
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), delivery_id, webhook_id, event, payload, status, attempts, next_attempt_at,
+			last_status_code, last_error, delivered_at, created_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		AND (status = $2 OR $2 = '')
+		ORDER BY %s %s, delivery_id ASC
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := w.DB.QueryContext(ctx, query, webhookID, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	deliveries := []*WebhookDelivery{}
+
+	for rows.Next() {
+		var delivery WebhookDelivery
+		err := rows.Scan(
+			&totalRecords,
+			&delivery.DeliveryID,
+			&delivery.WebhookID,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.LastStatusCode,
+			&delivery.LastError,
+			&delivery.DeliveredAt,
+			&delivery.CreatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return deliveries, metadata, nil
+}
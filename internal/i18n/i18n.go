@@ -0,0 +1,123 @@
+// Filename: internal/i18n/i18n.go
+
+// Package i18n holds the message catalogs of the API and picks the language
+// to answer in from the Accept-Language header.
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLanguage is used when the client accepts none of the languages we
+// have catalogs for, and for messages missing from a catalog.
+const DefaultLanguage = "en"
+
+// catalogs maps a language to its messages, keyed by message code. Messages
+// refer to parameters as {name}.
+var catalogs = map[string]map[string]string{
+	"en": english,
+	"es": spanish,
+}
+
+// Languages returns the languages there are catalogs for.
+func Languages() []string {
+	languages := make([]string, 0, len(catalogs))
+	for language := range catalogs {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Negotiate picks the best supported language for an Accept-Language
+// header, honouring q-values. A regional tag such as es-MX matches the es
+// catalog. Anything unusable falls back to DefaultLanguage.
+func Negotiate(acceptLanguage string) string {
+	for _, tag := range acceptedTags(acceptLanguage) {
+		language, _, _ := strings.Cut(tag, "-")
+		if language == "*" {
+			return DefaultLanguage
+		}
+		if _, found := catalogs[language]; found {
+			return language
+		}
+	}
+	return DefaultLanguage
+}
+
+// Preferences returns the language tags of an Accept-Language header, most
+// preferred first, for content that isn't limited to the catalogs. The
+// wildcard and tags with a q-value of zero are left out.
+func Preferences(acceptLanguage string) []string {
+	var tags []string
+	for _, tag := range acceptedTags(acceptLanguage) {
+		if tag != "*" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// acceptedTags parses an Accept-Language header into lower case tags
+// ordered by q-value. Tags with equal q-values keep their order and
+// malformed entries are skipped.
+func acceptedTags(acceptLanguage string) []string {
+	type weightedTag struct {
+		tag string
+		q   float64
+	}
+
+	var weighted []weightedTag
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+
+		q := 1.0
+		params = strings.TrimSpace(params)
+		if value, found := strings.CutPrefix(params, "q="); found {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+		weighted = append(weighted, weightedTag{tag, q})
+	}
+
+	sort.SliceStable(weighted, func(i, j int) bool {
+		return weighted[i].q > weighted[j].q
+	})
+
+	tags := make([]string, len(weighted))
+	for i, w := range weighted {
+		tags[i] = w.tag
+	}
+	return tags
+}
+
+// Translate returns the message for code in language with its parameters
+// filled in. Messages missing from the language's catalog come from the
+// default one; unknown codes are returned as they are.
+func Translate(language string, code string, params map[string]any) string {
+	message, found := catalogs[language][code]
+	if !found {
+		message, found = catalogs[DefaultLanguage][code]
+	}
+	if !found {
+		return code
+	}
+
+	for name, value := range params {
+		message = strings.ReplaceAll(message, "{"+name+"}", fmt.Sprint(value))
+	}
+	return message
+}
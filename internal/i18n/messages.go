@@ -0,0 +1,193 @@
+// Filename: internal/i18n/messages.go
+package i18n
+
+// Error codes have a title (code.title) and a detail (code). Validation
+// codes only have the message shown for the field.
+
+var english = map[string]string{
+	// errors
+	"bad_request.title":                 "Bad request",
+	"bad_request":                       "{error}",
+	"validation_failed.title":           "Validation failed",
+	"validation_failed":                 "one or more fields failed validation",
+	"not_found.title":                   "Resource not found",
+	"not_found":                         "the requested resource could not be found",
+	"product_not_found.title":           "Product not found",
+	"product_not_found":                 "product with id = {id} was not found",
+	"review_not_found.title":            "Review not found",
+	"review_not_found":                  "review with id = {id} was not found",
+	"translation_not_found.title":       "Translation not found",
+	"translation_not_found":             "product with id = {id} has no {locale} translation",
+	"method_not_allowed.title":          "Method not allowed",
+	"method_not_allowed":                "the {method} method is not supported for this resource",
+	"not_acceptable.title":              "Not acceptable",
+	"not_acceptable":                    "the requested representation is not available; supported types are application/json, application/xml and text/csv (for lists)",
+	"rate_limit_exceeded.title":         "Rate limit exceeded",
+	"rate_limit_exceeded":               "rate limit exceeded",
+	"idempotency_key_mismatch.title":    "Idempotency key reused",
+	"idempotency_key_mismatch":          "the Idempotency-Key has already been used with a different request",
+	"idempotency_key_in_progress.title": "Idempotency key in progress",
+	"idempotency_key_in_progress":       "a request with this Idempotency-Key is still being processed",
+	"patch_test_failed.title":           "Patch test failed",
+	"patch_test_failed":                 "the resource does not match the patch: {error}",
+	"patch_not_applicable.title":        "Patch not applicable",
+	"patch_not_applicable":              "{error}",
+	"internal_error.title":              "Internal server error",
+	"internal_error":                    "the server encountered a problem and could not process your request",
+	"service_unavailable.title":         "Service unavailable",
+	"service_unavailable":               "the server is shutting down, please retry shortly",
+	"export_interrupted":                "the export failed before it was complete, the rows sent are not all of them",
+
+	// bad request details
+	"body_malformed":           "the body contains badly-formed JSON",
+	"body_malformed_at":        "the body contains badly-formed JSON (at character {offset})",
+	"body_field_type":          "the body contains the incorrect JSON type for field {field}",
+	"body_type_at":             "the body contains the incorrect JSON type (at character {offset})",
+	"body_empty":               "the body must not be empty",
+	"body_unknown_field":       "the body contains unknown key {field}",
+	"body_missing_field":       "the body must contain {field}",
+	"body_too_large":           "the body must not be larger than {max} bytes",
+	"body_multiple_values":     "the body must only contain a single JSON value",
+	"upload_too_large":         "the upload must not be larger than {max} bytes",
+	"idempotency_key_too_long": "the Idempotency-Key header must not be more than {max} characters long",
+	"last_event_id":            "the Last-Event-ID header must be the ID of an event",
+	"import_header_missing":    "the upload must start with a header row",
+	"import_header_malformed":  "the header row is not valid CSV (at line {line}, column {column})",
+	"locale_param":             "the locale must be a language tag such as en or es-MX",
+	"patch_field_type":         "the patched document has the incorrect JSON type for field {field}",
+	"patch_unknown_field":      "the patched document contains unknown key {field}",
+	"patch_not_object":         "the patched document must be a JSON object",
+
+	// bulk operation failures
+	"data_missing":           "data must be provided",
+	"data_invalid":           "data must be a JSON object",
+	"data_field_type":        "data contains the incorrect JSON type for field {field}",
+	"data_unknown_field":     "data contains unknown key {field}",
+	"operation_not_executed": "not executed because another operation is invalid",
+	"operation_rolled_back":  "rolled back because another operation failed",
+	"operation_failed":       "the server encountered a problem and could not process this operation",
+
+	// validation
+	"required":         "must be provided",
+	"min_length":       "must be at least {min} characters long",
+	"max_length":       "must not be more than {max} characters long",
+	"min_items":        "must contain at least {min} items",
+	"max_items":        "must not contain more than {max} items",
+	"min_value":        "must be at least {min}",
+	"max_value":        "must not be more than {max}",
+	"between":          "must be between {min} and {max}",
+	"positive":         "must be greater than zero",
+	"integer":          "must be an integer value",
+	"boolean":          "must be true or false",
+	"url":              "must be an absolute http or https URL",
+	"email":            "must be a valid email address",
+	"locale":           "must be a language tag such as es or es-MX",
+	"pattern":          "has an invalid format",
+	"one_of":           "must be one of {values}",
+	"unique":           "must not contain duplicate values",
+	"exclusive":        "cannot be used together with {other}",
+	"unknown_field":    "unknown field {field}, must be one of {values}",
+	"mapping_format":   "must be a comma separated list of field=column pairs",
+	"missing_column":   "column {column} is not in the header row",
+	"immutable_fields": "{fields} cannot be updated",
+	"row_malformed":    "must be valid CSV (error at line {line}, column {column})",
+	"row_column_count": "must have as many columns as the header row",
+	"row_not_object":   "must be a JSON object",
+	"row_value_type":   "{field} must be a string or a number",
+	"row_not_saved":    "the row could not be saved",
+	"import_format":    "must be csv or ndjson, set it with the format parameter or the Content-Type header",
+}
+
+var spanish = map[string]string{
+	// errors
+	"bad_request.title":                 "Solicitud incorrecta",
+	"bad_request":                       "la solicitud no es válida: {error}",
+	"validation_failed.title":           "Error de validación",
+	"validation_failed":                 "uno o más campos no son válidos",
+	"not_found.title":                   "Recurso no encontrado",
+	"not_found":                         "no se encontró el recurso solicitado",
+	"product_not_found.title":           "Producto no encontrado",
+	"product_not_found":                 "no se encontró el producto con id = {id}",
+	"review_not_found.title":            "Reseña no encontrada",
+	"review_not_found":                  "no se encontró la reseña con id = {id}",
+	"translation_not_found.title":       "Traducción no encontrada",
+	"translation_not_found":             "el producto con id = {id} no tiene traducción {locale}",
+	"method_not_allowed.title":          "Método no permitido",
+	"method_not_allowed":                "el método {method} no está permitido para este recurso",
+	"not_acceptable.title":              "No aceptable",
+	"not_acceptable":                    "la representación solicitada no está disponible; los tipos admitidos son application/json, application/xml y text/csv (para listas)",
+	"rate_limit_exceeded.title":         "Límite de solicitudes excedido",
+	"rate_limit_exceeded":               "se excedió el límite de solicitudes",
+	"idempotency_key_mismatch.title":    "Clave de idempotencia reutilizada",
+	"idempotency_key_mismatch":          "la Idempotency-Key ya se usó con una solicitud diferente",
+	"idempotency_key_in_progress.title": "Clave de idempotencia en curso",
+	"idempotency_key_in_progress":       "una solicitud con esta Idempotency-Key todavía se está procesando",
+	"patch_test_failed.title":           "Falló la prueba del parche",
+	"patch_test_failed":                 "el recurso no coincide con el parche: {error}",
+	"patch_not_applicable.title":        "Parche no aplicable",
+	"patch_not_applicable":              "el parche no se puede aplicar: {error}",
+	"internal_error.title":              "Error interno del servidor",
+	"internal_error":                    "el servidor tuvo un problema y no pudo procesar la solicitud",
+	"service_unavailable.title":         "Servicio no disponible",
+	"service_unavailable":               "el servidor se está apagando, vuelva a intentarlo en breve",
+	"export_interrupted":                "la exportación falló antes de completarse, las filas enviadas no son todas",
+
+	// bad request details
+	"body_malformed":           "el cuerpo contiene JSON mal formado",
+	"body_malformed_at":        "el cuerpo contiene JSON mal formado (en el carácter {offset})",
+	"body_field_type":          "el cuerpo tiene un tipo JSON incorrecto para el campo {field}",
+	"body_type_at":             "el cuerpo tiene un tipo JSON incorrecto (en el carácter {offset})",
+	"body_empty":               "el cuerpo no debe estar vacío",
+	"body_unknown_field":       "el cuerpo contiene la clave desconocida {field}",
+	"body_missing_field":       "el cuerpo debe contener {field}",
+	"body_too_large":           "el cuerpo no debe superar los {max} bytes",
+	"body_multiple_values":     "el cuerpo solo debe contener un valor JSON",
+	"upload_too_large":         "el archivo subido no debe superar los {max} bytes",
+	"idempotency_key_too_long": "la cabecera Idempotency-Key no debe tener más de {max} caracteres",
+	"last_event_id":            "la cabecera Last-Event-ID debe ser el ID de un evento",
+	"import_header_missing":    "el archivo subido debe empezar con una fila de encabezado",
+	"import_header_malformed":  "la fila de encabezado no es CSV válido (en la línea {line}, columna {column})",
+	"locale_param":             "el idioma debe ser una etiqueta como en o es-MX",
+	"patch_field_type":         "el documento parcheado tiene un tipo JSON incorrecto para el campo {field}",
+	"patch_unknown_field":      "el documento parcheado contiene la clave desconocida {field}",
+	"patch_not_object":         "el documento parcheado debe ser un objeto JSON",
+
+	// bulk operation failures
+	"data_missing":           "se debe indicar data",
+	"data_invalid":           "data debe ser un objeto JSON",
+	"data_field_type":        "data tiene un tipo JSON incorrecto para el campo {field}",
+	"data_unknown_field":     "data contiene la clave desconocida {field}",
+	"operation_not_executed": "no se ejecutó porque otra operación no es válida",
+	"operation_rolled_back":  "se revirtió porque otra operación falló",
+	"operation_failed":       "el servidor tuvo un problema y no pudo procesar esta operación",
+
+	// validation
+	"required":         "es obligatorio",
+	"min_length":       "debe tener al menos {min} caracteres",
+	"max_length":       "no debe tener más de {max} caracteres",
+	"min_items":        "debe contener al menos {min} elementos",
+	"max_items":        "no debe contener más de {max} elementos",
+	"min_value":        "debe ser como mínimo {min}",
+	"max_value":        "no debe ser mayor que {max}",
+	"between":          "debe estar entre {min} y {max}",
+	"positive":         "debe ser mayor que cero",
+	"integer":          "debe ser un número entero",
+	"boolean":          "debe ser true o false",
+	"url":              "debe ser una URL http o https absoluta",
+	"email":            "debe ser una dirección de correo electrónico válida",
+	"locale":           "debe ser una etiqueta de idioma como es o es-MX",
+	"pattern":          "tiene un formato no válido",
+	"one_of":           "debe ser uno de: {values}",
+	"unique":           "no debe contener valores duplicados",
+	"exclusive":        "no se puede usar junto con {other}",
+	"unknown_field":    "campo desconocido {field}, debe ser uno de: {values}",
+	"mapping_format":   "debe ser una lista separada por comas de pares campo=columna",
+	"missing_column":   "la columna {column} no está en la fila de encabezado",
+	"immutable_fields": "{fields} no se pueden modificar",
+	"row_malformed":    "debe ser CSV válido (error en la línea {line}, columna {column})",
+	"row_column_count": "debe tener tantas columnas como la fila de encabezado",
+	"row_not_object":   "debe ser un objeto JSON",
+	"row_value_type":   "{field} debe ser una cadena o un número",
+	"row_not_saved":    "no se pudo guardar la fila",
+	"import_format":    "debe ser csv o ndjson; indíquelo con el parámetro format o la cabecera Content-Type",
+}
@@ -0,0 +1,66 @@
+// Filename: internal/jobs/enqueue.go
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mtechguy/test2/internal/data"
+)
+
+// Options tune how a job is enqueued.
+type Options struct {
+	RunAt       time.Time // zero means as soon as possible
+	UniqueKey   string    // empty means no uniqueness
+	MaxAttempts int       // zero means the queue default
+}
+
+// Enqueue encodes payload and adds a job of the given kind. A job whose
+// unique key is already waiting is silently skipped; one whose key is only
+// running is still queued.
+func Enqueue(ctx context.Context, model data.JobModel, kind string, payload any, opts Options) (*data.Job, error) {
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &data.Job{
+		Kind:        kind,
+		Payload:     js,
+		RunAt:       opts.RunAt,
+		MaxAttempts: opts.MaxAttempts,
+	}
+	if opts.UniqueKey != "" {
+		job.UniqueKey = &opts.UniqueKey
+	}
+
+	err = model.EnqueueJob(ctx, job)
+	if err != nil && !errors.Is(err, data.ErrDuplicateJob) {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// Kinds of jobs run by the API.
+const (
+	KindRecomputeRating      = "rating.recompute"
+	KindPruneIdempotencyKeys = "idempotency.prune"
+)
+
+// RecomputeRatingPayload is the payload of a KindRecomputeRating job.
+type RecomputeRatingPayload struct {
+	ProductID int64 `json:"product_id"`
+}
+
+// EnqueueRecomputeRating queues a recount of the average rating of a
+// product, unless one is already waiting for it. A recount that is running
+// may have missed the change, so it doesn't stop another being queued.
+func EnqueueRecomputeRating(ctx context.Context, model data.JobModel, productID int64) (*data.Job, error) {
+	return Enqueue(ctx, model, KindRecomputeRating, RecomputeRatingPayload{ProductID: productID}, Options{
+		UniqueKey: fmt.Sprintf("%s:%d", KindRecomputeRating, productID),
+	})
+}
@@ -0,0 +1,185 @@
+// Filename: internal/jobs/pool.go
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mtechguy/test2/internal/data"
+)
+
+// HandlerFunc runs a single job. Returning an error schedules a retry.
+type HandlerFunc func(ctx context.Context, job *data.Job) error
+
+// Pool runs the jobs stored in the jobs table with a fixed number of
+// workers. Jobs are claimed with FOR UPDATE SKIP LOCKED, so several API
+// instances can share the same queue.
+type Pool struct {
+	Model        data.JobModel
+	Logger       *slog.Logger
+	Workers      int
+	PollInterval time.Duration
+	JobTimeout   time.Duration
+
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+}
+
+func NewPool(model data.JobModel, logger *slog.Logger, workers int, pollInterval time.Duration) *Pool {
+	return &Pool{
+		Model:        model,
+		Logger:       logger,
+		Workers:      workers,
+		PollInterval: pollInterval,
+		JobTimeout:   5 * time.Minute,
+		handlers:     make(map[string]HandlerFunc),
+	}
+}
+
+// Register sets the handler for a kind of job. Only registered kinds are
+// claimed by this pool.
+func (p *Pool) Register(kind string, handler HandlerFunc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handlers[kind] = handler
+}
+
+func (p *Pool) kinds() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	kinds := make([]string, 0, len(p.handlers))
+	for kind := range p.handlers {
+		kinds = append(kinds, kind)
+	}
+	return kinds
+}
+
+func (p *Pool) handler(kind string) (HandlerFunc, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	handler, found := p.handlers[kind]
+	return handler, found
+}
+
+// Run starts the workers and blocks until ctx is cancelled. Workers stop
+// claiming new jobs as soon as ctx is done, but a job that is already
+// running is allowed to finish before Run returns.
+func (p *Pool) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for i := 0; i < p.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.work(ctx)
+		}()
+	}
+
+	// Put back jobs left running by an instance that died mid-job.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n, err := p.Model.RescueStaleJobs(ctx, 2*p.JobTimeout)
+				if err != nil {
+					p.Logger.Error("rescuing stale jobs failed", "error", err.Error())
+				} else if n > 0 {
+					p.Logger.Warn("rescued stale jobs", "count", n)
+				}
+			}
+		}
+	}()
+
+	wg.Wait()
+}
+
+func (p *Pool) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		job, err := p.Model.ClaimJob(ctx, p.kinds())
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) && ctx.Err() == nil {
+				p.Logger.Error("claiming job failed", "error", err.Error())
+			}
+			// Nothing to do (or the database is unhappy); wait a bit.
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(p.PollInterval):
+			}
+			continue
+		}
+
+		// The job is not tied to ctx: shutting down stops new claims but
+		// lets this one finish.
+		p.run(context.WithoutCancel(ctx), job)
+	}
+}
+
+func (p *Pool) run(ctx context.Context, job *data.Job) {
+	// The job's timeout doesn't apply to recording how it went.
+	runCtx, cancel := context.WithTimeout(ctx, p.JobTimeout)
+	defer cancel()
+
+	err := p.safeRun(runCtx, job)
+	if err == nil {
+		err = p.Model.CompleteJob(ctx, job.JobID)
+		if err != nil {
+			p.Logger.Error("completing job failed", "job_id", job.JobID, "error", err.Error())
+		}
+		return
+	}
+
+	err = p.Model.FailJob(ctx, job, err.Error(), time.Now().Add(Backoff(job.Attempts)))
+	if err != nil {
+		p.Logger.Error("recording job failure failed", "job_id", job.JobID, "error", err.Error())
+		return
+	}
+
+	p.Logger.Warn("job failed", "job_id", job.JobID, "kind", job.Kind,
+		"attempt", job.Attempts, "status", job.Status)
+}
+
+// safeRun turns a panicking handler into an ordinary failure.
+func (p *Pool) safeRun(ctx context.Context, job *data.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	handler, found := p.handler(job.Kind)
+	if !found {
+		return fmt.Errorf("no handler registered for %q", job.Kind)
+	}
+	return handler(ctx, job)
+}
+
+// Backoff returns the delay before the next attempt of a job that has
+// failed attempts times, doubling from 10 seconds and capped at an hour.
+func Backoff(attempts int) time.Duration {
+	backoff := 10 * time.Second
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= time.Hour {
+			return time.Hour
+		}
+	}
+	return backoff
+}
@@ -0,0 +1,259 @@
+// Filename: internal/jobs/pool_test.go
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/mtechguy/test2/internal/data"
+)
+
+// testDSNVariable names the environment variable holding the DSN of a
+// migrated database the tests may write to, as in cmd/api.
+const testDSNVariable = "PRODUCT_REVIEW_TEST_DB_DSN"
+
+func newTestPool(model data.JobModel) *Pool {
+	return NewPool(model, slog.New(slog.NewTextHandler(io.Discard, nil)), 1, time.Second)
+}
+
+// newTestModel returns a model on the test database, skipping the test
+// when there is none.
+func newTestModel(t *testing.T) data.JobModel {
+	t.Helper()
+	dsn := os.Getenv(testDSNVariable)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNVariable)
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return data.JobModel{DB: db}
+}
+
+// testKind returns a job kind no other test run uses, and removes its jobs
+// when the test ends.
+func testKind(t *testing.T, model data.JobModel) string {
+	t.Helper()
+	kind := fmt.Sprintf("test.%s.%d", t.Name(), time.Now().UnixNano())
+	t.Cleanup(func() { model.DB.Exec(`DELETE FROM jobs WHERE kind = $1`, kind) })
+	return kind
+}
+
+func testContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{9, 2560 * time.Second},
+		{10, time.Hour},
+		{100, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestSafeRun(t *testing.T) {
+	failure := errors.New("no stock data")
+	tests := []struct {
+		name    string
+		kind    string
+		handler HandlerFunc
+		want    string
+	}{
+		{name: "success", kind: "ok", handler: func(context.Context, *data.Job) error { return nil }},
+		{name: "error", kind: "fails", handler: func(context.Context, *data.Job) error { return failure }, want: "no stock data"},
+		{name: "panic", kind: "panics", handler: func(context.Context, *data.Job) error { panic("boom") }, want: "panic: boom"},
+		{name: "no handler", kind: "unknown", want: `no handler registered for "unknown"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPool(data.JobModel{})
+			if tt.handler != nil {
+				p.Register(tt.kind, tt.handler)
+			}
+
+			err := p.safeRun(context.Background(), &data.Job{JobID: 1, Kind: tt.kind})
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("error = %v, want none", err)
+				}
+			} else if err == nil || err.Error() != tt.want {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestPoolWithDatabase runs a job that fails until its last attempt: each
+// failure puts it back with backoff, and the last attempt completes it.
+func TestPoolWithDatabase(t *testing.T) {
+	model := newTestModel(t)
+	kind := testKind(t, model)
+	ctx := testContext(t)
+
+	const maxAttempts = 3
+	runs := 0
+	p := newTestPool(model)
+	p.Register(kind, func(ctx context.Context, job *data.Job) error {
+		runs++
+		if job.Attempts < maxAttempts {
+			return fmt.Errorf("attempt %d failed", job.Attempts)
+		}
+		return nil
+	})
+
+	_, err := Enqueue(ctx, model, kind, map[string]int{"n": 1}, Options{MaxAttempts: maxAttempts})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// stored reads back what a run recorded.
+	stored := func(id int64) (status string, runAt time.Time, lastError sql.NullString) {
+		t.Helper()
+		err := model.DB.QueryRowContext(ctx, `SELECT status, run_at, last_error FROM jobs WHERE job_id = $1`, id).
+			Scan(&status, &runAt, &lastError)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return status, runAt, lastError
+	}
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		job, err := model.ClaimJob(ctx, p.kinds())
+		if err != nil {
+			t.Fatalf("attempt %d: %v", attempt, err)
+		}
+		if job.Kind != kind || job.Attempts != attempt || job.Status != data.JobRunning {
+			t.Fatalf("attempt %d: claimed %+v", attempt, job)
+		}
+		if _, err := model.ClaimJob(ctx, p.kinds()); !errors.Is(err, data.ErrRecordNotFound) {
+			t.Fatalf("attempt %d: claimed a running job again (%v)", attempt, err)
+		}
+
+		start := time.Now()
+		p.run(ctx, job)
+
+		status, runAt, lastError := stored(job.JobID)
+		if attempt == maxAttempts {
+			if status != data.JobCompleted || lastError.Valid {
+				t.Errorf("status = %s, last_error = %v after the last attempt, want %s", status, lastError, data.JobCompleted)
+			}
+			break
+		}
+
+		if status != data.JobPending || lastError.String != fmt.Sprintf("attempt %d failed", attempt) {
+			t.Fatalf("attempt %d: status = %s, last_error = %v", attempt, status, lastError)
+		}
+		if backoff, want := runAt.Sub(start), Backoff(attempt); backoff < want-time.Second || backoff > want+time.Second {
+			t.Errorf("attempt %d: next run in %s, want %s", attempt, backoff, want)
+		}
+		if _, err := model.ClaimJob(ctx, p.kinds()); !errors.Is(err, data.ErrRecordNotFound) {
+			t.Fatalf("attempt %d: the job was due again before its backoff ran out (%v)", attempt, err)
+		}
+
+		// Skip the wait.
+		if _, err := model.DB.ExecContext(ctx, `UPDATE jobs SET run_at = NOW() WHERE job_id = $1`, job.JobID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if runs != maxAttempts {
+		t.Errorf("handler ran %d times, want %d", runs, maxAttempts)
+	}
+}
+
+// TestEnqueueRecomputeRatingWithDatabase checks that recounts of a product
+// are deduplicated while one is waiting, but not while one is running.
+func TestEnqueueRecomputeRatingWithDatabase(t *testing.T) {
+	model := newTestModel(t)
+	ctx := testContext(t)
+
+	// A product id no real product has, so no worker picks the jobs up.
+	productID := -time.Now().UnixNano()
+	key := fmt.Sprintf("%s:%d", KindRecomputeRating, productID)
+	t.Cleanup(func() { model.DB.Exec(`DELETE FROM jobs WHERE unique_key = $1`, key) })
+
+	// Pushed out of reach of any worker sharing the test database.
+	park := func(id int64) {
+		t.Helper()
+		_, err := model.DB.ExecContext(ctx, `UPDATE jobs SET run_at = NOW() + INTERVAL '1 day' WHERE job_id = $1`, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := func(status string) int {
+		t.Helper()
+		var n int
+		err := model.DB.QueryRowContext(ctx, `SELECT count(*) FROM jobs WHERE unique_key = $1 AND status = $2`, key, status).Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	first, err := EnqueueRecomputeRating(ctx, model, productID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	park(first.JobID)
+
+	// A second recount while the first is waiting is skipped.
+	second, err := EnqueueRecomputeRating(ctx, model, productID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.JobID != 0 || count(data.JobPending) != 1 {
+		t.Fatalf("queued a second waiting recount (job %d)", second.JobID)
+	}
+
+	// Once the first is running, a change it may have missed queues another.
+	_, err = model.DB.ExecContext(ctx, `UPDATE jobs SET status = 'running', locked_at = NOW(), attempts = 1 WHERE job_id = $1`, first.JobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := EnqueueRecomputeRating(ctx, model, productID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.JobID == 0 {
+		t.Fatal("a recount requested while one was running was dropped")
+	}
+	park(third.JobID)
+
+	// The running one failing doesn't put it back next to the waiting one.
+	first.Status = data.JobRunning
+	if err := model.FailJob(ctx, first, "failed", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if first.Status != data.JobFailed {
+		t.Errorf("superseded job status = %s, want %s", first.Status, data.JobFailed)
+	}
+	if count(data.JobPending) != 1 {
+		t.Errorf("%d recounts waiting, want 1", count(data.JobPending))
+	}
+}
@@ -0,0 +1,329 @@
+// Filename: internal/jsonpatch/jsonpatch.go
+
+// Package jsonpatch applies JSON Merge Patch (RFC 7386) and JSON Patch
+// (RFC 6902) documents to JSON values.
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrTestFailed is returned when a "test" operation does not match.
+	ErrTestFailed = errors.New("test operation failed")
+	// ErrInvalidPatch is returned for patch documents that are malformed.
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrPathNotFound is returned when an operation refers to a location
+	// that does not exist.
+	ErrPathNotFound = errors.New("path not found")
+)
+
+// MergePatch applies an RFC 7386 merge patch to target. Members set to null
+// in the patch are removed from the target.
+func MergePatch(target []byte, patch []byte) ([]byte, error) {
+	var targetValue, patchValue any
+	err := json.Unmarshal(target, &targetValue)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(patch, &patchValue)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPatch, err.Error())
+	}
+
+	return json.Marshal(mergeValue(targetValue, patchValue))
+}
+
+func mergeValue(target any, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = make(map[string]any)
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergeValue(targetObject[key], value)
+	}
+	return targetObject
+}
+
+// Operation is a single RFC 6902 operation. Value is empty when the
+// operation has none; a "value": null member decodes as the literal null,
+// which is a value like any other.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Apply applies an RFC 6902 patch to document. The operations are applied
+// in order and the whole patch fails if any of them does.
+func Apply(document []byte, patch []byte) ([]byte, error) {
+	var ops []Operation
+	err := json.Unmarshal(patch, &ops)
+	if err != nil {
+		return nil, fmt.Errorf("%w: the patch must be an array of operations", ErrInvalidPatch)
+	}
+
+	var doc any
+	err = json.Unmarshal(document, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		doc, err = applyOperation(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	return json.Marshal(doc)
+}
+
+func applyOperation(doc any, op Operation) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	value := func() (any, error) {
+		if len(op.Value) == 0 {
+			return nil, fmt.Errorf("%w: value is required", ErrInvalidPatch)
+		}
+		var v any
+		err := json.Unmarshal(op.Value, &v)
+		return v, err
+	}
+
+	switch op.Op {
+	case "add":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "remove":
+		doc, _, err = remove(doc, path)
+		return doc, err
+	case "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		doc, _, err = remove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		var v any
+		if op.Op == "move" {
+			if len(path) > len(from) && reflect.DeepEqual(path[:len(from)], from) {
+				return nil, fmt.Errorf("%w: cannot move a value into itself", ErrInvalidPatch)
+			}
+			doc, v, err = remove(doc, from)
+		} else {
+			v, err = get(doc, from)
+			v = deepCopy(v)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "test":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		current, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, v) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+	}
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into its reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: path %q must start with /", ErrInvalidPatch, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		token = strings.ReplaceAll(token, "~1", "/")
+		tokens[i] = strings.ReplaceAll(token, "~0", "~")
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("%w: %q is not an array index", ErrPathNotFound, token)
+	}
+	if i > length || (!allowEnd && i == length) {
+		return 0, fmt.Errorf("%w: index %d is out of range", ErrPathNotFound, i)
+	}
+	return i, nil
+}
+
+func get(doc any, path []string) (any, error) {
+	current := doc
+	for _, token := range path {
+		switch container := current.(type) {
+		case map[string]any:
+			v, found := container[token]
+			if !found {
+				return nil, ErrPathNotFound
+			}
+			current = v
+		case []any:
+			i, err := arrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			current = container[i]
+		default:
+			return nil, ErrPathNotFound
+		}
+	}
+	return current, nil
+}
+
+// add sets the value at path and returns the (possibly new) document.
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]any:
+		container[last] = value
+		return doc, nil
+	case []any:
+		i, err := arrayIndex(last, len(container), true)
+		if err != nil {
+			return nil, err
+		}
+		grown := append(container[:i:i], append([]any{value}, container[i:]...)...)
+		return replaceContainer(doc, path[:len(path)-1], grown)
+	default:
+		return nil, ErrPathNotFound
+	}
+}
+
+// remove deletes the value at path and returns the new document along with
+// the removed value.
+func remove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	last := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]any:
+		v, found := container[last]
+		if !found {
+			return nil, nil, ErrPathNotFound
+		}
+		delete(container, last)
+		return doc, v, nil
+	case []any:
+		i, err := arrayIndex(last, len(container), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := container[i]
+		shrunk := append(container[:i:i], container[i+1:]...)
+		doc, err = replaceContainer(doc, path[:len(path)-1], shrunk)
+		return doc, v, err
+	default:
+		return nil, nil, ErrPathNotFound
+	}
+}
+
+// replaceContainer swaps the array at path for a resized copy, since Go
+// slices can't grow or shrink in place inside their parent.
+func replaceContainer(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]any:
+		container[last] = value
+	case []any:
+		i, err := arrayIndex(last, len(container), false)
+		if err != nil {
+			return nil, err
+		}
+		container[i] = value
+	}
+	return doc, nil
+}
+
+func deepCopy(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(value))
+		for key, v := range value {
+			copied[key] = deepCopy(v)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(value))
+		for i, v := range value {
+			copied[i] = deepCopy(v)
+		}
+		return copied
+	default:
+		return value
+	}
+}
@@ -0,0 +1,311 @@
+// Filename: internal/jsonpatch/jsonpatch_test.go
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// equalJSON reports whether a and b hold the same JSON value, whatever the
+// order of their members.
+func equalJSON(t *testing.T, a []byte, b string) bool {
+	t.Helper()
+	var av, bv any
+	if err := json.Unmarshal(a, &av); err != nil {
+		t.Fatalf("unmarshalling %s: %v", a, err)
+	}
+	if err := json.Unmarshal([]byte(b), &bv); err != nil {
+		t.Fatalf("unmarshalling %s: %v", b, err)
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		patch    string
+		want     string
+		wantErr  error // nil when the patch applies
+	}{
+		// The examples of RFC 6902 appendix A.
+		{
+			name:     "A.1 adding an object member",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"add","path":"/baz","value":"qux"}]`,
+			want:     `{"baz":"qux","foo":"bar"}`,
+		},
+		{
+			name:     "A.2 adding an array element",
+			document: `{"foo":["bar","baz"]}`,
+			patch:    `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			want:     `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			name:     "A.3 removing an object member",
+			document: `{"baz":"qux","foo":"bar"}`,
+			patch:    `[{"op":"remove","path":"/baz"}]`,
+			want:     `{"foo":"bar"}`,
+		},
+		{
+			name:     "A.4 removing an array element",
+			document: `{"foo":["bar","qux","baz"]}`,
+			patch:    `[{"op":"remove","path":"/foo/1"}]`,
+			want:     `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:     "A.5 replacing a value",
+			document: `{"baz":"qux","foo":"bar"}`,
+			patch:    `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			want:     `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			name:     "A.6 moving a value",
+			document: `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			patch:    `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			want:     `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			name:     "A.7 moving an array element",
+			document: `{"foo":["all","grass","cows","eat"]}`,
+			patch:    `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			want:     `{"foo":["all","cows","eat","grass"]}`,
+		},
+		{
+			name:     "A.8 testing a value: success",
+			document: `{"baz":"qux","foo":["a",2,"c"]}`,
+			patch:    `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			want:     `{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{
+			name:     "A.9 testing a value: error",
+			document: `{"baz":"qux"}`,
+			patch:    `[{"op":"test","path":"/baz","value":"bar"}]`,
+			wantErr:  ErrTestFailed,
+		},
+		{
+			name:     "A.10 adding a nested member object",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`,
+			want:     `{"foo":"bar","child":{"grandchild":{}}}`,
+		},
+		{
+			name:     "A.11 ignoring unrecognized elements",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"add","path":"/baz","value":"qux","xyz":123}]`,
+			want:     `{"foo":"bar","baz":"qux"}`,
+		},
+		{
+			name:     "A.12 adding to a nonexistent target",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			wantErr:  ErrPathNotFound,
+		},
+		{
+			name:     "A.14 ~ escape ordering",
+			document: `{"/":9,"~1":10}`,
+			patch:    `[{"op":"test","path":"/~01","value":10}]`,
+			want:     `{"/":9,"~1":10}`,
+		},
+		{
+			name:     "A.15 comparing strings and numbers",
+			document: `{"/":9,"~1":10}`,
+			patch:    `[{"op":"test","path":"/~01","value":"10"}]`,
+			wantErr:  ErrTestFailed,
+		},
+		{
+			name:     "A.16 adding an array value",
+			document: `{"foo":["bar"]}`,
+			patch:    `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			want:     `{"foo":["bar",["abc","def"]]}`,
+		},
+
+		// null is a value, not a missing one.
+		{
+			name:     "adding null",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"add","path":"/baz","value":null}]`,
+			want:     `{"foo":"bar","baz":null}`,
+		},
+		{
+			name:     "replacing with null",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"replace","path":"/foo","value":null}]`,
+			want:     `{"foo":null}`,
+		},
+		{
+			name:     "testing for null",
+			document: `{"foo":null}`,
+			patch:    `[{"op":"test","path":"/foo","value":null}]`,
+			want:     `{"foo":null}`,
+		},
+		{
+			name:     "testing a value against null",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"test","path":"/foo","value":null}]`,
+			wantErr:  ErrTestFailed,
+		},
+		{
+			name:     "adding without a value",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"add","path":"/baz"}]`,
+			wantErr:  ErrInvalidPatch,
+		},
+
+		// Malformed patches and paths.
+		{
+			name:     "a patch that isn't an array",
+			document: `{"foo":"bar"}`,
+			patch:    `{"op":"remove","path":"/foo"}`,
+			wantErr:  ErrInvalidPatch,
+		},
+		{
+			name:     "an unknown op",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"delete","path":"/foo"}]`,
+			wantErr:  ErrInvalidPatch,
+		},
+		{
+			name:     "a path without a leading slash",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"remove","path":"foo"}]`,
+			wantErr:  ErrInvalidPatch,
+		},
+		{
+			name:     "removing a missing member",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"remove","path":"/baz"}]`,
+			wantErr:  ErrPathNotFound,
+		},
+		{
+			name:     "replacing a missing member",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"replace","path":"/baz","value":1}]`,
+			wantErr:  ErrPathNotFound,
+		},
+		{
+			name:     "an index with a leading zero",
+			document: `{"foo":["a","b"]}`,
+			patch:    `[{"op":"remove","path":"/foo/01"}]`,
+			wantErr:  ErrPathNotFound,
+		},
+		{
+			name:     "an index past the end",
+			document: `{"foo":["a","b"]}`,
+			patch:    `[{"op":"add","path":"/foo/3","value":"c"}]`,
+			wantErr:  ErrPathNotFound,
+		},
+		{
+			name:     "moving a value into itself",
+			document: `{"foo":{"bar":1}}`,
+			patch:    `[{"op":"move","from":"/foo","path":"/foo/bar/baz"}]`,
+			wantErr:  ErrInvalidPatch,
+		},
+		{
+			name:     "copying a value",
+			document: `{"foo":{"bar":1}}`,
+			patch:    `[{"op":"copy","from":"/foo","path":"/baz"},{"op":"replace","path":"/baz/bar","value":2}]`,
+			want:     `{"foo":{"bar":1},"baz":{"bar":2}}`,
+		},
+		{
+			name:     "a failing operation undoes the patch",
+			document: `{"foo":"bar"}`,
+			patch:    `[{"op":"add","path":"/baz","value":1},{"op":"test","path":"/foo","value":"qux"}]`,
+			wantErr:  ErrTestFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.document), []byte(tt.patch))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				if got != nil {
+					t.Errorf("got %s along with the error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalJSON(t, got, tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestApplyDuplicateOp covers RFC 6902 A.13, a patch whose operation has
+// two ops. It must fail, whichever of them is used.
+func TestApplyDuplicateOp(t *testing.T) {
+	_, err := Apply([]byte(`{"foo":"bar"}`), []byte(`[{"op":"add","path":"/baz","value":"qux","op":"remove"}]`))
+	if err == nil {
+		t.Error("no error")
+	}
+}
+
+func TestOperationValue(t *testing.T) {
+	tests := []struct {
+		operation string
+		want      string // the raw value, empty when there is none
+	}{
+		{`{"op":"add","path":"/a","value":1}`, `1`},
+		{`{"op":"add","path":"/a","value":null}`, `null`},
+		{`{"op":"remove","path":"/a"}`, ``},
+	}
+	for _, tt := range tests {
+		var op Operation
+		if err := json.Unmarshal([]byte(tt.operation), &op); err != nil {
+			t.Fatal(err)
+		}
+		if string(op.Value) != tt.want {
+			t.Errorf("value of %s = %q, want %q", tt.operation, op.Value, tt.want)
+		}
+	}
+}
+
+// TestMergePatch covers the examples of RFC 7386 appendix A.
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		target string
+		patch  string
+		want   string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		got, err := MergePatch([]byte(tt.target), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("MergePatch(%s, %s): %v", tt.target, tt.patch, err)
+			continue
+		}
+		if !equalJSON(t, got, tt.want) {
+			t.Errorf("MergePatch(%s, %s) = %s, want %s", tt.target, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestMergePatchInvalid(t *testing.T) {
+	_, err := MergePatch([]byte(`{"a":"b"}`), []byte(`{"a":`))
+	if !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("error = %v, want ErrInvalidPatch", err)
+	}
+}
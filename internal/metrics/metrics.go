@@ -0,0 +1,311 @@
+// Filename: internal/metrics/metrics.go
+
+// Package metrics collects counters, gauges and histograms and serves them
+// in the Prometheus text exposition format, so any Prometheus compatible
+// scraper can read them without a client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the latency
+// histograms, from 5ms to 10s.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds the metrics of a process.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+// metric is one named metric with all its series.
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// Write writes every metric in the text exposition format, in the order
+// they were registered.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves the metrics to scrapers.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.Write(w)
+	})
+}
+
+// desc is what every metric has: a name, help text and label names.
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d desc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.kind)
+}
+
+// series are the values of a metric for each combination of label values,
+// created on first use.
+type series[T any] struct {
+	mu     sync.Mutex
+	values map[string]*labelled[T]
+}
+
+type labelled[T any] struct {
+	labels []string
+	value  T
+}
+
+func (s *series[T]) with(labels []string, n int, update func(*T)) {
+	if len(labels) != n {
+		panic(fmt.Sprintf("metrics: got %d label values, want %d", len(labels), n))
+	}
+	key := strings.Join(labels, "\xff")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values == nil {
+		s.values = make(map[string]*labelled[T])
+	}
+	v, ok := s.values[key]
+	if !ok {
+		v = &labelled[T]{labels: append([]string(nil), labels...)}
+		s.values[key] = v
+	}
+	update(&v.value)
+}
+
+// each calls fn for every series, ordered by label values so the output
+// is stable between scrapes.
+func (s *series[T]) each(fn func(labels []string, value T)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fn(s.values[key].labels, s.values[key].value)
+	}
+}
+
+// CounterVec is a counter, which only goes up, for each combination of
+// label values.
+type CounterVec struct {
+	desc
+	series series[float64]
+}
+
+// Counter registers a counter with the given label names.
+func (r *Registry) Counter(name string, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: desc{name: name, help: help, kind: "counter", labels: labels}}
+	r.register(c)
+	return c
+}
+
+// Inc adds one to the counter with the given label values.
+func (c *CounterVec) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Add adds v, which must not be negative, to the counter with the given
+// label values.
+func (c *CounterVec) Add(v float64, labels ...string) {
+	c.series.with(labels, len(c.labels), func(value *float64) { *value += v })
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.writeHeader(w)
+	c.series.each(func(labels []string, value float64) {
+		writeSample(w, c.name, c.labels, labels, "", "", value)
+	})
+}
+
+// GaugeVec is a gauge, which goes up and down, for each combination of
+// label values.
+type GaugeVec struct {
+	desc
+	series series[float64]
+}
+
+// Gauge registers a gauge with the given label names.
+func (r *Registry) Gauge(name string, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{desc: desc{name: name, help: help, kind: "gauge", labels: labels}}
+	r.register(g)
+	return g
+}
+
+// Add adds v, possibly negative, to the gauge with the given label values.
+func (g *GaugeVec) Add(v float64, labels ...string) {
+	g.series.with(labels, len(g.labels), func(value *float64) { *value += v })
+}
+
+// Set sets the gauge with the given label values.
+func (g *GaugeVec) Set(v float64, labels ...string) {
+	g.series.with(labels, len(g.labels), func(value *float64) { *value = v })
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	g.series.each(func(labels []string, value float64) {
+		writeSample(w, g.name, g.labels, labels, "", "", value)
+	})
+}
+
+// funcMetric is a metric without labels whose value is read when the
+// metrics are scraped, for values kept elsewhere such as sql.DB.Stats.
+type funcMetric struct {
+	desc
+	fn func() float64
+}
+
+// GaugeFunc registers a gauge whose value is fn's result at scrape time.
+func (r *Registry) GaugeFunc(name string, help string, fn func() float64) {
+	r.register(&funcMetric{desc: desc{name: name, help: help, kind: "gauge"}, fn: fn})
+}
+
+// CounterFunc registers a counter whose value is fn's result at scrape
+// time. fn must never return less than it did before.
+func (r *Registry) CounterFunc(name string, help string, fn func() float64) {
+	r.register(&funcMetric{desc: desc{name: name, help: help, kind: "counter"}, fn: fn})
+}
+
+func (f *funcMetric) write(w *bufio.Writer) {
+	f.writeHeader(w)
+	writeSample(w, f.name, nil, nil, "", "", f.fn())
+}
+
+// HistogramVec counts observations, such as latencies, in buckets for each
+// combination of label values.
+type HistogramVec struct {
+	desc
+	buckets []float64
+	series  series[histogram]
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// Histogram registers a histogram with the given bucket upper bounds, in
+// increasing order, and label names.
+func (r *Registry) Histogram(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{desc: desc{name: name, help: help, kind: "histogram", labels: labels}, buckets: buckets}
+	r.register(h)
+	return h
+}
+
+// Observe records v in the histogram with the given label values.
+func (h *HistogramVec) Observe(v float64, labels ...string) {
+	h.series.with(labels, len(h.labels), func(value *histogram) {
+		if value.counts == nil {
+			value.counts = make([]uint64, len(h.buckets))
+		}
+		i := sort.SearchFloat64s(h.buckets, v)
+		if i < len(h.buckets) {
+			value.counts[i]++
+		}
+		value.count++
+		value.sum += v
+	})
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.writeHeader(w)
+	h.series.each(func(labels []string, value histogram) {
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += value.counts[i]
+			writeSample(w, h.name+"_bucket", h.labels, labels, "le", formatFloat(bound), float64(cumulative))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, labels, "le", "+Inf", float64(value.count))
+		writeSample(w, h.name+"_sum", h.labels, labels, "", "", value.sum)
+		writeSample(w, h.name+"_count", h.labels, labels, "", "", float64(value.count))
+	})
+}
+
+// writeSample writes one line, name{label="value",...} value, with an
+// extra label (le for histogram buckets) when extraName is set.
+func writeSample(w *bufio.Writer, name string, labelNames []string, labelValues []string, extraName string, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(labelNames) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, label := range labelNames {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, label, escapeLabel(labelValues[i]))
+		}
+		if extraName != "" {
+			if len(labelNames) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, extraName, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
@@ -0,0 +1,40 @@
+// Filename: internal/metrics/sql.go
+package metrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/mtechguy/test2/internal/sqlhook"
+)
+
+// QueryObserver is told how long each statement sent to the database took.
+// operation is its first keyword: select, insert, update, delete, with or
+// other.
+type QueryObserver func(operation string, d time.Duration)
+
+// StatementHook times every statement for observe, from when it is sent
+// until its rows have been read. Use it with sqlhook.Connector.
+func StatementHook(observe QueryObserver) sqlhook.Hook {
+	return func(ctx context.Context, stmt sqlhook.Statement) (context.Context, func(int64, error)) {
+		start := time.Now()
+		return ctx, func(int64, error) {
+			observe(operation(stmt.Query), time.Since(start))
+		}
+	}
+}
+
+// operation names the kind of statement by its first keyword, keeping the
+// label's values few.
+func operation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "other"
+	}
+	switch keyword := strings.ToLower(fields[0]); keyword {
+	case "select", "insert", "update", "delete", "with":
+		return keyword
+	}
+	return "other"
+}
@@ -0,0 +1,221 @@
+// Filename: internal/sqlhook/sqlhook.go
+
+// Package sqlhook wraps a database/sql connector so hooks are told about
+// every statement run through it, whichever model or transaction runs it.
+// The metrics and the traces of the statements are both recorded by hooks.
+package sqlhook
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"reflect"
+)
+
+// Statement is a statement sent to the database.
+type Statement struct {
+	Query string
+	Exec  bool // run for the rows it affects rather than the rows it returns
+}
+
+// Hook is called as a statement starts. It returns the context to run the
+// statement with, and a function, which may be nil, called once the
+// statement has finished: when the rows of a query are closed, or when an
+// exec returns. rows is the number of rows the query returned or the exec
+// affected, err the error the statement failed with.
+//
+// A statement the driver declines with driver.ErrSkip, which database/sql
+// then prepares instead, isn't finished.
+type Hook func(ctx context.Context, stmt Statement) (context.Context, func(rows int64, err error))
+
+// Connector wraps c so every query and exec run through it goes through
+// hooks, in order. Use it with sql.OpenDB.
+func Connector(c driver.Connector, hooks ...Hook) driver.Connector {
+	return &connector{Connector: c, hooks: hooks}
+}
+
+type connector struct {
+	driver.Connector
+	hooks []Hook
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &hookedConn{Conn: conn, hooks: c.hooks}, nil
+}
+
+// start runs the hooks for stmt. The function returned finishes them in
+// reverse order.
+func start(ctx context.Context, hooks []Hook, stmt Statement) (context.Context, func(int64, error)) {
+	finishes := make([]func(int64, error), 0, len(hooks))
+	for _, hook := range hooks {
+		var finish func(int64, error)
+		ctx, finish = hook(ctx, stmt)
+		if finish != nil {
+			finishes = append(finishes, finish)
+		}
+	}
+	return ctx, func(rows int64, err error) {
+		for i := len(finishes) - 1; i >= 0; i-- {
+			finishes[i](rows, err)
+		}
+	}
+}
+
+// hookedConn passes everything on to the driver's connection, running the
+// hooks for queries on the way. The optional interfaces database/sql looks
+// for are all implemented, falling back to what database/sql would do when
+// the driver lacks them.
+type hookedConn struct {
+	driver.Conn
+	hooks []Hook
+}
+
+func (c *hookedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, finish := start(ctx, c.hooks, Statement{Query: query})
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err == driver.ErrSkip {
+		return nil, err
+	}
+	if err != nil {
+		finish(0, err)
+		return nil, err
+	}
+	// The statement finishes when the rows are closed, after they have all
+	// been read.
+	return &hookedRows{Rows: rows, finish: finish}, nil
+}
+
+func (c *hookedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, finish := start(ctx, c.hooks, Statement{Query: query, Exec: true})
+	result, err := execer.ExecContext(ctx, query, args)
+	if err == driver.ErrSkip {
+		return result, err
+	}
+	var affected int64
+	if err == nil {
+		affected, _ = result.RowsAffected()
+	}
+	finish(affected, err)
+	return result, err
+}
+
+func (c *hookedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *hookedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *hookedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *hookedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *hookedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *hookedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// hookedRows counts the rows read, to finish their statement with once
+// they are closed. The optional column type interfaces are passed on to
+// the driver's rows.
+type hookedRows struct {
+	driver.Rows
+	finish func(int64, error)
+	read   int64
+	err    error
+}
+
+func (r *hookedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err == nil {
+		r.read++
+	} else if err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return err
+}
+
+func (r *hookedRows) Close() error {
+	err := r.Rows.Close()
+	if r.finish != nil {
+		if r.err == nil {
+			r.err = err
+		}
+		r.finish(r.read, r.err)
+		r.finish = nil
+	}
+	return err
+}
+
+func (r *hookedRows) ColumnTypeScanType(index int) reflect.Type {
+	if rows, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return rows.ColumnTypeScanType(index)
+	}
+	return reflect.TypeFor[any]()
+}
+
+func (r *hookedRows) ColumnTypeDatabaseTypeName(index int) string {
+	if rows, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return rows.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *hookedRows) ColumnTypeLength(index int) (int64, bool) {
+	if rows, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return rows.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *hookedRows) ColumnTypeNullable(index int) (bool, bool) {
+	if rows, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+		return rows.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *hookedRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if rows, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return rows.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
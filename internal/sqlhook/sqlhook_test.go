@@ -0,0 +1,161 @@
+// Filename: internal/sqlhook/sqlhook_test.go
+package sqlhook
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"testing"
+)
+
+// fakeConnector connects to a database whose queries return n rows, n
+// being the number in the query, and whose execs affect as many. A query
+// of "fail" fails.
+type fakeConnector struct{}
+
+func (fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{}, nil }
+func (fakeConnector) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{}
+
+var errFake = errors.New("fake failure")
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	var n int
+	if _, err := fmt.Sscan(query, &n); err != nil {
+		return nil, errFake
+	}
+	return &fakeRows{left: n}, nil
+}
+
+func (fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	var n int64
+	if _, err := fmt.Sscan(query, &n); err != nil {
+		return nil, errFake
+	}
+	return driver.RowsAffected(n), nil
+}
+
+type fakeRows struct{ left int }
+
+func (r *fakeRows) Columns() []string { return []string{"n"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.left == 0 {
+		return io.EOF
+	}
+	r.left--
+	dest[0] = int64(r.left)
+	return nil
+}
+
+// finished is a statement as a hook saw it finish.
+type finished struct {
+	hook string
+	stmt Statement
+	rows int64
+	err  error
+}
+
+func TestHooks(t *testing.T) {
+	var calls []string
+	var done []finished
+	hook := func(name string) Hook {
+		return func(ctx context.Context, stmt Statement) (context.Context, func(int64, error)) {
+			calls = append(calls, "start "+name)
+			return ctx, func(rows int64, err error) {
+				calls = append(calls, "finish "+name)
+				done = append(done, finished{name, stmt, rows, err})
+			}
+		}
+	}
+	skipped := func(ctx context.Context, stmt Statement) (context.Context, func(int64, error)) {
+		return ctx, nil
+	}
+
+	db := sql.OpenDB(Connector(fakeConnector{}, hook("a"), skipped, hook("b")))
+	defer db.Close()
+
+	tests := []struct {
+		name string
+		run  func() error
+		want finished
+	}{
+		{
+			name: "query",
+			run: func() error {
+				rows, err := db.Query("3")
+				if err != nil {
+					return err
+				}
+				defer rows.Close()
+				for rows.Next() {
+					// The statement finishes only once the rows are read.
+					if len(done) != 0 {
+						t.Error("finished before the rows were read")
+					}
+				}
+				return rows.Err()
+			},
+			want: finished{stmt: Statement{Query: "3"}, rows: 3},
+		},
+		{
+			name: "exec",
+			run: func() error {
+				_, err := db.Exec("5")
+				return err
+			},
+			want: finished{stmt: Statement{Query: "5", Exec: true}, rows: 5},
+		},
+		{
+			name: "failed query",
+			run: func() error {
+				_, err := db.Query("fail")
+				if !errors.Is(err, errFake) {
+					return fmt.Errorf("error = %v, want %v", err, errFake)
+				}
+				return nil
+			},
+			want: finished{stmt: Statement{Query: "fail"}, err: errFake},
+		},
+		{
+			name: "failed exec",
+			run: func() error {
+				_, err := db.Exec("fail")
+				if !errors.Is(err, errFake) {
+					return fmt.Errorf("error = %v, want %v", err, errFake)
+				}
+				return nil
+			},
+			want: finished{stmt: Statement{Query: "fail", Exec: true}, err: errFake},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls, done = nil, nil
+			if err := tt.run(); err != nil {
+				t.Fatal(err)
+			}
+
+			// The hooks finish in the reverse of the order they started.
+			if want := []string{"start a", "start b", "finish b", "finish a"}; !slices.Equal(calls, want) {
+				t.Errorf("calls = %v, want %v", calls, want)
+			}
+			for _, got := range done {
+				want := tt.want
+				want.hook = got.hook
+				if got != want {
+					t.Errorf("hook %s finished %+v, want %+v", got.hook, got, want)
+				}
+			}
+		})
+	}
+}
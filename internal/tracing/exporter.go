@@ -0,0 +1,87 @@
+// Filename: internal/tracing/exporter.go
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Exporter sends finished spans somewhere they can be looked at. Export is
+// called as each span ends, from many goroutines at once.
+type Exporter interface {
+	Export(span *SpanData) error
+	Close() error
+}
+
+// WriterExporter writes every span as a line of JSON, for local debugging:
+// point it at stdout or a file and follow a slow request span by span.
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterExporter returns an exporter writing to w. w belongs to the
+// caller, which closes it after the exporter.
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// spanJSON is how a span is written, with the field names of the
+// OpenTelemetry data model.
+type spanJSON struct {
+	TraceID      string         `json:"trace_id"`
+	SpanID       string         `json:"span_id"`
+	ParentSpanID string         `json:"parent_span_id,omitempty"`
+	Name         string         `json:"name"`
+	Kind         string         `json:"kind"`
+	StartTime    time.Time      `json:"start_time"`
+	EndTime      time.Time      `json:"end_time"`
+	DurationMS   float64        `json:"duration_ms"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	Status       statusJSON     `json:"status"`
+}
+
+type statusJSON struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func (e *WriterExporter) Export(span *SpanData) error {
+	out := spanJSON{
+		TraceID:    span.SpanContext.TraceID.String(),
+		SpanID:     span.SpanContext.SpanID.String(),
+		Name:       span.Name,
+		Kind:       span.Kind,
+		StartTime:  span.Start,
+		EndTime:    span.End,
+		DurationMS: float64(span.End.Sub(span.Start).Microseconds()) / 1000,
+		Status:     statusJSON{Code: span.Status, Message: span.StatusMessage},
+	}
+	if span.Parent.IsValid() {
+		out.ParentSpanID = span.Parent.String()
+	}
+	if len(span.Attributes) > 0 {
+		out.Attributes = make(map[string]any, len(span.Attributes))
+		for _, attr := range span.Attributes {
+			out.Attributes[attr.Key] = attr.Value
+		}
+	}
+
+	js, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	js = append(js, '\n')
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(js)
+	return err
+}
+
+// Close does nothing, every span is written as it is exported.
+func (e *WriterExporter) Close() error {
+	return nil
+}
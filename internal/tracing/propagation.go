@@ -0,0 +1,73 @@
+// Filename: internal/tracing/propagation.go
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TraceparentHeader carries the span context between services, as in the
+// W3C Trace Context recommendation.
+const TraceparentHeader = "traceparent"
+
+// ParseTraceparent reads a traceparent header value, e.g.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01. It returns false
+// when the value is malformed, in which case the header must be ignored.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || parts[0] == "ff" {
+		return SpanContext{}, false
+	}
+	// Version 00 has exactly four fields, later versions may add more.
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+
+	var sc SpanContext
+	var version, flags [1]byte
+	if !decodeHex(parts[0], version[:]) || !decodeHex(parts[1], sc.TraceID[:]) ||
+		!decodeHex(parts[2], sc.SpanID[:]) || !decodeHex(parts[3], flags[:]) || !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, true
+}
+
+// decodeHex decodes s, which must be lowercase hex of exactly len(dst)
+// bytes, into dst.
+func decodeHex(s string, dst []byte) bool {
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// Traceparent formats sc as a traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := 0
+	if sc.Sampled {
+		flags = 1
+	}
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, flags)
+}
+
+// Extract returns the span context propagated in the headers of a request,
+// which is invalid when there is none or it is malformed.
+func Extract(header http.Header) SpanContext {
+	sc, _ := ParseTraceparent(header.Get(TraceparentHeader))
+	return sc
+}
+
+// Inject propagates the span in ctx in the headers of an outgoing request,
+// so the receiver can continue the trace. It leaves header alone when ctx
+// has no span.
+func Inject(ctx context.Context, header http.Header) {
+	sc := FromContext(ctx).SpanContext()
+	if sc.IsValid() {
+		header.Set(TraceparentHeader, sc.Traceparent())
+	}
+}
@@ -0,0 +1,75 @@
+// Filename: internal/tracing/sql.go
+package tracing
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/mtechguy/test2/internal/sqlhook"
+)
+
+// StatementHook gives every statement run under a span a client span of
+// its own, named after the statement (e.g. "SELECT products") and carrying
+// the number of rows it returned or affected. Use it with
+// sqlhook.Connector.
+func StatementHook(ctx context.Context, stmt sqlhook.Statement) (context.Context, func(int64, error)) {
+	parent := FromContext(ctx)
+	ctx, span := startStatement(ctx, stmt.Query)
+	if span == nil {
+		return ctx, nil
+	}
+	return ctx, func(rows int64, err error) {
+		switch {
+		case err != nil:
+			span.SetError(err)
+		case stmt.Exec:
+			span.SetAttributes(Int64("db.rows_affected", rows))
+		default:
+			span.SetAttributes(Int64("db.rows_returned", rows))
+		}
+		span.End()
+		parent.addStatement(span.data.Name, rows)
+	}
+}
+
+// startStatement starts the client span of a SQL statement, under the span
+// in ctx.
+func startStatement(ctx context.Context, query string) (context.Context, *Span) {
+	if FromContext(ctx) == nil {
+		return ctx, nil
+	}
+	operation, table := statementName(query)
+	name := operation
+	if table != "" {
+		name += " " + table
+	}
+	attrs := []Attribute{
+		String("db.system", "postgresql"),
+		String("db.operation", operation),
+		String("db.statement", strings.Join(strings.Fields(query), " ")),
+	}
+	if table != "" {
+		attrs = append(attrs, String("db.sql.table", table))
+	}
+	return StartKind(ctx, name, KindClient, attrs...)
+}
+
+// tablePattern finds the table a statement works on: the first one after
+// FROM, INTO, UPDATE or JOIN.
+var tablePattern = regexp.MustCompile(`(?i)\b(?:from|into|update|join)\s+([a-z_][a-z0-9_.]*)`)
+
+// statementName returns the first keyword of query, e.g. SELECT, and the
+// table it works on when one can be found.
+func statementName(query string) (string, string) {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	operation := strings.ToUpper(fields[0])
+	var table string
+	if m := tablePattern.FindStringSubmatch(query); m != nil {
+		table = strings.ToLower(m[1])
+	}
+	return operation, table
+}
@@ -0,0 +1,263 @@
+// Filename: internal/tracing/tracing.go
+
+// Package tracing records spans shaped like OpenTelemetry's: the work done
+// for a request, the model methods it called and the SQL statements they
+// ran, each timed and tied together by a trace ID that is propagated in the
+// W3C traceparent header. Finished spans go to an Exporter.
+//
+// Spans are only created under a span already in the context, which the
+// HTTP middleware starts, so code running outside a request isn't traced.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace, all the spans of one request across services.
+type TraceID [16]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+// IsValid reports whether t is set; the all-zero ID is invalid.
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// IsValid reports whether s is set; the all-zero ID is invalid.
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext is what is propagated to other services about a span.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool // whether the spans of the trace are recorded
+}
+
+// IsValid reports whether both IDs are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Kinds of span, as in OpenTelemetry.
+const (
+	KindInternal = "internal"
+	KindServer   = "server"
+	KindClient   = "client"
+)
+
+// Status codes of a span, as in OpenTelemetry.
+const (
+	StatusUnset = "unset"
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// Attribute is a key and a string, integer, float or boolean value, or a
+// slice of strings.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+func String(key string, value string) Attribute { return Attribute{key, value} }
+func Int(key string, value int) Attribute       { return Attribute{key, int64(value)} }
+func Int64(key string, value int64) Attribute   { return Attribute{key, value} }
+func Bool(key string, value bool) Attribute     { return Attribute{key, value} }
+
+// SpanData is a finished span, as handed to the exporter.
+type SpanData struct {
+	Name          string
+	Kind          string
+	SpanContext   SpanContext
+	Parent        SpanID // invalid for the root span of a trace
+	Start         time.Time
+	End           time.Time
+	Attributes    []Attribute
+	Status        string
+	StatusMessage string
+}
+
+// Tracer starts root spans and exports them, and their descendants, once
+// they end.
+type Tracer struct {
+	exporter Exporter
+}
+
+// NewTracer returns a tracer exporting to exporter.
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// Span is a timed operation. All its methods are safe to call on a nil
+// Span, which is what Start returns when there is nothing to trace, so
+// callers never check.
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+
+	// Summary of the SQL statements run directly under the span, added to
+	// its attributes when it ends.
+	statements []string
+	rows       int64
+}
+
+type contextKey struct{}
+
+// StartRoot starts the span of a request received from a client. remote is
+// the span context the client propagated, if it is valid the new span
+// joins its trace and follows its sampling decision; otherwise a new trace
+// is started and recorded.
+func (t *Tracer) StartRoot(ctx context.Context, name string, kind string, remote SpanContext, attrs ...Attribute) (context.Context, *Span) {
+	sc := SpanContext{TraceID: remote.TraceID, SpanID: newSpanID(), Sampled: remote.Sampled}
+	var parent SpanID
+	if remote.IsValid() {
+		parent = remote.SpanID
+	} else {
+		sc.TraceID, sc.Sampled = newTraceID(), true
+	}
+	return t.start(ctx, name, kind, sc, parent, attrs)
+}
+
+// Start starts a span that is a child of the span in ctx. It returns ctx
+// unchanged and a nil span when ctx has no span.
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	return StartKind(ctx, name, KindInternal, attrs...)
+}
+
+// StartKind is Start for a span of a kind other than internal.
+func StartKind(ctx context.Context, name string, kind string, attrs ...Attribute) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	sc := SpanContext{TraceID: parent.data.SpanContext.TraceID, SpanID: newSpanID(), Sampled: parent.data.SpanContext.Sampled}
+	return parent.tracer.start(ctx, name, kind, sc, parent.data.SpanContext.SpanID, attrs)
+}
+
+func (t *Tracer) start(ctx context.Context, name string, kind string, sc SpanContext, parent SpanID, attrs []Attribute) (context.Context, *Span) {
+	span := &Span{tracer: t, data: SpanData{
+		Name:        name,
+		Kind:        kind,
+		SpanContext: sc,
+		Parent:      parent,
+		Start:       time.Now(),
+		Attributes:  attrs,
+		Status:      StatusUnset,
+	}}
+	return context.WithValue(ctx, contextKey{}, span), span
+}
+
+// FromContext returns the span in ctx, or nil when there is none.
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(contextKey{}).(*Span)
+	return span
+}
+
+// SpanContext returns the IDs of the span, to propagate it.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// SetName renames the span, e.g. once the route of a request is known.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Name = name
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes = append(s.data.Attributes, attrs...)
+}
+
+// SetError marks the span as failed with err. A nil err changes nothing.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.SetStatus(StatusError, err.Error())
+}
+
+// SetStatus sets the status of the span, message describing an error.
+func (s *Span) SetStatus(status string, message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Status, s.data.StatusMessage = status, message
+}
+
+// End finishes the span and exports it if its trace is sampled. Calls
+// after the first do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	if len(s.statements) > 0 {
+		s.data.Attributes = append(s.data.Attributes,
+			Attribute{"db.statements", s.statements}, Int64("db.rows", s.rows))
+	}
+	data := s.data
+	s.mu.Unlock()
+
+	if data.SpanContext.Sampled {
+		_ = s.tracer.exporter.Export(&data)
+	}
+}
+
+// addStatement records on s, the parent of a statement's span, that the
+// statement ran and how many rows it returned or affected.
+func (s *Span) addStatement(name string, rows int64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statements = append(s.statements, name)
+	s.rows += rows
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
@@ -0,0 +1,252 @@
+// Filename: internal/validator/rules.go
+package validator
+
+import (
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rule checks a single value, returning the error when the value is not
+// acceptable and nil otherwise. Apart from Required, rules let empty
+// strings and empty slices through, so optional fields can still have a
+// format.
+type Rule func(value any) *Error
+
+// Field runs every rule against value and records each failure under key.
+func (v *Validator) Field(key string, value any, rules ...Rule) {
+	for _, rule := range rules {
+		if e := rule(value); e != nil {
+			v.add(key, *e)
+		}
+	}
+}
+
+// fail is what a rule returns when the value is not acceptable.
+func fail(code string, params ...any) *Error {
+	e := NewError(code, params...)
+	return &e
+}
+
+// isEmpty reports whether value is an empty string or an empty slice.
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return value.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return value.IsNil()
+	}
+	return false
+}
+
+// indirect follows pointers, so rules see what a pointer field holds.
+func indirect(value any) reflect.Value {
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	return rv
+}
+
+// number returns value as a float64 if it is of a numeric kind.
+func number(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	}
+	return 0, false
+}
+
+// length is the size of value: characters for strings, not bytes, and
+// elements for slices.
+func length(value reflect.Value) (int, bool) {
+	switch value.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(value.String()), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return value.Len(), true
+	}
+	return 0, false
+}
+
+// Required fails on zero values and on strings that are only whitespace.
+func Required() Rule {
+	return func(value any) *Error {
+		rv := indirect(value)
+		if !rv.IsValid() || rv.IsZero() || isEmpty(rv) {
+			return fail("required")
+		}
+		if rv.Kind() == reflect.String && strings.TrimSpace(rv.String()) == "" {
+			return fail("required")
+		}
+		return nil
+	}
+}
+
+// MinLength requires strings to have at least n characters and slices at
+// least n elements.
+func MinLength(n int) Rule {
+	return func(value any) *Error {
+		rv := indirect(value)
+		if isEmpty(rv) {
+			return nil
+		}
+		l, ok := length(rv)
+		if ok && l < n {
+			if rv.Kind() == reflect.String {
+				return fail("min_length", "min", n)
+			}
+			return fail("min_items", "min", n)
+		}
+		return nil
+	}
+}
+
+// MaxLength allows strings of up to n characters and slices of up to n
+// elements.
+func MaxLength(n int) Rule {
+	return func(value any) *Error {
+		rv := indirect(value)
+		l, ok := length(rv)
+		if ok && l > n {
+			if rv.Kind() == reflect.String {
+				return fail("max_length", "max", n)
+			}
+			return fail("max_items", "max", n)
+		}
+		return nil
+	}
+}
+
+// Min requires a number to be at least min.
+func Min(min float64) Rule {
+	return func(value any) *Error {
+		n, ok := number(indirect(value))
+		if ok && n < min {
+			return fail("min_value", "min", min)
+		}
+		return nil
+	}
+}
+
+// Max requires a number to be at most max.
+func Max(max float64) Rule {
+	return func(value any) *Error {
+		n, ok := number(indirect(value))
+		if ok && n > max {
+			return fail("max_value", "max", max)
+		}
+		return nil
+	}
+}
+
+// Between requires a number to be in the range [min, max].
+func Between(min float64, max float64) Rule {
+	return func(value any) *Error {
+		n, ok := number(indirect(value))
+		if ok && (n < min || n > max) {
+			return fail("between", "min", min, "max", max)
+		}
+		return nil
+	}
+}
+
+// URL requires an absolute http or https URL.
+func URL() Rule {
+	return func(value any) *Error {
+		rv := indirect(value)
+		if rv.Kind() != reflect.String || isEmpty(rv) {
+			return nil
+		}
+		u, err := url.Parse(rv.String())
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fail("url")
+		}
+		return nil
+	}
+}
+
+// Email requires a bare email address, without a display name.
+func Email() Rule {
+	return func(value any) *Error {
+		rv := indirect(value)
+		if rv.Kind() != reflect.String || isEmpty(rv) {
+			return nil
+		}
+		address, err := mail.ParseAddress(rv.String())
+		if err != nil || address.Address != rv.String() {
+			return fail("email")
+		}
+		return nil
+	}
+}
+
+// Matches requires a string to match rx. code names the message shown when
+// it doesn't, e.g. "pattern" or a more specific one such as "price_format".
+func Matches(rx *regexp.Regexp, code string) Rule {
+	return func(value any) *Error {
+		rv := indirect(value)
+		if rv.Kind() != reflect.String || isEmpty(rv) {
+			return nil
+		}
+		if !rx.MatchString(rv.String()) {
+			return fail(code)
+		}
+		return nil
+	}
+}
+
+// OneOf requires a string, or every string in a slice, to be one of the
+// permitted values.
+func OneOf(permittedValues ...string) Rule {
+	return func(value any) *Error {
+		rv := indirect(value)
+		var values []string
+		switch {
+		case rv.Kind() == reflect.String:
+			if rv.Len() == 0 {
+				return nil
+			}
+			values = []string{rv.String()}
+		case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.String:
+			for i := 0; i < rv.Len(); i++ {
+				values = append(values, rv.Index(i).String())
+			}
+		}
+		for _, s := range values {
+			if !PermittedValue(s, permittedValues...) {
+				return fail("one_of", "values", strings.Join(permittedValues, ", "))
+			}
+		}
+		return nil
+	}
+}
+
+// Unique requires the elements of a slice to be distinct.
+func Unique() Rule {
+	return func(value any) *Error {
+		rv := indirect(value)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return nil
+		}
+		if !rv.Type().Elem().Comparable() {
+			return nil
+		}
+		seen := make(map[any]bool, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			element := rv.Index(i).Interface()
+			if seen[element] {
+				return fail("unique")
+			}
+			seen[element] = true
+		}
+		return nil
+	}
+}
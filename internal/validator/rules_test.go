@@ -0,0 +1,125 @@
+// Filename: internal/validator/rules_test.go
+package validator
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	name := "Lamp"
+	blank := ""
+	var missing *string
+	rating := int64(6)
+	pricePattern := regexp.MustCompile(`^\d+\.\d{2}$`)
+
+	failure := func(code string, params ...any) *Error { return fail(code, params...) }
+
+	tests := []struct {
+		name  string
+		rule  Rule
+		value any
+		want  *Error
+	}{
+		{"required string", Required(), "Lamp", nil},
+		{"required empty string", Required(), "", failure("required")},
+		{"required whitespace", Required(), " \t\n", failure("required")},
+		{"required zero number", Required(), 0, failure("required")},
+		{"required number", Required(), 3, nil},
+		{"required empty slice", Required(), []string{}, failure("required")},
+		{"required nil slice", Required(), []string(nil), failure("required")},
+		{"required slice", Required(), []string{"a"}, nil},
+		{"required pointer", Required(), &name, nil},
+		{"required pointer to empty", Required(), &blank, failure("required")},
+		{"required nil pointer", Required(), missing, failure("required")},
+		{"required nil", Required(), nil, failure("required")},
+
+		{"minlen long enough", MinLength(3), "abc", nil},
+		{"minlen too short", MinLength(3), "ab", failure("min_length", "min", 3)},
+		{"minlen counts characters", MinLength(3), "çaé", nil},
+		{"minlen empty is optional", MinLength(3), "", nil},
+		{"minlen slice too short", MinLength(2), []string{"a"}, failure("min_items", "min", 2)},
+		{"minlen empty slice is optional", MinLength(2), []string{}, nil},
+		{"minlen pointer", MinLength(5), &name, failure("min_length", "min", 5)},
+		{"minlen number ignored", MinLength(3), 1, nil},
+
+		{"maxlen short enough", MaxLength(4), "Lamp", nil},
+		{"maxlen too long", MaxLength(3), "Lamp", failure("max_length", "max", 3)},
+		{"maxlen counts characters", MaxLength(3), "çaé", nil},
+		{"maxlen slice too long", MaxLength(1), []string{"a", "b"}, failure("max_items", "max", 1)},
+		{"maxlen map too long", MaxLength(1), map[string]int{"a": 1, "b": 2}, failure("max_items", "max", 1)},
+		{"maxlen nil pointer", MaxLength(1), missing, nil},
+
+		{"min at bound", Min(1), 1, nil},
+		{"min below", Min(1), 0, failure("min_value", "min", 1.0)},
+		{"min float below", Min(0.5), 0.25, failure("min_value", "min", 0.5)},
+		{"min unsigned", Min(1), uint8(2), nil},
+		{"min string ignored", Min(1), "0", nil},
+
+		{"max at bound", Max(5), int32(5), nil},
+		{"max above", Max(5), &rating, failure("max_value", "max", 5.0)},
+		{"max float", Max(5), float32(5.5), failure("max_value", "max", 5.0)},
+
+		{"between inside", Between(1, 5), 3, nil},
+		{"between low bound", Between(1, 5), 1, nil},
+		{"between high bound", Between(1, 5), 5, nil},
+		{"between below", Between(1, 5), 0, failure("between", "min", 1.0, "max", 5.0)},
+		{"between above", Between(1, 5), int64(6), failure("between", "min", 1.0, "max", 5.0)},
+
+		{"url https", URL(), "https://example.com/hook", nil},
+		{"url http", URL(), "http://localhost:8080", nil},
+		{"url empty is optional", URL(), "", nil},
+		{"url other scheme", URL(), "ftp://example.com", failure("url")},
+		{"url relative", URL(), "/hook", failure("url")},
+		{"url no host", URL(), "https://", failure("url")},
+		{"url unparsable", URL(), "http://[::1", failure("url")},
+
+		{"email", Email(), "ana@example.com", nil},
+		{"email empty is optional", Email(), "", nil},
+		{"email display name", Email(), "Ana <ana@example.com>", failure("email")},
+		{"email no domain", Email(), "ana", failure("email")},
+
+		{"matches", Matches(pricePattern, "price_format"), "9.99", nil},
+		{"matches not", Matches(pricePattern, "price_format"), "9.9", failure("price_format")},
+		{"matches empty is optional", Matches(pricePattern, "price_format"), "", nil},
+
+		{"oneof", OneOf("new", "sale"), "sale", nil},
+		{"oneof not", OneOf("new", "sale"), "old", failure("one_of", "values", "new, sale")},
+		{"oneof empty is optional", OneOf("new", "sale"), "", nil},
+		{"oneof slice", OneOf("new", "sale"), []string{"new", "sale"}, nil},
+		{"oneof slice not", OneOf("new", "sale"), []string{"new", "old"}, failure("one_of", "values", "new, sale")},
+		{"oneof case sensitive", OneOf("new"), "New", failure("one_of", "values", "new")},
+
+		{"unique", Unique(), []string{"a", "b"}, nil},
+		{"unique duplicate", Unique(), []string{"a", "b", "a"}, failure("unique")},
+		{"unique numbers", Unique(), []int{1, 1}, failure("unique")},
+		{"unique array", Unique(), [2]int{1, 1}, failure("unique")},
+		{"unique empty", Unique(), []string{}, nil},
+		{"unique not a slice", Unique(), "aa", nil},
+		{"unique incomparable elements", Unique(), [][]int{{1}, {1}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestField(t *testing.T) {
+	v := New()
+	v.Field("name", "", Required(), MaxLength(3))
+	v.Field("tags", []string{"a", "b", "a", "c"}, MaxLength(3), Unique(), Unique())
+	v.Field("rating", 3, Between(1, 5))
+
+	want := map[string][]Error{
+		"name": {NewError("required")},
+		// Every failing rule is recorded, in order, but only once.
+		"tags": {NewError("max_items", "max", 3), NewError("unique")},
+	}
+	if !reflect.DeepEqual(v.Errors, want) {
+		t.Errorf("errors = %+v, want %+v", v.Errors, want)
+	}
+}
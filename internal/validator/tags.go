@@ -0,0 +1,135 @@
+// Filename: internal/validator/tags.go
+package validator
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Struct validates the exported fields of the struct s points to using
+// their validate tags, e.g.
+//
+//	Name   string   `json:"name" validate:"required,maxlen=100"`
+//	Rating int64    `json:"rating" validate:"required,min=1,max=5"`
+//	Tags   []string `json:"tags" validate:"unique,oneof=new sale"`
+//
+// Errors are recorded under the field's JSON name. The tag rules are
+// required, minlen=n, maxlen=n, min=n, max=n, url, email, oneof=a b c,
+// unique and pattern=name for a pattern added with RegisterPattern.
+// Struct panics on a tag it doesn't understand, as that is a programming
+// error.
+func (v *Validator) Struct(s any) {
+	rv := reflect.ValueOf(s)
+	for rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+
+	for _, field := range structRules(rv.Type()) {
+		v.Field(field.key, rv.Field(field.index).Interface(), field.rules...)
+	}
+}
+
+type fieldRules struct {
+	index int
+	key   string
+	rules []Rule
+}
+
+var (
+	rulesCache sync.Map // reflect.Type -> []fieldRules
+
+	patternsMu sync.RWMutex
+	patterns   = map[string]struct {
+		rx   *regexp.Regexp
+		code string
+	}{}
+)
+
+// RegisterPattern makes rx available to validate tags as pattern=name.
+// code is the message code reported when a value doesn't match.
+func RegisterPattern(name string, rx *regexp.Regexp, code string) {
+	patternsMu.Lock()
+	defer patternsMu.Unlock()
+
+	patterns[name] = struct {
+		rx   *regexp.Regexp
+		code string
+	}{rx, code}
+}
+
+// structRules parses the validate tags of t once and caches the result.
+func structRules(t reflect.Type) []fieldRules {
+	if cached, found := rulesCache.Load(t); found {
+		return cached.([]fieldRules)
+	}
+
+	var fields []fieldRules
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" || tag == "-" || !field.IsExported() {
+			continue
+		}
+
+		key := strings.Split(field.Tag.Get("json"), ",")[0]
+		if key == "" || key == "-" {
+			key = field.Name
+		}
+
+		var rules []Rule
+		for _, option := range strings.Split(tag, ",") {
+			rules = append(rules, parseRule(t, field.Name, option))
+		}
+		fields = append(fields, fieldRules{index: i, key: key, rules: rules})
+	}
+
+	rulesCache.Store(t, fields)
+	return fields
+}
+
+func parseRule(t reflect.Type, fieldName string, option string) Rule {
+	name, argument, _ := strings.Cut(strings.TrimSpace(option), "=")
+
+	number := func() float64 {
+		n, err := strconv.ParseFloat(argument, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validator: %s.%s: %s needs a number, got %q", t.Name(), fieldName, name, argument))
+		}
+		return n
+	}
+
+	switch name {
+	case "required":
+		return Required()
+	case "minlen":
+		return MinLength(int(number()))
+	case "maxlen":
+		return MaxLength(int(number()))
+	case "min":
+		return Min(number())
+	case "max":
+		return Max(number())
+	case "url":
+		return URL()
+	case "email":
+		return Email()
+	case "oneof":
+		return OneOf(strings.Fields(argument)...)
+	case "unique":
+		return Unique()
+	case "pattern":
+		patternsMu.RLock()
+		pattern, found := patterns[argument]
+		patternsMu.RUnlock()
+		if !found {
+			panic(fmt.Sprintf("validator: %s.%s: unknown pattern %q", t.Name(), fieldName, argument))
+		}
+		return Matches(pattern.rx, pattern.code)
+	default:
+		panic(fmt.Sprintf("validator: %s.%s: unknown rule %q", t.Name(), fieldName, name))
+	}
+}
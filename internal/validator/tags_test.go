@@ -0,0 +1,124 @@
+// Filename: internal/validator/tags_test.go
+package validator
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func init() {
+	RegisterPattern("test_sku", regexp.MustCompile(`^[A-Z]{3}-\d+$`), "sku_format")
+}
+
+type taggedProduct struct {
+	Name     string   `json:"name" validate:"required,maxlen=5"`
+	Rating   *int64   `json:"rating,omitempty" validate:"min=1, max=5"`
+	Tags     []string `json:"tags" validate:"unique,oneof=new sale"`
+	SKU      string   `json:"sku" validate:"pattern=test_sku"`
+	Contact  string   `validate:"email"`
+	Homepage string   `json:"-" validate:"url"`
+	Ignored  string   `json:"ignored" validate:"-"`
+	Untagged string   `json:"untagged"`
+	internal string   `validate:"required"` // unexported, so skipped
+}
+
+func TestStruct(t *testing.T) {
+	rating := int64(9)
+	tests := []struct {
+		name    string
+		product taggedProduct
+		want    map[string][]Error
+	}{
+		{
+			name:    "valid",
+			product: taggedProduct{Name: "Lamp", Tags: []string{"new"}, SKU: "LMP-1", Contact: "a@example.com", Homepage: "https://example.com"},
+			want:    map[string][]Error{},
+		},
+		{
+			name:    "empty",
+			product: taggedProduct{},
+			want:    map[string][]Error{"name": {NewError("required")}},
+		},
+		{
+			name: "every field failing",
+			product: taggedProduct{Name: "Table lamp", Rating: &rating, Tags: []string{"old", "old"}, SKU: "lamp",
+				Contact: "nobody", Homepage: "example.com", Ignored: "x"},
+			want: map[string][]Error{
+				"name":   {NewError("max_length", "max", 5)},
+				"rating": {NewError("max_value", "max", 5.0)},
+				"tags":   {NewError("unique"), NewError("one_of", "values", "new, sale")},
+				"sku":    {NewError("sku_format")},
+				// Fields without a JSON name are reported under the Go name.
+				"Contact":  {NewError("email")},
+				"Homepage": {NewError("url")},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := New()
+			v.Struct(&tt.product)
+			if !reflect.DeepEqual(v.Errors, tt.want) {
+				t.Errorf("errors = %+v, want %+v", v.Errors, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructMalformedTags(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{
+			name: "unknown rule",
+			value: &struct {
+				Name string `validate:"requird"`
+			}{},
+			want: `Name: unknown rule "requird"`,
+		},
+		{
+			name: "missing number",
+			value: &struct {
+				Name string `validate:"maxlen"`
+			}{},
+			want: `Name: maxlen needs a number, got ""`,
+		},
+		{
+			name: "not a number",
+			value: &struct {
+				Rating int `validate:"min=one"`
+			}{},
+			want: `Rating: min needs a number, got "one"`,
+		},
+		{
+			name: "unknown pattern",
+			value: &struct {
+				SKU string `validate:"pattern=nope"`
+			}{},
+			want: `SKU: unknown pattern "nope"`,
+		},
+		{
+			name: "empty rule",
+			value: &struct {
+				Name string `validate:"required,"`
+			}{},
+			want: `Name: unknown rule ""`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				err := recover()
+				message, _ := err.(string)
+				if !strings.HasPrefix(message, "validator: ") || !strings.HasSuffix(message, tt.want) {
+					t.Errorf("panicked with %v, want a message ending in %s", err, tt.want)
+				}
+			}()
+			New().Struct(tt.value)
+		})
+	}
+}
@@ -1,15 +1,43 @@
 // Filename: internal/validator/validator.go
 package validator
 
-import "slices"
+import (
+	"fmt"
+	"reflect"
+	"slices"
+)
 
+// Error is one validation failure: a message code and the values the
+// message refers to. Message is left empty here and filled in, in the
+// client's language, when the response is written.
+type Error struct {
+	Code    string         `json:"code"`
+	Params  map[string]any `json:"params,omitempty"`
+	Message string         `json:"message,omitempty"`
+}
+
+// NewError builds an Error from a code and alternating parameter names and
+// values, e.g. NewError("max_length", "max", 100).
+func NewError(code string, params ...any) Error {
+	e := Error{Code: code}
+	if len(params) > 0 {
+		e.Params = make(map[string]any, len(params)/2)
+		for i := 0; i+1 < len(params); i += 2 {
+			e.Params[fmt.Sprint(params[i])] = params[i+1]
+		}
+	}
+	return e
+}
+
+// Validator collects the errors found in a piece of input. A field can have
+// several errors, kept in the order they were found.
 type Validator struct {
-	Errors map[string]string
+	Errors map[string][]Error
 }
 
 func New() *Validator {
 	return &Validator{
-		Errors: make(map[string]string),
+		Errors: make(map[string][]Error),
 	}
 }
 
@@ -17,16 +45,21 @@ func (v *Validator) IsEmpty() bool {
 	return len(v.Errors) == 0
 }
 
-func (v *Validator) AddError(key string, message string) {
-	_, exists := v.Errors[key]
-	if !exists {
-		v.Errors[key] = message
+// AddError records the error code, with its parameters given as name/value
+// pairs, against key.
+func (v *Validator) AddError(key string, code string, params ...any) {
+	v.add(key, NewError(code, params...))
+}
+
+func (v *Validator) add(key string, e Error) {
+	if !slices.ContainsFunc(v.Errors[key], func(existing Error) bool { return reflect.DeepEqual(existing, e) }) {
+		v.Errors[key] = append(v.Errors[key], e)
 	}
 }
 
-func (v *Validator) Check(acceptable bool, key string, message string) {
+func (v *Validator) Check(acceptable bool, key string, code string, params ...any) {
 	if !acceptable {
-		v.AddError(key, message)
+		v.AddError(key, code, params...)
 	}
 }
 
@@ -0,0 +1,29 @@
+CREATE TABLE webhooks (
+    webhook_id bigserial PRIMARY KEY,
+    url text NOT NULL,
+    secret text NOT NULL,
+    events text[] NOT NULL,
+    active boolean NOT NULL DEFAULT true,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1
+);
+
+-- Every event sent to a subscription is recorded here. The delivery worker
+-- picks up rows that are pending and due, and moves them to delivered or,
+-- once the attempts are used up, to dead.
+CREATE TABLE webhook_deliveries (
+    delivery_id bigserial PRIMARY KEY,
+    webhook_id bigint NOT NULL REFERENCES webhooks(webhook_id) ON DELETE CASCADE,
+    event text NOT NULL,
+    payload jsonb NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_status_code integer,
+    last_error text,
+    delivered_at timestamp(0) WITH TIME ZONE,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id);
@@ -0,0 +1,20 @@
+CREATE TABLE jobs (
+    job_id bigserial PRIMARY KEY,
+    kind text NOT NULL,
+    payload jsonb NOT NULL DEFAULT '{}',
+    unique_key text,
+    status text NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    max_attempts integer NOT NULL DEFAULT 5,
+    run_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    locked_at timestamp(0) WITH TIME ZONE,
+    last_error text,
+    completed_at timestamp(0) WITH TIME ZONE,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Only one job with a given key may be waiting or running at a time
+CREATE UNIQUE INDEX jobs_unique_key_idx ON jobs (unique_key)
+    WHERE unique_key IS NOT NULL AND status IN ('pending', 'running');
+
+CREATE INDEX jobs_due_idx ON jobs (run_at) WHERE status = 'pending';
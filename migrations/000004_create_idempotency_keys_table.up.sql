@@ -0,0 +1,14 @@
+CREATE TABLE idempotency_keys (
+    caller text NOT NULL,
+    idempotency_key text NOT NULL,
+    request_hash text NOT NULL,
+    status text NOT NULL DEFAULT 'in_progress',
+    response_status integer,
+    response_headers jsonb,
+    response_body bytea,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at timestamp(0) WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (caller, idempotency_key)
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
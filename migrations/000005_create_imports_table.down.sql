@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS imports;
+ALTER TABLE products DROP COLUMN IF EXISTS external_ref;
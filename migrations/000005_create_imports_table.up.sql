@@ -0,0 +1,19 @@
+-- Reference of the product in the merchandisers' own catalog, used by
+-- imports to update a product instead of creating it twice
+ALTER TABLE products ADD COLUMN external_ref text UNIQUE;
+
+CREATE TABLE imports (
+    import_id bigserial PRIMARY KEY,
+    format text NOT NULL,
+    dry_run boolean NOT NULL DEFAULT false,
+    status text NOT NULL DEFAULT 'pending',
+    total_rows integer NOT NULL DEFAULT 0,
+    processed_rows integer NOT NULL DEFAULT 0,
+    created_count integer NOT NULL DEFAULT 0,
+    updated_count integer NOT NULL DEFAULT 0,
+    failed_count integer NOT NULL DEFAULT 0,
+    errors jsonb NOT NULL DEFAULT '[]',
+    message text,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at timestamp(0) WITH TIME ZONE
+);
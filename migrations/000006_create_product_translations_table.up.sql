@@ -0,0 +1,12 @@
+-- Name, description and category of a product in other languages. locale
+-- is a language tag such as es or es-MX.
+CREATE TABLE product_translations (
+    product_id bigint NOT NULL REFERENCES products ON DELETE CASCADE,
+    locale text NOT NULL,
+    name text NOT NULL,
+    description text NOT NULL,
+    category text NOT NULL,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    PRIMARY KEY (product_id, locale)
+);
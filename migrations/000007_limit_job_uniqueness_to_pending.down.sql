@@ -0,0 +1,5 @@
+-- Fails if a job is waiting while another with the same key runs; let the
+-- queue drain first.
+DROP INDEX IF EXISTS jobs_unique_key_idx;
+CREATE UNIQUE INDEX jobs_unique_key_idx ON jobs (unique_key)
+    WHERE unique_key IS NOT NULL AND status IN ('pending', 'running');
@@ -0,0 +1,5 @@
+-- A job with a given key may be queued while another one runs, so that a
+-- change made during the run isn't missed. Only one may be waiting.
+DROP INDEX IF EXISTS jobs_unique_key_idx;
+CREATE UNIQUE INDEX jobs_unique_key_idx ON jobs (unique_key)
+    WHERE unique_key IS NOT NULL AND status = 'pending';